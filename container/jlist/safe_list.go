@@ -180,6 +180,17 @@ func (l *SafeList) Join(sep string) string {
 	return buf.String()
 }
 
+// FrontAll 以切片形式返回从头到尾的所有值。
+func (l *SafeList) FrontAll() []interface{} {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	res := make([]interface{}, 0, l.list.Len())
+	for e := l.list.Front(); e != nil; e = e.Next() {
+		res = append(res, e.Value)
+	}
+	return res
+}
+
 // Clear 清空列表
 func (l *SafeList) Clear() {
 	l.mu.Lock()
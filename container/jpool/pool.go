@@ -13,6 +13,9 @@ import (
 // ErrPoolEmpty 当池中无可用对象且 NewFunc 也未设置时返回。
 var ErrPoolEmpty = jerr.WithCode(jcode.NewErrCode(jcode.OptErr), "pool is empty")
 
+// ErrPoolClosed 当池已关闭时返回。
+var ErrPoolClosed = jerr.WithCode(jcode.NewErrCode(jcode.OptErr), "pool closed")
+
 // Pool 是一个对象可复用的简单池。
 type Pool struct {
 	idle       *jlist.SafeList // 空闲对象列表
@@ -23,6 +26,9 @@ type Pool struct {
 	mu           sync.Mutex
 	closed       bool
 	cancelReaper context.CancelFunc
+	maxSize      int           // 对象总数上限（空闲与借出），0 表示不限制
+	total        int           // 由 newFunc 创建且尚未过期或丢弃的对象总数
+	waitCh       chan struct{} // 等待对象归还的通知通道，归还或丢弃时关闭并重置
 }
 
 type poolItem struct {
@@ -55,52 +61,173 @@ func New(
 	return p
 }
 
+// SetMaxSize 设置对象总数（空闲与借出）的上限，0 表示不限制。
+// 达到上限时 Get/GetCtx 阻塞，直到有对象被 Put 归还或被 Discard 丢弃。
+func (p *Pool) SetMaxSize(size int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.maxSize = size
+	p.notify()
+}
+
 // Put 放回一个对象到池中，可能会被 later 过期回收。
 func (p *Pool) Put(obj interface{}) error {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 	if p.closed {
-		return jerr.WithCode(jcode.NewErrCode(jcode.OptErr), "pool closed")
+		return ErrPoolClosed
 	}
 	item := &poolItem{obj, 0}
 	if p.ttl > 0 {
 		item.expireAt = time.Now().Add(p.ttl).UnixMilli()
 	}
 	p.idle.PushBack(item)
+	p.notify()
 	return nil
 }
 
+// Discard 丢弃一个借出的对象而不归还，释放其占用的总数并调用 ExpireFunc。
+func (p *Pool) Discard(obj interface{}) {
+	p.mu.Lock()
+	p.release()
+	p.mu.Unlock()
+	if p.expireFunc != nil {
+		p.expireFunc(obj)
+	}
+}
+
+// Fill 通过 NewFunc 创建对象并放入池中，直到对象总数达到 size（不超过 MaxSize）。
+// 常用于预热池子或维持最小对象数。
+func (p *Pool) Fill(size int) error {
+	if p.newFunc == nil {
+		return ErrPoolEmpty
+	}
+	for {
+		p.mu.Lock()
+		if p.closed {
+			p.mu.Unlock()
+			return ErrPoolClosed
+		}
+		if p.total >= size || (p.maxSize > 0 && p.total >= p.maxSize) {
+			p.mu.Unlock()
+			return nil
+		}
+		p.total++
+		p.mu.Unlock()
+		obj, err := p.newFunc()
+		if err != nil {
+			p.mu.Lock()
+			p.release()
+			p.mu.Unlock()
+			return err
+		}
+		if err = p.Put(obj); err != nil {
+			p.Discard(obj)
+			return err
+		}
+	}
+}
+
 // Get 从池中取一个对象：
 //  1. 如果有未过期的，返回之；
 //  2. 否则尝试 newFunc；
 //  3. 还没拿到，则 ErrPoolEmpty。
+//
+// 设置了 MaxSize 且对象总数已达上限时，阻塞等待对象归还。
 func (p *Pool) Get() (interface{}, error) {
-	// 先从空闲列表中扫一遍
+	return p.GetCtx(context.Background())
+}
+
+// GetCtx 与 Get 相同，但在等待对象归还时可通过 ctx 取消，取消时返回 ctx 的错误。
+func (p *Pool) GetCtx(ctx context.Context) (interface{}, error) {
+	for {
+		p.mu.Lock()
+		if p.closed {
+			p.mu.Unlock()
+			return nil, ErrPoolClosed
+		}
+		// 先从空闲列表中扫一遍
+		if obj, ok := p.popIdle(); ok {
+			p.mu.Unlock()
+			return obj, nil
+		}
+		if p.newFunc == nil {
+			p.mu.Unlock()
+			return nil, ErrPoolEmpty
+		}
+		// 池空且未达上限，尝试 newFunc
+		if p.maxSize <= 0 || p.total < p.maxSize {
+			p.total++
+			p.mu.Unlock()
+			obj, err := p.newFunc()
+			if err != nil {
+				p.mu.Lock()
+				p.release()
+				p.mu.Unlock()
+				return nil, err
+			}
+			return obj, nil
+		}
+		// 达到上限，等待归还
+		if p.waitCh == nil {
+			p.waitCh = make(chan struct{})
+		}
+		waitCh := p.waitCh
+		p.mu.Unlock()
+		select {
+		case <-waitCh:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// Size 返回当前空闲对象数。
+func (p *Pool) Size() int {
+	return p.idle.Len()
+}
+
+// Total 返回由 NewFunc 创建且尚未过期或丢弃的对象总数，包括空闲与借出的对象。
+func (p *Pool) Total() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.total
+}
+
+// popIdle 弹出一个未过期的空闲对象，过期对象调用 ExpireFunc 后丢弃，调用方需持有锁。
+func (p *Pool) popIdle() (interface{}, bool) {
 	for {
 		r, _ := p.idle.PopFront()
 		if r == nil {
-			break
+			return nil, false
 		}
 		item := r.(*poolItem)
 		// never expire
 		if p.ttl == 0 || item.expireAt > time.Now().UnixMilli() {
-			return item.obj, nil
+			return item.obj, true
 		}
 		// 过期：调用回调
+		p.release()
 		if p.expireFunc != nil {
 			p.expireFunc(item.obj)
 		}
 	}
-	// 池空，尝试 newFunc
-	if p.newFunc != nil {
-		return p.newFunc()
+}
+
+// release 释放一个对象占用的总数并通知等待者，调用方需持有锁。
+func (p *Pool) release() {
+	if p.total > 0 {
+		p.total--
 	}
-	return nil, ErrPoolEmpty
+	p.notify()
 }
 
-// Size 返回当前空闲对象数。
-func (p *Pool) Size() int {
-	return p.idle.Len()
+// notify 唤醒所有等待对象归还的 GetCtx，调用方需持有锁。
+func (p *Pool) notify() {
+	if p.waitCh != nil {
+		close(p.waitCh)
+		p.waitCh = nil
+	}
 }
 
 // Clear 立即清空所有对象，并调用 ExpireFunc。
@@ -113,7 +240,8 @@ func (p *Pool) Clear() {
 // Close 关闭池子：
 //   - 标记关闭，
 //   - 停止后台清理，
-//   - 清空并过期所有对象。
+//   - 清空并过期所有对象，
+//   - 唤醒等待中的 GetCtx，使其返回 ErrPoolClosed。
 func (p *Pool) Close() {
 	p.mu.Lock()
 	if p.closed {
@@ -123,6 +251,7 @@ func (p *Pool) Close() {
 	p.closed = true
 	p.cancelReaper()
 	p.purgeAll()
+	p.notify()
 	p.mu.Unlock()
 }
 
@@ -139,12 +268,14 @@ func (p *Pool) runReaper(ctx context.Context) {
 		case <-ctx.Done():
 			return
 		case <-ticker.C:
+			p.mu.Lock()
 			p.purgeExpired()
+			p.mu.Unlock()
 		}
 	}
 }
 
-// purgeExpired 移除所有已过期的对象（expireAt <= now），并回调 ExpireFunc。
+// purgeExpired 移除所有已过期的对象（expireAt <= now），并回调 ExpireFunc，调用方需持有锁。
 func (p *Pool) purgeExpired() {
 	now := time.Now().UnixMilli()
 	for {
@@ -158,19 +289,21 @@ func (p *Pool) purgeExpired() {
 			p.idle.PushFront(item)
 			return
 		}
+		p.release()
 		if p.expireFunc != nil {
 			p.expireFunc(item.obj)
 		}
 	}
 }
 
-// purgeAll 清空所有对象，并调用 ExpireFunc。
+// purgeAll 清空所有对象，并调用 ExpireFunc，调用方需持有锁。
 func (p *Pool) purgeAll() {
 	for {
 		r, _ := p.idle.PopFront()
 		if r == nil {
 			return
 		}
+		p.release()
 		if p.expireFunc != nil {
 			p.expireFunc(r.(*poolItem).obj)
 		}
@@ -29,8 +29,9 @@ type EUnwrap interface {
 
 type WErr struct {
 	error
-	code int
-	msg  string
+	code  int
+	msg   string
+	stack []uintptr // Caller stack where the error is created, nil if capturing is disabled.
 }
 
 func (e *WErr) Error() string {
@@ -40,3 +41,11 @@ func (e *WErr) Error() string {
 	}
 	return msg
 }
+
+// Unwrap returns the wrapped error, which makes the error chain work with errors.Is and errors.As.
+func (e *WErr) Unwrap() error {
+	if e == nil {
+		return nil
+	}
+	return e.error
+}
@@ -9,15 +9,17 @@ import (
 
 func WithCode(rc jcode.RetCode, msg ...string) *WErr {
 	return &WErr{
-		msg:  fmt.Sprintf("[%s] %s", rc.Msg(), strings.Join(msg, errMsgSplit)),
-		code: rc.Code(),
+		msg:   fmt.Sprintf("[%s] %s", rc.Msg(), strings.Join(msg, errMsgSplit)),
+		code:  rc.Code(),
+		stack: callers(),
 	}
 }
 
 func WithCodeF(rc jcode.RetCode, format string, args ...interface{}) *WErr {
 	return &WErr{
-		msg:  fmt.Sprintf("[%s] %s", rc.Msg(), fmt.Sprintf(format, args...)),
-		code: rc.Code(),
+		msg:   fmt.Sprintf("[%s] %s", rc.Msg(), fmt.Sprintf(format, args...)),
+		code:  rc.Code(),
+		stack: callers(),
 	}
 }
 
@@ -29,6 +31,7 @@ func WithCodeErr(rc jcode.RetCode, err error, msg ...string) *WErr {
 		error: err,
 		msg:   fmt.Sprintf("[%s] %s", rc.Msg(), strings.Join(msg, errMsgSplit)),
 		code:  rc.Code(),
+		stack: callers(),
 	}
 }
 
@@ -40,6 +43,7 @@ func WithCodeErrF(rc jcode.RetCode, err error, format string, args ...interface{
 		error: err,
 		msg:   fmt.Sprintf("[%s] %s", rc.Msg(), fmt.Sprintf(format, args...)),
 		code:  rc.Code(),
+		stack: callers(),
 	}
 }
 
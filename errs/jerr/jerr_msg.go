@@ -7,15 +7,17 @@ import (
 
 func WithMsg(msg string) *WErr {
 	return &WErr{
-		code: jcode.Nil,
-		msg:  msg,
+		code:  jcode.Nil,
+		msg:   msg,
+		stack: callers(),
 	}
 }
 
 func WithMsgF(format string, args ...interface{}) *WErr {
 	return &WErr{
-		code: jcode.Nil,
-		msg:  fmt.Sprintf(format, args...),
+		code:  jcode.Nil,
+		msg:   fmt.Sprintf(format, args...),
+		stack: callers(),
 	}
 }
 
@@ -27,6 +29,7 @@ func WithMsgErr(err error, msg string) error {
 		error: err,
 		msg:   msg,
 		code:  ToRetCode(err).Code(),
+		stack: callers(),
 	}
 }
 
@@ -38,5 +41,6 @@ func WithMsgErrF(err error, format string, args ...interface{}) error {
 		error: err,
 		msg:   fmt.Sprintf(format, args...),
 		code:  ToRetCode(err).Code(),
+		stack: callers(),
 	}
 }
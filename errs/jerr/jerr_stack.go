@@ -0,0 +1,112 @@
+package jerr
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"runtime"
+	"strings"
+	"sync/atomic"
+)
+
+const (
+	// stackMaxDepth is the max depth of the caller stack captured by the constructors.
+	stackMaxDepth = 32
+)
+
+// stackDisabled disables capturing the caller stack in the constructors.
+var stackDisabled atomic.Bool
+
+// SetStackEnabled enables or disables capturing the caller stack in the constructors, which is
+// enabled in default. It can be disabled for the hot paths where the errors are created frequently
+// and their stacks are not cared about.
+func SetStackEnabled(enabled bool) {
+	stackDisabled.Store(!enabled)
+}
+
+// IsStackEnabled checks and returns whether capturing the caller stack is enabled.
+func IsStackEnabled() bool {
+	return !stackDisabled.Load()
+}
+
+// Stack returns the caller stacks of all errors in the chain of `err`, in the same format as "%+v"
+// but without the leading error message. It returns an empty string if no error in the chain has
+// caller stack.
+func Stack(err error) string {
+	if err == nil {
+		return ""
+	}
+	var (
+		buffer   = bytes.NewBuffer(nil)
+		hasStack = false
+	)
+	for i, e := 1, err; e != nil; i, e = i+1, errors.Unwrap(e) {
+		werr, ok := e.(*WErr)
+		if !ok {
+			fmt.Fprintf(buffer, "%d. %s\n", i, e.Error())
+			continue
+		}
+		fmt.Fprintf(buffer, "%d. %s\n", i, werr.msg)
+		if len(werr.stack) > 0 {
+			hasStack = true
+			writeStack(buffer, werr.stack)
+		}
+	}
+	if !hasStack {
+		return ""
+	}
+	return buffer.String()
+}
+
+// Format implements interface fmt.Formatter.
+//
+//	%v, %s: the error message chain, like "outer: inner: root".
+//	%q:     the quoted error message chain.
+//	%+v:    the error message chain followed by the caller stacks of all errors in the chain.
+func (e *WErr) Format(s fmt.State, verb rune) {
+	switch verb {
+	case 'v':
+		_, _ = io.WriteString(s, e.Error())
+		if s.Flag('+') {
+			if stack := Stack(e); stack != "" {
+				_, _ = io.WriteString(s, "\n"+strings.TrimSuffix(stack, "\n"))
+			}
+		}
+	case 's':
+		_, _ = io.WriteString(s, e.Error())
+	case 'q':
+		_, _ = fmt.Fprintf(s, "%q", e.Error())
+	default:
+		_, _ = fmt.Fprintf(s, "%%!%c(*jerr.WErr=%s)", verb, e.Error())
+	}
+}
+
+// callers captures and returns the caller stack of the constructor calling it, or nil if it's disabled.
+func callers() []uintptr {
+	if stackDisabled.Load() {
+		return nil
+	}
+	var pcs [stackMaxDepth]uintptr
+	// Skip runtime.Callers, callers and the constructor.
+	n := runtime.Callers(3, pcs[:])
+	return pcs[:n]
+}
+
+// writeStack writes the frames of `stack` to `buffer`, except the frames of package runtime.
+func writeStack(buffer *bytes.Buffer, stack []uintptr) {
+	var (
+		index  = 1
+		frames = runtime.CallersFrames(stack)
+	)
+	for {
+		frame, more := frames.Next()
+		if !strings.HasPrefix(frame.Function, "runtime.") {
+			fmt.Fprintf(buffer, "   %d). %s\n        %s:%d\n", index, frame.Function, frame.File, frame.Line)
+			index++
+		}
+		if !more {
+			break
+		}
+	}
+}
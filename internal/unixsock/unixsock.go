@@ -0,0 +1,85 @@
+// Package unixsock provides the address parsing and socket file management for unix domain sockets.
+package unixsock
+
+import (
+	"net"
+	"os"
+	"strings"
+
+	"github.com/e7coding/coding-common/errs/jerr"
+)
+
+// Networks of unix domain sockets.
+const (
+	NetworkUnix     = "unix"     // Unix stream socket.
+	NetworkUnixgram = "unixgram" // Unix datagram socket.
+)
+
+const schemeSeparator = "://"
+
+// Parse parses `address` like "unix:///var/run/app.sock" or "unixgram:///var/run/app.sock",
+// and returns its network and socket path. It returns `defaultNetwork` and `address` as it is
+// if `address` is not a unix domain socket address.
+func Parse(address, defaultNetwork string) (network, path string) {
+	for _, network = range []string{NetworkUnix, NetworkUnixgram} {
+		if strings.HasPrefix(address, network+schemeSeparator) {
+			return network, address[len(network)+len(schemeSeparator):]
+		}
+	}
+	return defaultNetwork, address
+}
+
+// IsUnix checks whether `network` is a unix domain socket network.
+func IsUnix(network string) bool {
+	return network == NetworkUnix || network == NetworkUnixgram
+}
+
+// Prepare prepares the socket file `path` for listening, which removes the stale socket file
+// left by a crashed process. It returns error if the socket is still in use, or the file is
+// not a socket. The abstract socket path starting with '@' is ignored.
+func Prepare(network, path string) error {
+	if path == "" || path[0] == '@' {
+		return nil
+	}
+	info, err := os.Lstat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return jerr.WithMsgErrF(err, `os.Lstat failed for socket file "%s"`, path)
+	}
+	if info.Mode()&os.ModeSocket == 0 {
+		return jerr.WithMsgF(`file "%s" exists and is not a socket`, path)
+	}
+	if conn, err := net.Dial(network, path); err == nil {
+		_ = conn.Close()
+		return jerr.WithMsgF(`socket file "%s" is in use`, path)
+	}
+	if err = os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return jerr.WithMsgErrF(err, `os.Remove failed for stale socket file "%s"`, path)
+	}
+	return nil
+}
+
+// Chmod changes the permission of socket file `path` to `perm` if `perm` is not 0.
+func Chmod(path string, perm os.FileMode) error {
+	if perm == 0 || path == "" || path[0] == '@' {
+		return nil
+	}
+	if err := os.Chmod(path, perm); err != nil {
+		return jerr.WithMsgErrF(err, `os.Chmod failed for socket file "%s" with perm "%s"`, path, perm)
+	}
+	return nil
+}
+
+// Remove removes socket file `path`, which is used for the datagram socket that is not removed
+// automatically when it's closed.
+func Remove(path string) error {
+	if path == "" || path[0] == '@' {
+		return nil
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return jerr.WithMsgErrF(err, `os.Remove failed for socket file "%s"`, path)
+	}
+	return nil
+}
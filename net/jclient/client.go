@@ -32,6 +32,10 @@ type Client struct {
 	retryCount        int               // Retry count when request fails.
 	noUrlEncode       bool              // No url encoding for request parameters.
 	retryInterval     time.Duration     // Retry interval when request fails.
+	metricsEnabled    bool              // Whether records metrics for outbound requests.
+	balancer          *Balancer         // Client-side load balancer over service endpoints.
+	compressEncoding  string            // Content encoding for compressing request body.
+	compressThreshold int               // Min size of request body to be compressed.
 	middlewareHandler []HandlerFunc     // Interceptor handlers
 }
 
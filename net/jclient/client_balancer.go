@@ -0,0 +1,360 @@
+package jclient
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/e7coding/coding-common/container/jatomic"
+	"github.com/e7coding/coding-common/crypto/jcrc32"
+	"github.com/e7coding/coding-common/errs/jerr"
+	"github.com/e7coding/coding-common/internal/intlog"
+)
+
+// Balancing strategies for Balancer.
+const (
+	BalanceRoundRobin     = `round-robin`     // Picks endpoints in turn.
+	BalanceWeighted       = `weighted`        // Picks endpoints in turn proportionally to their weights.
+	BalanceLeastInflight  = `least-inflight`  // Picks the endpoint with the least in-flight requests.
+	BalanceConsistentHash = `consistent-hash` // Picks the endpoint by consistent hashing of the request key.
+)
+
+const (
+	balancerDefaultMaxFails            = 3
+	balancerDefaultEjectDuration       = 30 * time.Second
+	balancerDefaultHealthCheckInterval = 10 * time.Second
+	balancerDefaultHealthCheckTimeout  = 3 * time.Second
+	balancerHashReplicas               = 100 // Virtual nodes for each weight unit on the hash ring.
+)
+
+const clientBalancerEndpointKey = "__clientBalancerEndpointKey"
+
+// BalancerEndpoint is a service endpoint for Balancer.
+type BalancerEndpoint struct {
+	URL    string // Base URL of the endpoint, eg: http://10.0.0.1:8080/api
+	Weight int    // Weight for weighted and consistent hash strategies, it is 1 in default.
+}
+
+// BalancerOption is the option for client-side load balancing.
+type BalancerOption struct {
+	// Endpoints are the replicated service endpoints.
+	Endpoints []BalancerEndpoint
+
+	// Strategy is the balancing strategy, it is BalanceRoundRobin in default.
+	Strategy string
+
+	// HashKey returns the key of the request for BalanceConsistentHash strategy,
+	// it uses the request URL path in default.
+	HashKey func(r *http.Request) string
+
+	// MaxFails is the count of consecutive failures that ejects an endpoint, it is 3 in default.
+	// A failure is either a request error or a 5xx response.
+	MaxFails int
+
+	// EjectDuration is how long an ejected endpoint is not picked, it is 30 seconds in default.
+	EjectDuration time.Duration
+
+	// HealthCheckPath enables active health checks if it's not empty, which is requested
+	// using GET method on each endpoint. The endpoint is healthy if it responds 2xx or 3xx.
+	HealthCheckPath string
+
+	// HealthCheckInterval is the interval of active health checks, it is 10 seconds in default.
+	HealthCheckInterval time.Duration
+
+	// HealthCheckTimeout is the timeout of each health check request, it is 3 seconds in default.
+	HealthCheckTimeout time.Duration
+}
+
+// Balancer distributes requests of the client over replicated service endpoints.
+type Balancer struct {
+	option    BalancerOption
+	endpoints []*balancerEndpoint
+	counter   *jatomic.Uint64 // Request counter for round-robin.
+	mu        sync.Mutex      // Mutex for smooth weighted round-robin.
+	ring      []balancerNode  // Sorted hash ring for consistent hashing.
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+// balancerEndpoint is the runtime state of an endpoint.
+type balancerEndpoint struct {
+	url           *url.URL
+	weight        int
+	currentWeight int            // Current weight of smooth weighted round-robin.
+	inflight      *jatomic.Int64 // Count of in-flight requests.
+	fails         *jatomic.Int64 // Count of consecutive failures.
+	ejectedUntil  *jatomic.Int64 // Unix nano timestamp until when the endpoint is ejected.
+	healthy       *jatomic.Bool  // Result of the last active health check.
+}
+
+// balancerNode is a virtual node on the hash ring.
+type balancerNode struct {
+	hash     uint32
+	endpoint *balancerEndpoint
+}
+
+// NewBalancer creates and returns a Balancer, which starts active health checks if configured.
+// The returned Balancer should be closed using Close if it will never be used.
+func NewBalancer(option BalancerOption) (*Balancer, error) {
+	if len(option.Endpoints) == 0 {
+		return nil, jerr.WithMsg(`no endpoint given for balancer`)
+	}
+	if option.Strategy == "" {
+		option.Strategy = BalanceRoundRobin
+	}
+	switch option.Strategy {
+	case BalanceRoundRobin, BalanceWeighted, BalanceLeastInflight, BalanceConsistentHash:
+	default:
+		return nil, jerr.WithMsgF(`invalid balancing strategy "%s"`, option.Strategy)
+	}
+	if option.HashKey == nil {
+		option.HashKey = func(r *http.Request) string {
+			return r.URL.Path
+		}
+	}
+	if option.MaxFails == 0 {
+		option.MaxFails = balancerDefaultMaxFails
+	}
+	if option.EjectDuration == 0 {
+		option.EjectDuration = balancerDefaultEjectDuration
+	}
+	if option.HealthCheckInterval == 0 {
+		option.HealthCheckInterval = balancerDefaultHealthCheckInterval
+	}
+	if option.HealthCheckTimeout == 0 {
+		option.HealthCheckTimeout = balancerDefaultHealthCheckTimeout
+	}
+	b := &Balancer{
+		option:  option,
+		counter: jatomic.NewUint64(),
+		closed:  make(chan struct{}),
+	}
+	for _, endpoint := range option.Endpoints {
+		u, err := url.Parse(strings.TrimRight(endpoint.URL, "/"))
+		if err != nil {
+			return nil, jerr.WithMsgErrF(err, `invalid endpoint URL "%s"`, endpoint.URL)
+		}
+		if u.Scheme == "" || u.Host == "" {
+			return nil, jerr.WithMsgF(`invalid endpoint URL "%s", scheme and host are required`, endpoint.URL)
+		}
+		weight := endpoint.Weight
+		if weight <= 0 {
+			weight = 1
+		}
+		b.endpoints = append(b.endpoints, &balancerEndpoint{
+			url:          u,
+			weight:       weight,
+			inflight:     jatomic.NewInt64(),
+			fails:        jatomic.NewInt64(),
+			ejectedUntil: jatomic.NewInt64(),
+			healthy:      jatomic.NewBool(true),
+		})
+	}
+	if option.Strategy == BalanceConsistentHash {
+		for _, endpoint := range b.endpoints {
+			for i := 0; i < endpoint.weight*balancerHashReplicas; i++ {
+				b.ring = append(b.ring, balancerNode{
+					hash:     jcrc32.Enc(endpoint.url.String() + "#" + strconv.Itoa(i)),
+					endpoint: endpoint,
+				})
+			}
+		}
+		sort.Slice(b.ring, func(i, j int) bool {
+			return b.ring[i].hash < b.ring[j].hash
+		})
+	}
+	if option.HealthCheckPath != "" {
+		go b.healthCheckLoop()
+	}
+	return b, nil
+}
+
+// Close stops the active health checks of the balancer.
+func (b *Balancer) Close() {
+	b.closeOnce.Do(func() {
+		close(b.closed)
+	})
+}
+
+// route picks an endpoint for the request and returns a copy of the request targeting it.
+// The scheme, host and base path of the request URL are replaced with the endpoint's,
+// and the endpoint is stored in the context of the returned request for send.
+func (b *Balancer) route(r *http.Request) *http.Request {
+	endpoint := b.pick(r)
+	req := r.Clone(context.WithValue(r.Context(), clientBalancerEndpointKey, endpoint))
+	req.URL.Scheme = endpoint.url.Scheme
+	req.URL.Host = endpoint.url.Host
+	req.URL.Path = endpoint.url.Path + r.URL.Path
+	if r.URL.RawPath != "" {
+		req.URL.RawPath = endpoint.url.EscapedPath() + r.URL.RawPath
+	}
+	// Custom host from header Host is kept.
+	if r.Header.Get(httpHeaderHost) == "" {
+		req.Host = ""
+	}
+	return req
+}
+
+// send sends the request routed by route and reports the result to its endpoint.
+// The request is sent as it is if it's not routed.
+func (b *Balancer) send(c *Client, r *http.Request) (*http.Response, error) {
+	endpoint, _ := r.Context().Value(clientBalancerEndpointKey).(*balancerEndpoint)
+	if endpoint == nil {
+		return c.Do(r)
+	}
+	endpoint.inflight.Add(1)
+	resp, err := c.Do(r)
+	endpoint.inflight.Add(-1)
+	b.report(endpoint, resp, err)
+	return resp, err
+}
+
+// available returns the endpoints that are neither ejected nor unhealthy.
+// It returns all endpoints if none is available, as it is better than failing all requests.
+func (b *Balancer) available() []*balancerEndpoint {
+	var (
+		now       = time.Now().UnixNano()
+		endpoints = make([]*balancerEndpoint, 0, len(b.endpoints))
+	)
+	for _, endpoint := range b.endpoints {
+		if endpoint.isAvailable(now) {
+			endpoints = append(endpoints, endpoint)
+		}
+	}
+	if len(endpoints) == 0 {
+		return b.endpoints
+	}
+	return endpoints
+}
+
+// pick picks an endpoint for the request using the configured strategy.
+func (b *Balancer) pick(r *http.Request) *balancerEndpoint {
+	switch b.option.Strategy {
+	case BalanceWeighted:
+		return b.pickWeighted()
+	case BalanceLeastInflight:
+		return b.pickLeastInflight()
+	case BalanceConsistentHash:
+		return b.pickConsistentHash(r)
+	default:
+		endpoints := b.available()
+		return endpoints[(b.counter.Add(1)-1)%uint64(len(endpoints))]
+	}
+}
+
+// pickWeighted picks an endpoint using smooth weighted round-robin.
+func (b *Balancer) pickWeighted() *balancerEndpoint {
+	var (
+		endpoints   = b.available()
+		totalWeight int
+		picked      *balancerEndpoint
+	)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, endpoint := range endpoints {
+		endpoint.currentWeight += endpoint.weight
+		totalWeight += endpoint.weight
+		if picked == nil || endpoint.currentWeight > picked.currentWeight {
+			picked = endpoint
+		}
+	}
+	picked.currentWeight -= totalWeight
+	return picked
+}
+
+// pickLeastInflight picks the endpoint with the least in-flight requests,
+// the ties are broken in turn.
+func (b *Balancer) pickLeastInflight() *balancerEndpoint {
+	var (
+		endpoints = b.available()
+		offset    = int((b.counter.Add(1) - 1) % uint64(len(endpoints)))
+		picked    *balancerEndpoint
+	)
+	for i := range endpoints {
+		endpoint := endpoints[(offset+i)%len(endpoints)]
+		if picked == nil || endpoint.inflight.Load() < picked.inflight.Load() {
+			picked = endpoint
+		}
+	}
+	return picked
+}
+
+// pickConsistentHash picks the endpoint by the hash of the request key on the ring,
+// in which the unavailable endpoints are skipped clockwise.
+func (b *Balancer) pickConsistentHash(r *http.Request) *balancerEndpoint {
+	var (
+		now   = time.Now().UnixNano()
+		hash  = jcrc32.Enc(b.option.HashKey(r))
+		index = sort.Search(len(b.ring), func(i int) bool {
+			return b.ring[i].hash >= hash
+		})
+	)
+	for i := 0; i < len(b.ring); i++ {
+		node := b.ring[(index+i)%len(b.ring)]
+		if node.endpoint.isAvailable(now) {
+			return node.endpoint
+		}
+	}
+	return b.ring[index%len(b.ring)].endpoint
+}
+
+// report records the result of the request, the endpoint is ejected for EjectDuration
+// if it fails MaxFails times consecutively.
+func (b *Balancer) report(endpoint *balancerEndpoint, resp *http.Response, err error) {
+	if err == nil && resp != nil && resp.StatusCode < http.StatusInternalServerError {
+		endpoint.fails.Store(0)
+		return
+	}
+	if endpoint.fails.Add(1) >= int64(b.option.MaxFails) {
+		endpoint.fails.Store(0)
+		endpoint.ejectedUntil.Store(time.Now().Add(b.option.EjectDuration).UnixNano())
+		intlog.Printf(`endpoint "%s" ejected for %s`, endpoint.url, b.option.EjectDuration)
+	}
+}
+
+// healthCheckLoop checks the health of all endpoints periodically until the balancer is closed.
+func (b *Balancer) healthCheckLoop() {
+	var (
+		client = New().Timeout(b.option.HealthCheckTimeout)
+		ticker = time.NewTicker(b.option.HealthCheckInterval)
+	)
+	defer ticker.Stop()
+	for {
+		for _, endpoint := range b.endpoints {
+			b.healthCheck(client, endpoint)
+		}
+		select {
+		case <-b.closed:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// healthCheck requests the health check path of the endpoint and updates its health state.
+func (b *Balancer) healthCheck(client *Client, endpoint *balancerEndpoint) {
+	resp, err := client.Get(context.Background(), endpoint.url.String()+b.option.HealthCheckPath)
+	healthy := err == nil && resp.StatusCode < http.StatusBadRequest
+	if resp != nil {
+		if closeErr := resp.Close(); closeErr != nil {
+			intlog.Errorf(`%+v`, closeErr)
+		}
+	}
+	if endpoint.healthy.Store(healthy) != healthy {
+		intlog.Printf(`endpoint "%s" health changed to %t`, endpoint.url, healthy)
+		// An endpoint recovered from active health check is no longer ejected.
+		if healthy {
+			endpoint.ejectedUntil.Store(0)
+		}
+	}
+}
+
+// isAvailable checks whether the endpoint is healthy and not ejected at `now`.
+func (e *balancerEndpoint) isAvailable(now int64) bool {
+	return e.healthy.Load() && e.ejectedUntil.Load() < now
+}
@@ -0,0 +1,429 @@
+package jclient
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/e7coding/coding-common/errs/jerr"
+	"github.com/e7coding/coding-common/internal/intlog"
+	"github.com/e7coding/coding-common/internal/json"
+	"github.com/e7coding/coding-common/internal/utils"
+	"github.com/e7coding/coding-common/os/jcache"
+)
+
+const (
+	httpHeaderAge               = `Age`
+	httpHeaderDate              = `Date`
+	httpHeaderETag              = `ETag`
+	httpHeaderVary              = `Vary`
+	httpHeaderExpires           = `Expires`
+	httpHeaderWarning           = `Warning`
+	httpHeaderCacheControl      = `Cache-Control`
+	httpHeaderLastModified      = `Last-Modified`
+	httpHeaderIfNoneMatch       = `If-None-Match`
+	httpHeaderIfModifiedSince   = `If-Modified-Since`
+	httpHeaderXCache            = `X-Cache`
+	cacheDirectiveNoStore       = `no-store`
+	cacheDirectiveNoCache       = `no-cache`
+	cacheDirectiveMaxAge        = `max-age`
+	cacheDirectiveMustRevalid   = `must-revalidate`
+	cacheDirectiveStaleIfError  = `stale-if-error`
+	cacheStatusHit              = `HIT`
+	cacheStatusMiss             = `MISS`
+	cacheStatusRevalidated      = `REVALIDATED`
+	cacheStatusStale            = `STALE`
+	cacheWarningRevalidFailed   = `111 - "Revalidation Failed"`
+	cacheDefaultKeyPrefix       = `jclient.cache.`
+	cacheDefaultStaleTTL        = 24 * time.Hour
+	cacheHeuristicFreshnessRate = 10 // Heuristic freshness is 10% of the time since Last-Modified.
+)
+
+// CacheOption is the option for response caching middleware.
+type CacheOption struct {
+	// Adapter is the storage of cached responses.
+	// It uses an in-memory adapter in default.
+	Adapter jcache.Adapter
+
+	// KeyPrefix is the prefix of the cache keys, which is useful if the Adapter is shared.
+	KeyPrefix string
+
+	// DefaultTTL is the freshness lifetime for responses that have neither explicit expiration
+	// nor Last-Modified header. Such responses are not cached if it is 0.
+	DefaultTTL time.Duration
+
+	// StaleTTL is how long an expired response is kept for revalidation and stale serving.
+	// It is 24 hours in default.
+	StaleTTL time.Duration
+
+	// StaleIfError enables serving stale responses when upstream fails or responds 5xx.
+	StaleIfError bool
+
+	// MaxBodySize limits the size of cacheable response body in bytes, 0 means no limit.
+	MaxBodySize int64
+}
+
+// cacheEntry is the cached response stored in the adapter.
+type cacheEntry struct {
+	StatusCode   int         `json:"statusCode"`
+	Proto        string      `json:"proto"`
+	Header       http.Header `json:"header"`
+	Body         []byte      `json:"body"`
+	VaryHeader   http.Header `json:"varyHeader"`   // Request header values selected by Vary.
+	ResponseTime time.Time   `json:"responseTime"` // Time when the response was received or revalidated.
+	Lifetime     int64       `json:"lifetime"`     // Freshness lifetime in nanoseconds.
+	StaleIfError int64       `json:"staleIfError"` // Stale-if-error window in nanoseconds, -1 for option default.
+}
+
+// cacheControl is the parsed Cache-Control header.
+type cacheControl map[string]string
+
+// MiddlewareCache returns a client middleware that caches responses following RFC 7234.
+//
+// Only GET and HEAD requests are cached. It handles the `max-age`, `no-store`, `no-cache`
+// and `must-revalidate` directives and the `Vary` header. Expired responses having
+// validators are revalidated using `If-None-Match` and `If-Modified-Since`.
+// The header `X-Cache` of the response indicates how the response is served.
+//
+// Eg:
+// client.Use(jclient.MiddlewareCache(jclient.CacheOption{Adapter: jcache.NewAdapterRedis(redis)}))
+func MiddlewareCache(option ...CacheOption) HandlerFunc {
+	var cacheOption CacheOption
+	if len(option) > 0 {
+		cacheOption = option[0]
+	}
+	if cacheOption.Adapter == nil {
+		cacheOption.Adapter = jcache.NewAdapterMemory()
+	}
+	if cacheOption.KeyPrefix == "" {
+		cacheOption.KeyPrefix = cacheDefaultKeyPrefix
+	}
+	if cacheOption.StaleTTL == 0 {
+		cacheOption.StaleTTL = cacheDefaultStaleTTL
+	}
+	return func(c *Client, r *http.Request) (*Response, error) {
+		return cacheOption.handle(c, r)
+	}
+}
+
+// handle serves the request from cache if possible, or else it sends the request
+// and stores the response.
+func (o CacheOption) handle(c *Client, r *http.Request) (*Response, error) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return c.Next(r)
+	}
+	var (
+		reqCacheControl = parseCacheControl(r.Header)
+		cacheKey        = o.KeyPrefix + r.Method + " " + r.URL.String()
+	)
+	if reqCacheControl.has(cacheDirectiveNoStore) {
+		return c.Next(r)
+	}
+	entry := o.load(cacheKey)
+	if entry != nil && !entry.matchVary(r) {
+		entry = nil
+	}
+	if entry == nil {
+		resp, err := c.Next(r)
+		if err == nil {
+			o.store(cacheKey, r, resp)
+			setCacheStatus(resp, cacheStatusMiss)
+		}
+		return resp, err
+	}
+
+	// Fresh response can be served directly.
+	if entry.isFresh(reqCacheControl) {
+		return entry.toResponse(r, cacheStatusHit), nil
+	}
+
+	// Revalidation with validators.
+	revalidateReq := r.Clone(r.Context())
+	if etag := entry.Header.Get(httpHeaderETag); etag != "" {
+		revalidateReq.Header.Set(httpHeaderIfNoneMatch, etag)
+	}
+	if lastModified := entry.Header.Get(httpHeaderLastModified); lastModified != "" {
+		revalidateReq.Header.Set(httpHeaderIfModifiedSince, lastModified)
+	}
+	resp, err := c.Next(revalidateReq)
+	if err != nil || resp == nil || resp.Response == nil || resp.StatusCode >= http.StatusInternalServerError {
+		if o.canServeStale(entry) {
+			if resp != nil {
+				_ = resp.Close()
+			}
+			intlog.Printf(`serve stale response for "%s": %+v`, cacheKey, err)
+			staleResp := entry.toResponse(r, cacheStatusStale)
+			staleResp.Header.Add(httpHeaderWarning, cacheWarningRevalidFailed)
+			return staleResp, nil
+		}
+		return resp, err
+	}
+	if resp.StatusCode == http.StatusNotModified {
+		_ = resp.Close()
+		entry.refresh(resp.Response, o.DefaultTTL)
+		o.save(cacheKey, entry)
+		return entry.toResponse(r, cacheStatusRevalidated), nil
+	}
+	o.store(cacheKey, r, resp)
+	setCacheStatus(resp, cacheStatusMiss)
+	return resp, nil
+}
+
+// load retrieves and decodes the cache entry of `key`, it returns nil if not found.
+func (o CacheOption) load(key string) *cacheEntry {
+	v, err := o.Adapter.Get(key)
+	if err != nil {
+		intlog.Errorf(`%+v`, err)
+		return nil
+	}
+	if v == nil || v.IsNil() {
+		return nil
+	}
+	var entry *cacheEntry
+	if err = json.Unmarshal(v.Bytes(), &entry); err != nil {
+		intlog.Errorf(`%+v`, jerr.WithMsgErrF(err, `invalid cached response for key "%s"`, key))
+		return nil
+	}
+	return entry
+}
+
+// save encodes and stores the cache entry with `key`.
+// The entry is kept in the adapter for StaleTTL after it expires, for revalidation purpose.
+func (o CacheOption) save(key string, entry *cacheEntry) {
+	content, err := json.Marshal(entry)
+	if err != nil {
+		intlog.Errorf(`%+v`, err)
+		return
+	}
+	if err = o.Adapter.Set(key, content, time.Duration(entry.Lifetime)+o.StaleTTL); err != nil {
+		intlog.Errorf(`%+v`, err)
+	}
+}
+
+// store stores the response `resp` of request `r` if it's cacheable.
+// It reads the response body and resets it for the caller to read again.
+func (o CacheOption) store(key string, r *http.Request, resp *Response) {
+	if resp == nil || resp.Response == nil || !isCacheableStatus(resp.StatusCode) {
+		return
+	}
+	var (
+		respCacheControl = parseCacheControl(resp.Header)
+		vary             = resp.Header.Values(httpHeaderVary)
+	)
+	if respCacheControl.has(cacheDirectiveNoStore) {
+		return
+	}
+	if o.MaxBodySize > 0 && resp.ContentLength > o.MaxBodySize {
+		return
+	}
+	entry := &cacheEntry{
+		StatusCode:   resp.StatusCode,
+		Proto:        resp.Proto,
+		Header:       resp.Header.Clone(),
+		VaryHeader:   make(http.Header),
+		ResponseTime: time.Now(),
+		Lifetime:     int64(freshnessLifetime(resp.Header, respCacheControl, o.DefaultTTL)),
+		StaleIfError: -1,
+	}
+	if entry.Lifetime <= 0 && !entry.hasValidator() {
+		return
+	}
+	for _, line := range vary {
+		for _, name := range strings.Split(line, ",") {
+			name = http.CanonicalHeaderKey(strings.TrimSpace(name))
+			if name == "*" {
+				return
+			}
+			if name != "" {
+				entry.VaryHeader[name] = r.Header.Values(name)
+			}
+		}
+	}
+	if seconds, ok := respCacheControl.seconds(cacheDirectiveStaleIfError); ok {
+		entry.StaleIfError = int64(seconds)
+	}
+	if respCacheControl.has(cacheDirectiveMustRevalid) || respCacheControl.has(cacheDirectiveNoCache) {
+		entry.StaleIfError = 0
+	}
+	entry.Body = resp.ReadAll()
+	resp.Body = utils.NewReadCloser(entry.Body, false)
+	if o.MaxBodySize > 0 && int64(len(entry.Body)) > o.MaxBodySize {
+		return
+	}
+	o.save(key, entry)
+}
+
+// canServeStale checks whether the stale `entry` can be served on upstream errors.
+func (o CacheOption) canServeStale(entry *cacheEntry) bool {
+	switch {
+	case entry.StaleIfError == 0:
+		return false
+	case entry.StaleIfError > 0:
+		return entry.staleness() <= time.Duration(entry.StaleIfError)
+	default:
+		return o.StaleIfError
+	}
+}
+
+// hasValidator checks whether the entry can be revalidated.
+func (e *cacheEntry) hasValidator() bool {
+	return e.Header.Get(httpHeaderETag) != "" || e.Header.Get(httpHeaderLastModified) != ""
+}
+
+// matchVary checks whether the request headers selected by Vary are the same as the cached ones.
+func (e *cacheEntry) matchVary(r *http.Request) bool {
+	for name, values := range e.VaryHeader {
+		if strings.Join(r.Header.Values(name), ",") != strings.Join(values, ",") {
+			return false
+		}
+	}
+	return true
+}
+
+// age returns the current age of the cached response.
+func (e *cacheEntry) age() time.Duration {
+	age := time.Since(e.ResponseTime)
+	if seconds, err := strconv.ParseInt(e.Header.Get(httpHeaderAge), 10, 64); err == nil && seconds > 0 {
+		age += time.Duration(seconds) * time.Second
+	}
+	return age
+}
+
+// staleness returns how long the cached response has been expired.
+func (e *cacheEntry) staleness() time.Duration {
+	return e.age() - time.Duration(e.Lifetime)
+}
+
+// isFresh checks whether the entry can be served without revalidation,
+// respecting the Cache-Control directives of the request.
+func (e *cacheEntry) isFresh(reqCacheControl cacheControl) bool {
+	if reqCacheControl.has(cacheDirectiveNoCache) {
+		return false
+	}
+	age := e.age()
+	if maxAge, ok := reqCacheControl.seconds(cacheDirectiveMaxAge); ok && age > maxAge {
+		return false
+	}
+	return age < time.Duration(e.Lifetime)
+}
+
+// refresh updates the entry with the headers of a 304 Not Modified response.
+func (e *cacheEntry) refresh(resp *http.Response, defaultTTL time.Duration) {
+	for name, values := range resp.Header {
+		e.Header[name] = values
+	}
+	e.Header.Del(httpHeaderAge)
+	e.ResponseTime = time.Now()
+	e.Lifetime = int64(freshnessLifetime(e.Header, parseCacheControl(e.Header), defaultTTL))
+}
+
+// toResponse creates and returns a Response from the entry for request `r`.
+func (e *cacheEntry) toResponse(r *http.Request, status string) *Response {
+	header := e.Header.Clone()
+	header.Set(httpHeaderAge, strconv.FormatInt(int64(e.age()/time.Second), 10))
+	resp := &Response{
+		Response: &http.Response{
+			Status:        strconv.Itoa(e.StatusCode) + " " + http.StatusText(e.StatusCode),
+			StatusCode:    e.StatusCode,
+			Proto:         e.Proto,
+			Header:        header,
+			Body:          utils.NewReadCloser(e.Body, false),
+			ContentLength: int64(len(e.Body)),
+			Request:       r,
+		},
+		request: r,
+	}
+	setCacheStatus(resp, status)
+	return resp
+}
+
+// setCacheStatus marks how the response is served using header X-Cache.
+func setCacheStatus(resp *Response, status string) {
+	if resp != nil && resp.Response != nil && resp.Header != nil {
+		resp.Header.Set(httpHeaderXCache, status)
+	}
+}
+
+// isCacheableStatus checks whether the status code is cacheable by default.
+func isCacheableStatus(statusCode int) bool {
+	switch statusCode {
+	case
+		http.StatusOK,
+		http.StatusNonAuthoritativeInfo,
+		http.StatusNoContent,
+		http.StatusMultipleChoices,
+		http.StatusMovedPermanently,
+		http.StatusNotFound,
+		http.StatusMethodNotAllowed,
+		http.StatusGone,
+		http.StatusRequestURITooLong,
+		http.StatusNotImplemented:
+		return true
+	}
+	return false
+}
+
+// freshnessLifetime calculates the freshness lifetime of the response by
+// max-age, Expires, heuristic from Last-Modified or the `defaultTTL` in order.
+func freshnessLifetime(header http.Header, cc cacheControl, defaultTTL time.Duration) time.Duration {
+	if cc.has(cacheDirectiveNoCache) {
+		return 0
+	}
+	if maxAge, ok := cc.seconds(cacheDirectiveMaxAge); ok {
+		return maxAge
+	}
+	date, err := http.ParseTime(header.Get(httpHeaderDate))
+	if err != nil {
+		date = time.Now()
+	}
+	if expiresStr := header.Get(httpHeaderExpires); expiresStr != "" {
+		// Invalid Expires value, especially "0", means already expired.
+		if expires, err := http.ParseTime(expiresStr); err == nil && expires.After(date) {
+			return expires.Sub(date)
+		}
+		return 0
+	}
+	if lastModified, err := http.ParseTime(header.Get(httpHeaderLastModified)); err == nil {
+		if lastModified.Before(date) {
+			return date.Sub(lastModified) / cacheHeuristicFreshnessRate
+		}
+		return 0
+	}
+	return defaultTTL
+}
+
+// parseCacheControl parses and returns the Cache-Control directives of the header.
+func parseCacheControl(header http.Header) cacheControl {
+	cc := make(cacheControl)
+	for _, line := range header.Values(httpHeaderCacheControl) {
+		for _, part := range strings.Split(line, ",") {
+			part = strings.TrimSpace(part)
+			if part == "" {
+				continue
+			}
+			name, value, _ := strings.Cut(part, "=")
+			cc[strings.ToLower(strings.TrimSpace(name))] = strings.Trim(strings.TrimSpace(value), `"`)
+		}
+	}
+	return cc
+}
+
+// has checks whether the directive exists.
+func (cc cacheControl) has(directive string) bool {
+	_, ok := cc[directive]
+	return ok
+}
+
+// seconds returns the delta-seconds value of the directive as time.Duration.
+func (cc cacheControl) seconds(directive string) (time.Duration, bool) {
+	value, ok := cc[directive]
+	if !ok {
+		return 0, false
+	}
+	seconds, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || seconds < 0 {
+		return 0, false
+	}
+	return time.Duration(seconds) * time.Second, true
+}
@@ -98,6 +98,30 @@ func (c *Client) Retry(retryCount int, retryInterval time.Duration) *Client {
 	return newClient
 }
 
+// Metrics is a chaining function,
+// which enables or disables metrics recording for next request.
+func (c *Client) Metrics(enabled bool) *Client {
+	newClient := c.Clone()
+	newClient.SetMetrics(enabled)
+	return newClient
+}
+
+// Balancer is a chaining function,
+// which sets the load balancer for next request.
+func (c *Client) Balancer(balancer *Balancer) *Client {
+	newClient := c.Clone()
+	newClient.SetBalancer(balancer)
+	return newClient
+}
+
+// Compress is a chaining function,
+// which sets the content encoding for compressing request body for next request.
+func (c *Client) Compress(encoding string) *Client {
+	newClient := c.Clone()
+	newClient.SetCompress(encoding)
+	return newClient
+}
+
 // Proxy is a chaining function,
 // which sets proxy for next request.
 // Make sure you pass the correct `proxyURL`.
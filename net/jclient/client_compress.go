@@ -0,0 +1,153 @@
+package jclient
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/e7coding/coding-common/encoding/jcompress"
+	"github.com/e7coding/coding-common/errs/jerr"
+	"github.com/e7coding/coding-common/internal/utils"
+)
+
+// Content encodings for request body compression.
+const (
+	CompressGzip    = `gzip`    // Gzip format, refer to RFC 1952.
+	CompressDeflate = `deflate` // Zlib format, refer to RFC 1950, which is named "deflate" in HTTP.
+)
+
+const (
+	contentEncodingZlib = `zlib` // Non-standard but used by some servers for the zlib format.
+	zlibMinCompressSize = 13     // Data shorter than it is returned as it is by jcompress.CompressZlib.
+)
+
+// compressRequestBody compresses the request body using the encoding of the client,
+// if the body size reaches the threshold and the body is not encoded yet.
+// It is called before the middleware, so that the middleware like request signing, HAR recording
+// and dumping see the body that is sent.
+func (c *Client) compressRequestBody(req *http.Request) error {
+	if c.compressEncoding == "" || req.Body == nil || req.Body == http.NoBody {
+		return nil
+	}
+	if req.Header.Get(httpHeaderContentEncoding) != "" {
+		return nil
+	}
+	body, err := readRequestBody(req)
+	if err != nil {
+		return err
+	}
+	if len(body) == 0 || len(body) < c.compressThreshold {
+		return nil
+	}
+	var compressed []byte
+	switch c.compressEncoding {
+	case CompressGzip:
+		compressed, err = jcompress.Gzip(body)
+	case CompressDeflate:
+		if len(body) < zlibMinCompressSize {
+			return nil
+		}
+		compressed, err = jcompress.CompressZlib(body)
+	default:
+		return jerr.WithMsgF(`unsupported compress encoding "%s"`, c.compressEncoding)
+	}
+	if err != nil {
+		return jerr.WithMsgErrF(err, `compress request body using "%s" failed`, c.compressEncoding)
+	}
+	req.Header.Set(httpHeaderContentEncoding, c.compressEncoding)
+	req.ContentLength = int64(len(compressed))
+	req.Body = utils.NewReadCloser(compressed, false)
+	req.GetBody = func() (io.ReadCloser, error) {
+		return utils.NewReadCloser(compressed, false), nil
+	}
+	return nil
+}
+
+// decompressResponseBody replaces the response body with a decompressing reader if the response
+// is encoded using gzip, deflate or zlib, which is the case that the transport does not decompress
+// automatically, eg: header Accept-Encoding is set by user.
+func decompressResponseBody(resp *http.Response) {
+	if resp == nil || resp.Body == nil || resp.Uncompressed {
+		return
+	}
+	encoding := strings.ToLower(strings.TrimSpace(resp.Header.Get(httpHeaderContentEncoding)))
+	switch encoding {
+	case CompressGzip, CompressDeflate, contentEncodingZlib:
+	default:
+		return
+	}
+	resp.Body = &decompressReadCloser{
+		body:     resp.Body,
+		encoding: encoding,
+	}
+	resp.Header.Del(httpHeaderContentEncoding)
+	resp.Header.Del(httpHeaderContentLength)
+	resp.ContentLength = -1
+	resp.Uncompressed = true
+}
+
+// decompressReadCloser decompresses the body in streaming, so that the streaming responses like
+// Server-Sent Events work and the decompressed content is never held in memory as a whole.
+// The decompressing reader is created on the first read, so that the body is not read if it is
+// never used.
+type decompressReadCloser struct {
+	body     io.ReadCloser
+	encoding string
+	reader   io.ReadCloser // Reader of the decompressed content, which is nil before the first read.
+	err      error         // Error of creating the decompressing reader.
+}
+
+// Read implements interface io.Reader.
+func (d *decompressReadCloser) Read(p []byte) (int, error) {
+	if d.reader == nil && d.err == nil {
+		d.reader, d.err = d.newReader()
+	}
+	if d.err != nil {
+		return 0, d.err
+	}
+	n, err := d.reader.Read(p)
+	if err != nil && err != io.EOF {
+		err = jerr.WithMsgErrF(err, `decompress response body using "%s" failed`, d.encoding)
+	}
+	return n, err
+}
+
+// Close implements interface io.Closer.
+func (d *decompressReadCloser) Close() error {
+	if d.reader != nil {
+		_ = d.reader.Close()
+	}
+	return d.body.Close()
+}
+
+// newReader creates and returns the decompressing reader of the body.
+// It returns io.EOF if the body is empty, eg: response of HEAD request.
+func (d *decompressReadCloser) newReader() (io.ReadCloser, error) {
+	buffered := bufio.NewReader(d.body)
+	header, err := buffered.Peek(2)
+	if len(header) == 0 {
+		if err == nil {
+			err = io.EOF
+		}
+		return nil, err
+	}
+	var reader io.ReadCloser
+	switch {
+	case d.encoding == CompressGzip:
+		reader, err = gzip.NewReader(buffered)
+	// The zlib header: the compression method is 8 and the header checksum is a multiple of 31.
+	// Some servers send raw deflate data for encoding "deflate", which has no zlib header.
+	case len(header) == 2 && header[0]&0x0F == 8 && (uint16(header[0])<<8|uint16(header[1]))%31 == 0:
+		reader, err = zlib.NewReader(buffered)
+	default:
+		reader = flate.NewReader(buffered)
+	}
+	if err != nil {
+		return nil, jerr.WithMsgErrF(err, `decompress response body using "%s" failed`, d.encoding)
+	}
+	return reader, nil
+}
@@ -113,6 +113,43 @@ func (c *Client) SetRetry(retryCount int, retryInterval time.Duration) *Client {
 	return c
 }
 
+// SetMetrics enables or disables metrics recording of the client.
+// When enabled, the client records the durations of DNS lookup, connecting, TLS handshake,
+// the first response byte and the whole request, along with the request/response sizes,
+// status codes and connection reuse, labelled by host and method.
+// The metrics are recorded using the global meter provider of OpenTelemetry,
+// which can be configured using otel.SetMeterProvider.
+func (c *Client) SetMetrics(enabled bool) *Client {
+	c.metricsEnabled = enabled
+	return c
+}
+
+// SetBalancer sets the load balancer of the client, which distributes the requests over its endpoints.
+// The scheme and host of the request URL are replaced with the picked endpoint's, and the path of
+// the endpoint URL is prepended to the request path, so the request URL can be a path only, eg: /user/list.
+// The endpoint is picked before the middleware, so that the middleware like request signing sees
+// the URL that is requested, and the retries of the request are sent to the same endpoint.
+func (c *Client) SetBalancer(balancer *Balancer) *Client {
+	c.balancer = balancer
+	return c
+}
+
+// SetCompress sets the content encoding for compressing request body, which is CompressGzip
+// or CompressDeflate, and empty `encoding` disables compression.
+// The header Content-Encoding is set along with the compressed body. The body is not compressed
+// if it's smaller than the threshold set by SetCompressThreshold, or it's already encoded.
+func (c *Client) SetCompress(encoding string) *Client {
+	c.compressEncoding = encoding
+	return c
+}
+
+// SetCompressThreshold sets the min size in bytes of request body to be compressed,
+// which is 0 in default that compresses any non-empty body.
+func (c *Client) SetCompressThreshold(size int) *Client {
+	c.compressThreshold = size
+	return c
+}
+
 // SetRedirectLimit limits the number of jumps.
 func (c *Client) SetRedirectLimit(redirectLimit int) *Client {
 	c.CheckRedirect = func(req *http.Request, via []*http.Request) error {
@@ -0,0 +1,106 @@
+package jclient
+
+import (
+	"bytes"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/e7coding/coding-common/internal/intlog"
+)
+
+const (
+	httpHeaderContentTypeMultipart = `multipart/form-data`
+	curlLineSeparator              = " \\\n  "
+)
+
+// Curl returns the request as a copy-pasteable curl command, including the method, headers,
+// cookies and body. The multipart form of file uploading is rendered using curl option "-F",
+// in which the files are referred by their base names, as the original paths are not kept.
+func (r *Response) Curl() string {
+	if r == nil || r.request == nil {
+		return ""
+	}
+	var (
+		req   = r.request
+		parts = []string{`curl`}
+	)
+	if req.Method != http.MethodGet {
+		parts = append(parts, `-X `+req.Method)
+	}
+	parts = append(parts, shellQuote(req.URL.String()))
+	if req.Host != "" && req.Host != req.URL.Host {
+		parts = append(parts, `-H `+shellQuote(httpHeaderHost+`: `+req.Host))
+	}
+	var (
+		formParts = curlFormParts(req.Header.Get(httpHeaderContentType), r.requestBody)
+		keys      = make([]string, 0, len(req.Header))
+	)
+	for k := range req.Header {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		// The multipart content type is generated by curl along with its boundary.
+		if formParts != nil && k == httpHeaderContentType {
+			continue
+		}
+		for _, v := range req.Header[k] {
+			if k == httpHeaderCookie {
+				parts = append(parts, `-b `+shellQuote(v))
+				continue
+			}
+			parts = append(parts, `-H `+shellQuote(k+`: `+v))
+		}
+	}
+	switch {
+	case formParts != nil:
+		parts = append(parts, formParts...)
+	case len(r.requestBody) > 0:
+		parts = append(parts, `--data-binary `+shellQuote(string(r.requestBody)))
+	}
+	return strings.Join(parts, curlLineSeparator)
+}
+
+// curlFormParts parses the multipart body and returns the curl "-F" options,
+// it returns nil if the body is not a multipart form.
+func curlFormParts(contentType string, body []byte) []string {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil || mediaType != httpHeaderContentTypeMultipart || params["boundary"] == "" {
+		return nil
+	}
+	var (
+		reader = multipart.NewReader(bytes.NewReader(body), params["boundary"])
+		parts  = make([]string, 0)
+	)
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			intlog.Errorf(`%+v`, err)
+			return nil
+		}
+		if fileName := part.FileName(); fileName != "" {
+			parts = append(parts, `-F `+shellQuote(part.FormName()+`=@`+fileName))
+			continue
+		}
+		value, err := io.ReadAll(part)
+		if err != nil {
+			intlog.Errorf(`%+v`, err)
+			return nil
+		}
+		// Option "--form-string" sends the value literally, as "-F" treats leading "@" and "<" specially.
+		parts = append(parts, `--form-string `+shellQuote(part.FormName()+`=`+string(value)))
+	}
+	return parts
+}
+
+// shellQuote quotes `s` using single quotes for POSIX shells.
+func shellQuote(s string) string {
+	return `'` + strings.ReplaceAll(s, `'`, `'\''`) + `'`
+}
@@ -13,7 +13,10 @@ import (
 	"net/http/httputil"
 
 	"github.com/e7coding/coding-common/internal/intlog"
+	"github.com/e7coding/coding-common/internal/json"
 	"github.com/e7coding/coding-common/internal/utils"
+	"github.com/e7coding/coding-common/net/jtrace"
+	"github.com/e7coding/coding-common/text/jstr"
 )
 
 // dumpTextFormat is the format of the dumped raw string
@@ -83,3 +86,117 @@ func (r *Response) Raw() string {
 func (r *Response) RawDump() {
 	fmt.Println(r.Raw())
 }
+
+// DumpOption is the option for Response.DumpJSON.
+type DumpOption struct {
+	// RedactHeaders are the headers whose values are replaced with "[REDACTED]",
+	// they are Authorization, Proxy-Authorization, Cookie and Set-Cookie in default.
+	RedactHeaders []string
+
+	// MaxBodySize is the max size in characters of the dumped bodies, the exceeding part is cut
+	// and replaced with "...". It is jtrace.MaxContentLogSize() in default, and negative value
+	// omits the bodies.
+	MaxBodySize int
+}
+
+// dumpJSON is the structured dump of the request and the response.
+type dumpJSON struct {
+	Request  *dumpJSONMessage `json:"request,omitempty"`
+	Response *dumpJSONMessage `json:"response,omitempty"`
+}
+
+// dumpJSONMessage is the structured dump of a request or a response.
+type dumpJSONMessage struct {
+	Method        string              `json:"method,omitempty"`
+	URL           string              `json:"url,omitempty"`
+	Status        string              `json:"status,omitempty"`
+	StatusCode    int                 `json:"statusCode,omitempty"`
+	Proto         string              `json:"proto"`
+	Header        map[string][]string `json:"header"`
+	Body          string              `json:"body,omitempty"`
+	BodySize      int                 `json:"bodySize"`
+	BodyTruncated bool                `json:"bodyTruncated,omitempty"`
+}
+
+// dumpRedactedValue is the replacement of the redacted header values.
+const dumpRedactedValue = `[REDACTED]`
+
+// defaultDumpRedactHeaders are the headers redacted in default.
+var defaultDumpRedactHeaders = []string{
+	httpHeaderAuthorization, `Proxy-Authorization`, httpHeaderCookie, `Set-Cookie`,
+}
+
+// DumpJSON returns the structured JSON dump of the request and the response for logging,
+// in which the sensitive headers are redacted and the bodies are truncated according to `option`.
+func (r *Response) DumpJSON(option ...DumpOption) string {
+	if r == nil {
+		return "{}"
+	}
+	var opt DumpOption
+	if len(option) > 0 {
+		opt = option[0]
+	}
+	if opt.RedactHeaders == nil {
+		opt.RedactHeaders = defaultDumpRedactHeaders
+	}
+	if opt.MaxBodySize == 0 {
+		opt.MaxBodySize = jtrace.MaxContentLogSize()
+	}
+	var dump dumpJSON
+	if r.request != nil {
+		dump.Request = &dumpJSONMessage{
+			Method: r.request.Method,
+			URL:    r.request.URL.String(),
+			Proto:  r.request.Proto,
+			Header: redactHeader(r.request.Header, opt.RedactHeaders),
+		}
+		dump.Request.setBody(r.requestBody, opt.MaxBodySize)
+	}
+	if r.Response != nil {
+		dump.Response = &dumpJSONMessage{
+			Status:     r.Status,
+			StatusCode: r.StatusCode,
+			Proto:      r.Proto,
+			Header:     redactHeader(r.Header, opt.RedactHeaders),
+		}
+		dump.Response.setBody([]byte(getResponseBody(r.Response)), opt.MaxBodySize)
+	}
+	content, err := json.Marshal(dump)
+	if err != nil {
+		intlog.Errorf(`%+v`, err)
+		return "{}"
+	}
+	return string(content)
+}
+
+// setBody sets the body of the message, which is truncated to `maxSize` characters.
+func (m *dumpJSONMessage) setBody(body []byte, maxSize int) {
+	m.BodySize = len(body)
+	if maxSize < 0 {
+		return
+	}
+	m.Body = string(body)
+	if jstr.LenRune(m.Body) > maxSize {
+		m.Body = jstr.StrLimitRune(m.Body, maxSize, "...")
+		m.BodyTruncated = true
+	}
+}
+
+// redactHeader returns a copy of `header` with the values of `redactHeaders` redacted.
+func redactHeader(header http.Header, redactHeaders []string) map[string][]string {
+	result := make(map[string][]string, len(header))
+	for k, values := range header {
+		result[k] = values
+	}
+	for _, name := range redactHeaders {
+		name = http.CanonicalHeaderKey(name)
+		if values, ok := result[name]; ok {
+			redacted := make([]string, len(values))
+			for i := range redacted {
+				redacted[i] = dumpRedactedValue
+			}
+			result[name] = redacted
+		}
+	}
+	return result
+}
@@ -0,0 +1,430 @@
+package jclient
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/e7coding/coding-common"
+	"github.com/e7coding/coding-common/errs/jerr"
+	"github.com/e7coding/coding-common/internal/intlog"
+	"github.com/e7coding/coding-common/internal/json"
+	"github.com/e7coding/coding-common/internal/utils"
+	"github.com/e7coding/coding-common/os/jfile"
+)
+
+const (
+	httpHeaderContentLength   = `Content-Length`
+	httpHeaderContentEncoding = `Content-Encoding`
+	httpHeaderLocation        = `Location`
+	harVersion                = `1.2`
+	harCreatorName            = `jclient`
+	harEncodingBase64         = `base64`
+	harTimeFormat             = `2006-01-02T15:04:05.000Z07:00`
+)
+
+// HAR is the root of HTTP Archive 1.2 document.
+type HAR struct {
+	Log HARLog `json:"log"`
+}
+
+// HARLog is the log of HTTP Archive.
+type HARLog struct {
+	Version string      `json:"version"`
+	Creator HARCreator  `json:"creator"`
+	Entries []*HAREntry `json:"entries"`
+}
+
+// HARCreator is the creator application of HTTP Archive.
+type HARCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// HAREntry is an HTTP exchange of HTTP Archive.
+type HAREntry struct {
+	StartedDateTime string      `json:"startedDateTime"`
+	Time            float64     `json:"time"` // Total elapsed time of the exchange in milliseconds.
+	Request         HARRequest  `json:"request"`
+	Response        HARResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         HARTimings  `json:"timings"`
+}
+
+// HARRequest is the request of HTTP exchange.
+type HARRequest struct {
+	Method      string         `json:"method"`
+	URL         string         `json:"url"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []HARNameValue `json:"cookies"`
+	Headers     []HARNameValue `json:"headers"`
+	QueryString []HARNameValue `json:"queryString"`
+	PostData    *HARPostData   `json:"postData,omitempty"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+// HARResponse is the response of HTTP exchange.
+type HARResponse struct {
+	Status      int            `json:"status"`
+	StatusText  string         `json:"statusText"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []HARNameValue `json:"cookies"`
+	Headers     []HARNameValue `json:"headers"`
+	Content     HARContent     `json:"content"`
+	RedirectURL string         `json:"redirectURL"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+// HARNameValue is a name-value pair of header, cookie or query parameter.
+type HARNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// HARPostData is the request body.
+type HARPostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+	Encoding string `json:"encoding,omitempty"` // Non-standard but commonly used, "base64" for binary body.
+}
+
+// HARContent is the response body.
+type HARContent struct {
+	Size     int    `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+	Encoding string `json:"encoding,omitempty"` // It is "base64" for binary body.
+}
+
+// HARTimings is the timings of HTTP exchange in milliseconds, -1 means not available.
+type HARTimings struct {
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+}
+
+// HARRecorder records HTTP exchanges of the client into a HAR file.
+type HARRecorder struct {
+	path          string
+	mu            sync.Mutex
+	har           *HAR
+	redactHeaders []string // Headers whose values are redacted in the recorded entries.
+}
+
+// NewHARRecorder creates and returns a HARRecorder writing to file `path`.
+// The file is rewritten after each recorded exchange, so that it is always a valid HAR document.
+// The sensitive headers are redacted in default as the file is usually committed as fixture,
+// see SetRedactHeaders.
+//
+// Eg:
+//
+//	recorder := jclient.NewHARRecorder("testdata/api.har")
+//	client.Use(recorder.Middleware())
+func NewHARRecorder(path string) *HARRecorder {
+	return &HARRecorder{
+		path: path,
+		har: &HAR{Log: HARLog{
+			Version: harVersion,
+			Creator: HARCreator{Name: harCreatorName, Version: gf.VERSION},
+			Entries: make([]*HAREntry, 0),
+		}},
+		redactHeaders: defaultDumpRedactHeaders,
+	}
+}
+
+// SetRedactHeaders sets the headers whose values are replaced with "[REDACTED]" in the recorded
+// entries, which are Authorization, Proxy-Authorization, Cookie and Set-Cookie in default.
+// The cookie values are also redacted if Cookie or Set-Cookie is redacted.
+// Calling it without headers disables redaction.
+func (h *HARRecorder) SetRedactHeaders(headers ...string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.redactHeaders = headers
+}
+
+// Middleware returns a client middleware that records each exchange.
+// The exchanges failing without response are not recorded.
+func (h *HARRecorder) Middleware() HandlerFunc {
+	return func(c *Client, r *http.Request) (*Response, error) {
+		reqBody, err := readRequestBody(r)
+		if err != nil {
+			return nil, err
+		}
+		startTime := time.Now()
+		resp, err := c.Next(r)
+		if err != nil || resp == nil || resp.Response == nil {
+			return resp, err
+		}
+		respBody, err := io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		resp.Body = utils.NewReadCloser(respBody, false)
+		if err != nil {
+			return resp, jerr.WithMsgErr(err, `read response body failed`)
+		}
+		h.mu.Lock()
+		redactHeaders := h.redactHeaders
+		h.mu.Unlock()
+		entry := newHAREntry(r, reqBody, resp.Response, respBody, startTime, redactHeaders)
+		if err = h.record(entry); err != nil {
+			intlog.Errorf(`%+v`, err)
+		}
+		return resp, nil
+	}
+}
+
+// Entries returns a copy of the recorded entries.
+func (h *HARRecorder) Entries() []*HAREntry {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]*HAREntry(nil), h.har.Log.Entries...)
+}
+
+// record appends the entry and rewrites the HAR file.
+func (h *HARRecorder) record(entry *HAREntry) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.har.Log.Entries = append(h.har.Log.Entries, entry)
+	content, err := json.MarshalIndent(h.har, "", "  ")
+	if err != nil {
+		return jerr.WithMsgErr(err, `marshal HAR failed`)
+	}
+	if err = jfile.PutBytes(h.path, content); err != nil {
+		return jerr.WithMsgErrF(err, `write HAR file "%s" failed`, h.path)
+	}
+	return nil
+}
+
+// HARReplayer is an http.RoundTripper that serves the responses recorded in HAR file without
+// network access. The request is matched by method, URL and body. If there are multiple entries
+// matching the same request, they are served in the recorded order and the last one is repeated.
+//
+// Eg:
+//
+//	replayer, err := jclient.NewHARReplayer("testdata/api.har")
+//	client := jclient.New()
+//	client.Transport = replayer
+type HARReplayer struct {
+	mu      sync.Mutex
+	entries []*HAREntry
+	served  map[*HAREntry]bool
+}
+
+// NewHARReplayer creates and returns a HARReplayer with entries loaded from HAR file `path`.
+func NewHARReplayer(path string) (*HARReplayer, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, jerr.WithMsgErrF(err, `read HAR file "%s" failed`, path)
+	}
+	var har *HAR
+	if err = json.Unmarshal(content, &har); err != nil || har == nil {
+		return nil, jerr.WithMsgErrF(err, `invalid HAR file "%s"`, path)
+	}
+	return NewHARReplayerWithEntries(har.Log.Entries), nil
+}
+
+// NewHARReplayerWithEntries creates and returns a HARReplayer with given entries,
+// eg: the entries from HARRecorder.Entries.
+func NewHARReplayerWithEntries(entries []*HAREntry) *HARReplayer {
+	return &HARReplayer{
+		entries: entries,
+		served:  make(map[*HAREntry]bool),
+	}
+}
+
+// RoundTrip implements interface http.RoundTripper.
+// It returns error if there's no recorded entry matching the request.
+func (h *HARReplayer) RoundTrip(r *http.Request) (*http.Response, error) {
+	var body []byte
+	if r.Body != nil {
+		var err error
+		if body, err = io.ReadAll(r.Body); err != nil {
+			return nil, jerr.WithMsgErr(err, `read request body failed`)
+		}
+		_ = r.Body.Close()
+	}
+	entry := h.match(r.Method, r.URL.String(), body)
+	if entry == nil {
+		return nil, jerr.WithMsgF(`no HAR entry recorded for request %s %s`, r.Method, r.URL.String())
+	}
+	content, err := decodeHARText(entry.Response.Content.Text, entry.Response.Content.Encoding)
+	if err != nil {
+		return nil, err
+	}
+	resp := &http.Response{
+		Status:        strconv.Itoa(entry.Response.Status) + " " + entry.Response.StatusText,
+		StatusCode:    entry.Response.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        make(http.Header, len(entry.Response.Headers)),
+		Body:          io.NopCloser(bytes.NewReader(content)),
+		ContentLength: int64(len(content)),
+		Request:       r,
+	}
+	for _, header := range entry.Response.Headers {
+		resp.Header.Add(header.Name, header.Value)
+	}
+	// The recorded body is already decoded by the transport.
+	resp.Header.Del(httpHeaderContentLength)
+	resp.Header.Del(httpHeaderContentEncoding)
+	return resp, nil
+}
+
+// match returns the first unserved entry matching the request, or the last served one if all
+// matching entries are served.
+func (h *HARReplayer) match(method, url string, body []byte) *HAREntry {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var last *HAREntry
+	for _, entry := range h.entries {
+		if entry.Request.Method != method || entry.Request.URL != url {
+			continue
+		}
+		var entryBody []byte
+		if entry.Request.PostData != nil {
+			var err error
+			if entryBody, err = decodeHARText(entry.Request.PostData.Text, entry.Request.PostData.Encoding); err != nil {
+				intlog.Errorf(`%+v`, err)
+				continue
+			}
+		}
+		if !bytes.Equal(entryBody, body) {
+			continue
+		}
+		if !h.served[entry] {
+			h.served[entry] = true
+			return entry
+		}
+		last = entry
+	}
+	return last
+}
+
+// newHAREntry creates and returns a HAR entry of the exchange, in which the values of
+// `redactHeaders` are redacted.
+func newHAREntry(
+	r *http.Request, reqBody []byte, resp *http.Response, respBody []byte, startTime time.Time,
+	redactHeaders []string,
+) *HAREntry {
+	var (
+		elapsed = float64(time.Since(startTime).Microseconds()) / 1000
+		entry   = &HAREntry{
+			StartedDateTime: startTime.Format(harTimeFormat),
+			Time:            elapsed,
+			Request: HARRequest{
+				Method:      r.Method,
+				URL:         r.URL.String(),
+				HTTPVersion: r.Proto,
+				Cookies:     make([]HARNameValue, 0),
+				Headers:     harHeaders(redactHeader(r.Header, redactHeaders)),
+				QueryString: make([]HARNameValue, 0),
+				HeadersSize: -1,
+				BodySize:    len(reqBody),
+			},
+			Response: HARResponse{
+				Status:      resp.StatusCode,
+				StatusText:  http.StatusText(resp.StatusCode),
+				HTTPVersion: resp.Proto,
+				Cookies:     make([]HARNameValue, 0),
+				Headers:     harHeaders(redactHeader(resp.Header, redactHeaders)),
+				Content: HARContent{
+					Size:     len(respBody),
+					MimeType: resp.Header.Get(httpHeaderContentType),
+				},
+				RedirectURL: resp.Header.Get(httpHeaderLocation),
+				HeadersSize: -1,
+				BodySize:    len(respBody),
+			},
+			Timings: HARTimings{Send: 0, Wait: elapsed, Receive: 0},
+		}
+	)
+	if entry.Request.HTTPVersion == "" {
+		entry.Request.HTTPVersion = "HTTP/1.1"
+	}
+	var (
+		redactCookie    = isHeaderRedacted(httpHeaderCookie, redactHeaders)
+		redactSetCookie = isHeaderRedacted(`Set-Cookie`, redactHeaders)
+	)
+	for _, cookie := range r.Cookies() {
+		if redactCookie {
+			cookie.Value = dumpRedactedValue
+		}
+		entry.Request.Cookies = append(entry.Request.Cookies, HARNameValue{Name: cookie.Name, Value: cookie.Value})
+	}
+	for _, cookie := range resp.Cookies() {
+		if redactSetCookie {
+			cookie.Value = dumpRedactedValue
+		}
+		entry.Response.Cookies = append(entry.Response.Cookies, HARNameValue{Name: cookie.Name, Value: cookie.Value})
+	}
+	for k, values := range r.URL.Query() {
+		for _, v := range values {
+			entry.Request.QueryString = append(entry.Request.QueryString, HARNameValue{Name: k, Value: v})
+		}
+	}
+	if len(reqBody) > 0 {
+		entry.Request.PostData = &HARPostData{MimeType: r.Header.Get(httpHeaderContentType)}
+		entry.Request.PostData.Text, entry.Request.PostData.Encoding = encodeHARText(reqBody)
+	}
+	entry.Response.Content.Text, entry.Response.Content.Encoding = encodeHARText(respBody)
+	return entry
+}
+
+// harHeaders converts the header to HAR name-value pairs, which are sorted by name
+// for stable HAR files.
+func harHeaders(header map[string][]string) []HARNameValue {
+	var (
+		headers = make([]HARNameValue, 0, len(header))
+		keys    = make([]string, 0, len(header))
+	)
+	for k := range header {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		for _, v := range header[k] {
+			headers = append(headers, HARNameValue{Name: k, Value: v})
+		}
+	}
+	return headers
+}
+
+// isHeaderRedacted checks whether header `name` is in `redactHeaders` case-insensitively.
+func isHeaderRedacted(name string, redactHeaders []string) bool {
+	for _, redactHeader := range redactHeaders {
+		if strings.EqualFold(name, redactHeader) {
+			return true
+		}
+	}
+	return false
+}
+
+// encodeHARText returns the body as text, which is base64 encoded if it's not valid UTF-8.
+func encodeHARText(body []byte) (text, encoding string) {
+	if utf8.Valid(body) {
+		return string(body), ""
+	}
+	return base64.StdEncoding.EncodeToString(body), harEncodingBase64
+}
+
+// decodeHARText returns the body of the text with `encoding`.
+func decodeHARText(text, encoding string) ([]byte, error) {
+	if !strings.EqualFold(encoding, harEncodingBase64) {
+		return []byte(text), nil
+	}
+	body, err := base64.StdEncoding.DecodeString(text)
+	if err != nil {
+		return nil, jerr.WithMsgErr(err, `invalid base64 text in HAR`)
+	}
+	return body, nil
+}
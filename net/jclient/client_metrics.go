@@ -0,0 +1,182 @@
+package jclient
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+
+	"github.com/e7coding/coding-common"
+	"github.com/e7coding/coding-common/internal/intlog"
+)
+
+const (
+	metricAttrServerAddress      = "server.address"
+	metricAttrHttpRequestMethod  = "http.request.method"
+	metricAttrHttpResponseStatus = "http.response.status_code"
+	metricAttrConnectionReused   = "http.connection.reused"
+	metricAttrErrorType          = "error.type"
+	metricErrorTypeRequest       = "request"
+	metricUnitSeconds            = "s"
+	metricUnitBytes              = "By"
+)
+
+// clientMetrics holds all the instruments that the client records outbound request metrics with.
+type clientMetrics struct {
+	requestDuration    metric.Float64Histogram   // Total duration of the request, including retried attempts.
+	dnsDuration        metric.Float64Histogram   // Duration of the DNS lookup.
+	connectDuration    metric.Float64Histogram   // Duration of establishing the connection.
+	tlsDuration        metric.Float64Histogram   // Duration of the TLS handshake.
+	firstByteDuration  metric.Float64Histogram   // Duration from requiring a connection to the first response byte.
+	requestBodySize    metric.Int64Histogram     // Size of the request body.
+	responseBodySize   metric.Int64Histogram     // Size of the response body, only if Content-Length is known.
+	requestTotal       metric.Int64Counter       // Count of finished requests.
+	connectionTotal    metric.Int64Counter       // Count of obtained connections, labelled by reuse.
+	requestActiveTotal metric.Int64UpDownCounter // Count of in-flight requests.
+}
+
+var (
+	// globalClientMetrics is lazily initialized as the meter provider
+	// might be configured after package initialization.
+	globalClientMetrics     *clientMetrics
+	globalClientMetricsOnce sync.Once
+)
+
+// getClientMetrics creates if necessary and returns the instruments of client metrics.
+// It uses the global meter provider of OpenTelemetry, which delegates to the provider
+// that is set later using otel.SetMeterProvider.
+func getClientMetrics() *clientMetrics {
+	globalClientMetricsOnce.Do(func() {
+		globalClientMetrics = newClientMetrics(otel.GetMeterProvider().Meter(
+			instrumentName,
+			metric.WithInstrumentationVersion(gf.VERSION),
+		))
+	})
+	return globalClientMetrics
+}
+
+// newClientMetrics creates and returns the instruments using given meter.
+// Any failed instrument creation is logged internally and the instrument is skipped
+// in recording, so that metrics never break the request workflow.
+func newClientMetrics(meter metric.Meter) *clientMetrics {
+	var (
+		err error
+		m   = &clientMetrics{}
+	)
+	if m.requestDuration, err = meter.Float64Histogram(
+		"http.client.request.duration",
+		metric.WithUnit(metricUnitSeconds),
+		metric.WithDescription("Duration of the outbound HTTP request."),
+	); err != nil {
+		intlog.Errorf(`%+v`, err)
+	}
+	if m.dnsDuration, err = meter.Float64Histogram(
+		"http.client.dns.duration",
+		metric.WithUnit(metricUnitSeconds),
+		metric.WithDescription("Duration of the DNS lookup of the outbound HTTP request."),
+	); err != nil {
+		intlog.Errorf(`%+v`, err)
+	}
+	if m.connectDuration, err = meter.Float64Histogram(
+		"http.client.connect.duration",
+		metric.WithUnit(metricUnitSeconds),
+		metric.WithDescription("Duration of dialing the connection of the outbound HTTP request."),
+	); err != nil {
+		intlog.Errorf(`%+v`, err)
+	}
+	if m.tlsDuration, err = meter.Float64Histogram(
+		"http.client.tls.duration",
+		metric.WithUnit(metricUnitSeconds),
+		metric.WithDescription("Duration of the TLS handshake of the outbound HTTP request."),
+	); err != nil {
+		intlog.Errorf(`%+v`, err)
+	}
+	if m.firstByteDuration, err = meter.Float64Histogram(
+		"http.client.first_byte.duration",
+		metric.WithUnit(metricUnitSeconds),
+		metric.WithDescription("Duration until the first response byte of the outbound HTTP request."),
+	); err != nil {
+		intlog.Errorf(`%+v`, err)
+	}
+	if m.requestBodySize, err = meter.Int64Histogram(
+		"http.client.request.body.size",
+		metric.WithUnit(metricUnitBytes),
+		metric.WithDescription("Size of the outbound HTTP request body."),
+	); err != nil {
+		intlog.Errorf(`%+v`, err)
+	}
+	if m.responseBodySize, err = meter.Int64Histogram(
+		"http.client.response.body.size",
+		metric.WithUnit(metricUnitBytes),
+		metric.WithDescription("Size of the HTTP response body of outbound request."),
+	); err != nil {
+		intlog.Errorf(`%+v`, err)
+	}
+	if m.requestTotal, err = meter.Int64Counter(
+		"http.client.request.total",
+		metric.WithDescription("Total count of the outbound HTTP requests."),
+	); err != nil {
+		intlog.Errorf(`%+v`, err)
+	}
+	if m.requestActiveTotal, err = meter.Int64UpDownCounter(
+		"http.client.request.active",
+		metric.WithDescription("Count of the in-flight outbound HTTP requests."),
+	); err != nil {
+		intlog.Errorf(`%+v`, err)
+	}
+	if m.connectionTotal, err = meter.Int64Counter(
+		"http.client.connection.total",
+		metric.WithDescription("Total count of the connections obtained by outbound HTTP requests."),
+	); err != nil {
+		intlog.Errorf(`%+v`, err)
+	}
+	return m
+}
+
+// metricAttributes returns the common attributes of the request: host and method.
+func metricAttributes(r *http.Request) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.String(metricAttrServerAddress, r.URL.Host),
+		attribute.String(metricAttrHttpRequestMethod, r.Method),
+	}
+}
+
+// handleMetricsBeforeRequest records metrics before the request is sent.
+func (m *clientMetrics) handleMetricsBeforeRequest(ctx context.Context, r *http.Request, bodySize int) {
+	if m.requestActiveTotal != nil {
+		m.requestActiveTotal.Add(ctx, 1, metric.WithAttributes(metricAttributes(r)...))
+	}
+	if m.requestBodySize != nil {
+		m.requestBodySize.Record(ctx, int64(bodySize), metric.WithAttributes(metricAttributes(r)...))
+	}
+}
+
+// handleMetricsAfterRequest records metrics after the request is done,
+// no matter it succeeds or not.
+func (m *clientMetrics) handleMetricsAfterRequest(
+	ctx context.Context, r *http.Request, resp *http.Response, err error, startTime time.Time,
+) {
+	attrs := metricAttributes(r)
+	if m.requestActiveTotal != nil {
+		m.requestActiveTotal.Add(ctx, -1, metric.WithAttributes(attrs...))
+	}
+	if resp != nil {
+		attrs = append(attrs, attribute.Int(metricAttrHttpResponseStatus, resp.StatusCode))
+		if m.responseBodySize != nil && resp.ContentLength >= 0 {
+			m.responseBodySize.Record(ctx, resp.ContentLength, metric.WithAttributes(attrs...))
+		}
+	}
+	if err != nil {
+		attrs = append(attrs, attribute.String(metricAttrErrorType, metricErrorTypeRequest))
+	}
+	if m.requestDuration != nil {
+		m.requestDuration.Record(ctx, time.Since(startTime).Seconds(), metric.WithAttributes(attrs...))
+	}
+	if m.requestTotal != nil {
+		m.requestTotal.Add(ctx, 1, metric.WithAttributes(attrs...))
+	}
+}
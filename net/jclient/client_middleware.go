@@ -46,3 +46,18 @@ func (m *clientMiddleware) Next(req *http.Request) (resp *Response, err error) {
 	}
 	return m.resp, m.err
 }
+
+// nextRepeatable calls the next middleware like Next, but it restores the state of the middleware
+// chain after calling, so that the rest of the chain can be called again by the same handler.
+// It is used by the middleware handlers that retry requests.
+func (c *Client) nextRepeatable(req *http.Request) (*Response, error) {
+	if v := req.Context().Value(clientMiddlewareKey); v != nil {
+		if m, ok := v.(*clientMiddleware); ok {
+			handlerIndex := m.handlerIndex
+			resp, err := m.Next(req)
+			m.handlerIndex, m.resp, m.err = handlerIndex, nil, nil
+			return resp, err
+		}
+	}
+	return c.callRequest(req)
+}
@@ -0,0 +1,344 @@
+package jclient
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/e7coding/coding-common/errs/jerr"
+	"github.com/e7coding/coding-common/internal/intlog"
+	"github.com/e7coding/coding-common/internal/json"
+	"github.com/e7coding/coding-common/internal/utils"
+	"github.com/e7coding/coding-common/os/jcache"
+)
+
+const (
+	OAuth2GrantClientCredentials = `client_credentials` // OAuth2 client credentials grant.
+	OAuth2GrantRefreshToken      = `refresh_token`      // OAuth2 refresh token grant.
+)
+
+const (
+	oauth2DefaultExpiryDelta = 30 * time.Second
+	oauth2DefaultCacheKey    = `jclient.oauth2.`
+	oauth2DefaultTokenType   = `Bearer`
+)
+
+// OAuth2Option is the option for OAuth2 token middleware.
+type OAuth2Option struct {
+	// TokenURL is the token endpoint of the authorization server.
+	TokenURL string
+
+	// ClientId and ClientSecret are the client credentials,
+	// which are sent using HTTP basic authentication in default.
+	ClientId     string
+	ClientSecret string
+
+	// CredentialsInBody sends the client credentials in the request body instead of
+	// HTTP basic authentication, for the servers that do not support the latter.
+	CredentialsInBody bool
+
+	// Scopes are the requested permission scopes.
+	Scopes []string
+
+	// EndpointParams are the additional parameters for the token requests.
+	EndpointParams url.Values
+
+	// GrantType is the grant type to obtain the first token, it is "client_credentials" in default.
+	// The token is always refreshed using the "refresh_token" grant if the server issues refresh token,
+	// and it falls back to the client credentials grant if refreshing fails.
+	GrantType string
+
+	// RefreshToken is the initial refresh token for the "refresh_token" grant type.
+	RefreshToken string
+
+	// ExpiryDelta is how long before the expiry the token is refreshed, it is 30 seconds in default.
+	ExpiryDelta time.Duration
+
+	// Cache stores the token if given, so that the token can be shared among replicas.
+	Cache jcache.Adapter
+
+	// CacheKey is the key of the token in Cache, it is composed of the TokenURL and ClientId in default.
+	CacheKey string
+
+	// Client is the client for token requests, it uses a new client in default.
+	// Note that it should not use the OAuth2 middleware itself.
+	Client *Client
+}
+
+// OAuth2Token is the token issued by the authorization server.
+type OAuth2Token struct {
+	AccessToken  string    `json:"access_token"`
+	TokenType    string    `json:"token_type"`
+	RefreshToken string    `json:"refresh_token"`
+	Expiry       time.Time `json:"expiry"` // Zero value means the token never expires.
+}
+
+// oauth2TokenResponse is the successful response of the token endpoint.
+type oauth2TokenResponse struct {
+	AccessToken      string `json:"access_token"`
+	TokenType        string `json:"token_type"`
+	RefreshToken     string `json:"refresh_token"`
+	ExpiresIn        int64  `json:"expires_in"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// oauth2TokenSource fetches, caches and refreshes the token.
+type oauth2TokenSource struct {
+	option     OAuth2Option
+	mu         sync.Mutex
+	token      *OAuth2Token
+	refreshing chan struct{} // It is not nil if there's refreshing in progress.
+	refreshErr error         // The error of last refreshing.
+}
+
+// MiddlewareOAuth2 returns a client middleware that sets the OAuth2 token to header Authorization.
+//
+// The token is fetched on the first request and refreshed before it expires. Concurrent requests
+// share one refreshing procedure. If the server responds 401 Unauthorized, the token is refreshed
+// and the request is retried once.
+//
+// Eg:
+//
+//	client.Use(jclient.MiddlewareOAuth2(jclient.OAuth2Option{
+//	    TokenURL:     "https://auth.example.com/oauth/token",
+//	    ClientId:     "id",
+//	    ClientSecret: "secret",
+//	}))
+func MiddlewareOAuth2(option OAuth2Option) HandlerFunc {
+	if option.GrantType == "" {
+		option.GrantType = OAuth2GrantClientCredentials
+	}
+	if option.ExpiryDelta == 0 {
+		option.ExpiryDelta = oauth2DefaultExpiryDelta
+	}
+	if option.CacheKey == "" {
+		option.CacheKey = oauth2DefaultCacheKey + option.ClientId + "@" + option.TokenURL
+	}
+	if option.Client == nil {
+		option.Client = New()
+	}
+	source := &oauth2TokenSource{
+		option: option,
+	}
+	return source.handle
+}
+
+// handle is the middleware handler that authorizes the request.
+func (s *oauth2TokenSource) handle(c *Client, r *http.Request) (*Response, error) {
+	token, err := s.Token(r.Context(), "")
+	if err != nil {
+		return nil, err
+	}
+	// The body is kept for retrying.
+	body, err := readRequestBody(r)
+	if err != nil {
+		return nil, err
+	}
+	token.setAuthHeader(r)
+	resp, err := c.nextRepeatable(r)
+	if err != nil || resp == nil || resp.Response == nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+
+	// Retry once with a refreshed token.
+	if token, err = s.Token(r.Context(), token.AccessToken); err != nil {
+		return resp, nil
+	}
+	_ = resp.Close()
+	r.Body = utils.NewReadCloser(body, false)
+	token.setAuthHeader(r)
+	return c.Next(r)
+}
+
+// Token returns a valid token, which is refreshed if it is about to expire.
+// If `staleAccessToken` is not empty, the token is refreshed unless it has been refreshed
+// by others, which is used if the server rejects the token.
+func (s *oauth2TokenSource) Token(ctx context.Context, staleAccessToken string) (*OAuth2Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for {
+		if s.isUsable(s.token, staleAccessToken) {
+			return s.token, nil
+		}
+		if s.option.Cache != nil {
+			if token := s.loadCache(); s.isUsable(token, staleAccessToken) {
+				s.token = token
+				return token, nil
+			}
+		}
+		// Waiting for the refreshing in progress.
+		if s.refreshing != nil {
+			refreshing := s.refreshing
+			s.mu.Unlock()
+			select {
+			case <-refreshing:
+			case <-ctx.Done():
+				s.mu.Lock()
+				return nil, ctx.Err()
+			}
+			s.mu.Lock()
+			if s.refreshErr != nil {
+				return nil, s.refreshErr
+			}
+			continue
+		}
+		break
+	}
+
+	var (
+		current    = s.token
+		refreshing = make(chan struct{})
+	)
+	s.refreshing = refreshing
+	s.mu.Unlock()
+	// The token request uses a detached context, as its result is shared with other requests.
+	token, err := s.fetch(context.WithoutCancel(ctx), current)
+	s.mu.Lock()
+	s.refreshing, s.refreshErr = nil, err
+	close(refreshing)
+	if err != nil {
+		return nil, err
+	}
+	s.token = token
+	if s.option.Cache != nil {
+		s.saveCache(token)
+	}
+	return token, nil
+}
+
+// isUsable checks whether the token is valid and is not the `staleAccessToken`.
+func (s *oauth2TokenSource) isUsable(token *OAuth2Token, staleAccessToken string) bool {
+	if token == nil || token.AccessToken == "" || token.AccessToken == staleAccessToken {
+		return false
+	}
+	return token.Expiry.IsZero() || time.Now().Add(s.option.ExpiryDelta).Before(token.Expiry)
+}
+
+// fetch requests a new token from the token endpoint.
+// It uses the refresh token grant if there's refresh token, or else the configured grant type.
+func (s *oauth2TokenSource) fetch(ctx context.Context, current *OAuth2Token) (*OAuth2Token, error) {
+	refreshToken := s.option.RefreshToken
+	if current != nil && current.RefreshToken != "" {
+		refreshToken = current.RefreshToken
+	}
+	if refreshToken != "" {
+		params := url.Values{}
+		params.Set("grant_type", OAuth2GrantRefreshToken)
+		params.Set("refresh_token", refreshToken)
+		token, err := s.doTokenRequest(ctx, params)
+		if err == nil {
+			if token.RefreshToken == "" {
+				token.RefreshToken = refreshToken
+			}
+			return token, nil
+		}
+		if s.option.GrantType == OAuth2GrantRefreshToken {
+			return nil, err
+		}
+		intlog.Errorf(`%+v`, err)
+	}
+	if s.option.GrantType != OAuth2GrantClientCredentials {
+		return nil, jerr.WithMsgF(`unsupported OAuth2 grant type "%s" without refresh token`, s.option.GrantType)
+	}
+	params := url.Values{}
+	params.Set("grant_type", OAuth2GrantClientCredentials)
+	return s.doTokenRequest(ctx, params)
+}
+
+// doTokenRequest sends the token request with `params` and parses the token from response.
+func (s *oauth2TokenSource) doTokenRequest(ctx context.Context, params url.Values) (*OAuth2Token, error) {
+	if len(s.option.Scopes) > 0 {
+		params.Set("scope", strings.Join(s.option.Scopes, " "))
+	}
+	for k, values := range s.option.EndpointParams {
+		params[k] = values
+	}
+	client := s.option.Client.ContentType(httpHeaderContentTypeForm)
+	if s.option.CredentialsInBody {
+		params.Set("client_id", s.option.ClientId)
+		params.Set("client_secret", s.option.ClientSecret)
+	} else {
+		client.SetBasicAuth(url.QueryEscape(s.option.ClientId), url.QueryEscape(s.option.ClientSecret))
+	}
+	resp, err := client.Post(ctx, s.option.TokenURL, params.Encode())
+	if err != nil {
+		return nil, jerr.WithMsgErrF(err, `OAuth2 token request failed for "%s"`, s.option.TokenURL)
+	}
+	defer func() {
+		if err := resp.Close(); err != nil {
+			intlog.Errorf(`%+v`, err)
+		}
+	}()
+	var (
+		content       = resp.ReadAll()
+		tokenResponse oauth2TokenResponse
+	)
+	if err = json.Unmarshal(content, &tokenResponse); err != nil && resp.StatusCode == http.StatusOK {
+		return nil, jerr.WithMsgErrF(err, `invalid OAuth2 token response: %s`, content)
+	}
+	if resp.StatusCode != http.StatusOK || tokenResponse.AccessToken == "" {
+		return nil, jerr.WithMsgF(
+			`OAuth2 token request failed with status %d, error "%s": %s`,
+			resp.StatusCode, tokenResponse.Error, tokenResponse.ErrorDescription,
+		)
+	}
+	token := &OAuth2Token{
+		AccessToken:  tokenResponse.AccessToken,
+		TokenType:    tokenResponse.TokenType,
+		RefreshToken: tokenResponse.RefreshToken,
+	}
+	if tokenResponse.ExpiresIn > 0 {
+		token.Expiry = time.Now().Add(time.Duration(tokenResponse.ExpiresIn) * time.Second)
+	}
+	return token, nil
+}
+
+// loadCache retrieves the shared token from cache, it returns nil if not found.
+func (s *oauth2TokenSource) loadCache() *OAuth2Token {
+	v, err := s.option.Cache.Get(s.option.CacheKey)
+	if err != nil {
+		intlog.Errorf(`%+v`, err)
+		return nil
+	}
+	if v == nil || v.IsNil() {
+		return nil
+	}
+	var token *OAuth2Token
+	if err = json.Unmarshal(v.Bytes(), &token); err != nil {
+		intlog.Errorf(`%+v`, err)
+		return nil
+	}
+	return token
+}
+
+// saveCache stores the token into cache, which expires along with the token.
+func (s *oauth2TokenSource) saveCache(token *OAuth2Token) {
+	content, err := json.Marshal(token)
+	if err != nil {
+		intlog.Errorf(`%+v`, err)
+		return
+	}
+	var duration = jcache.DurationNoExpire
+	if !token.Expiry.IsZero() {
+		if duration = time.Until(token.Expiry); duration <= 0 {
+			return
+		}
+	}
+	if err = s.option.Cache.Set(s.option.CacheKey, content, duration); err != nil {
+		intlog.Errorf(`%+v`, err)
+	}
+}
+
+// setAuthHeader sets the token to header Authorization of the request.
+func (t *OAuth2Token) setAuthHeader(r *http.Request) {
+	tokenType := t.TokenType
+	// Some servers return "bearer" in lower case, which might not be accepted by resource servers.
+	if tokenType == "" || strings.EqualFold(tokenType, oauth2DefaultTokenType) {
+		tokenType = oauth2DefaultTokenType
+	}
+	r.Header.Set(httpHeaderAuthorization, tokenType+" "+t.AccessToken)
+}
@@ -0,0 +1,282 @@
+package jclient
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/e7coding/coding-common/errs/jerr"
+)
+
+// Rate limiting algorithms for MiddlewareRateLimit.
+const (
+	RateLimitTokenBucket = `token-bucket` // Allows bursts up to the bucket size.
+	RateLimitLeakyBucket = `leaky-bucket` // Spaces requests evenly, and queues up to the bucket size.
+)
+
+const (
+	httpHeaderRetryAfter         = `Retry-After`
+	httpHeaderRateLimitRemaining = `X-RateLimit-Remaining`
+	httpHeaderRateLimitReset     = `X-RateLimit-Reset`
+	rateLimitResetEpochThreshold = 1e9         // Reset value greater than it is unix timestamp, or else seconds.
+	rateLimitSweepInterval       = time.Minute // Interval of removing the idle buckets.
+)
+
+// RateLimitOption is the option for client-side rate limiting.
+type RateLimitOption struct {
+	// Rate is the allowed requests per second for each key, which must be greater than 0,
+	// or else all the requests fail with error of the invalid rate.
+	Rate float64
+
+	// Burst is the bucket size, it is the ceiling of Rate in default.
+	// It is the max burst of requests for RateLimitTokenBucket, and the max queued requests
+	// for RateLimitLeakyBucket.
+	Burst int
+
+	// Algorithm is the rate limiting algorithm, it is RateLimitTokenBucket in default.
+	Algorithm string
+
+	// KeyFunc returns the limiting key of the request, it uses the host of the request URL in default.
+	KeyFunc func(r *http.Request) string
+
+	// Wait makes the request wait for its turn until the deadline of the request context,
+	// or else the request fails fast with *RateLimitError if it's not allowed immediately.
+	Wait bool
+
+	// Adaptive pauses the requests of the key according to the response headers: Retry-After of
+	// 429 and 503 responses, and X-RateLimit-Reset if X-RateLimit-Remaining is 0.
+	Adaptive bool
+}
+
+// RateLimitError is the error of request rejected by the client-side rate limiting.
+type RateLimitError struct {
+	Key        string        // Limiting key of the request.
+	RetryAfter time.Duration // Duration after which the request might be allowed.
+}
+
+// Error implements interface error.
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf(`rate limit exceeded for "%s", retry after %s`, e.Key, e.RetryAfter)
+}
+
+// rateLimiter limits the requests of all keys.
+type rateLimiter struct {
+	option    RateLimitOption
+	interval  time.Duration // Interval between requests, which is 1/Rate.
+	mu        sync.Mutex
+	buckets   map[string]*rateLimitBucket
+	lastSweep time.Time // Last time of removing the idle buckets.
+}
+
+// rateLimitBucket is the state of a key.
+type rateLimitBucket struct {
+	tat         time.Time // Theoretical arrival time of the next request in generic cell rate algorithm.
+	pausedUntil time.Time // Requests are paused until this time according to the response headers.
+}
+
+// MiddlewareRateLimit returns a client middleware that limits the request rate for each key.
+//
+// Eg:
+//
+//	client.Use(jclient.MiddlewareRateLimit(jclient.RateLimitOption{
+//	    Rate: 10,
+//	    Wait: true,
+//	}))
+func MiddlewareRateLimit(option RateLimitOption) HandlerFunc {
+	if option.Rate <= 0 {
+		err := jerr.WithMsgF(`invalid rate limit rate "%v"`, option.Rate)
+		return func(c *Client, r *http.Request) (*Response, error) {
+			return nil, err
+		}
+	}
+	if option.Burst <= 0 {
+		option.Burst = int(math.Ceil(option.Rate))
+	}
+	if option.Algorithm == "" {
+		option.Algorithm = RateLimitTokenBucket
+	}
+	if option.KeyFunc == nil {
+		option.KeyFunc = func(r *http.Request) string {
+			return requestHost(r)
+		}
+	}
+	limiter := &rateLimiter{
+		option:   option,
+		interval: time.Duration(float64(time.Second) / option.Rate),
+		buckets:  make(map[string]*rateLimitBucket),
+	}
+	return limiter.handle
+}
+
+// handle is the middleware handler that limits the request.
+func (l *rateLimiter) handle(c *Client, r *http.Request) (*Response, error) {
+	var (
+		ctx = r.Context()
+		key = l.option.KeyFunc(r)
+	)
+	if err := l.acquire(ctx, key); err != nil {
+		return nil, err
+	}
+	resp, err := c.Next(r)
+	if l.option.Adaptive && resp != nil && resp.Response != nil {
+		l.adapt(key, resp.Response)
+	}
+	return resp, err
+}
+
+// acquire waits for the turn of the request with `key`, or fails if it cannot be allowed in time.
+func (l *rateLimiter) acquire(ctx context.Context, key string) error {
+	delay, err := l.reserve(ctx, key)
+	if err != nil || delay <= 0 {
+		return err
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// reserve reserves a turn for the request and returns how long it should wait, using the generic
+// cell rate algorithm. It does not reserve and returns *RateLimitError if the request cannot be
+// allowed in time.
+func (l *rateLimiter) reserve(ctx context.Context, key string) (time.Duration, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	if now.Sub(l.lastSweep) >= rateLimitSweepInterval {
+		l.sweep(now)
+	}
+	var (
+		bucket  = l.buckets[key]
+		allowAt time.Time
+	)
+	if bucket == nil {
+		bucket = &rateLimitBucket{}
+		l.buckets[key] = bucket
+	}
+	tat := bucket.tat
+	if tat.Before(now) {
+		tat = now
+	}
+	switch l.option.Algorithm {
+	case RateLimitLeakyBucket:
+		// Requests leak out one per interval, and the bucket holds at most Burst waiting requests.
+		allowAt = tat
+		if tat.Sub(maxTime(now, bucket.pausedUntil)) >= time.Duration(l.option.Burst)*l.interval {
+			return 0, &RateLimitError{Key: key, RetryAfter: tat.Sub(now)}
+		}
+	default:
+		// Tokens refill one per interval, and a full bucket allows Burst requests at once.
+		allowAt = tat.Add(-time.Duration(l.option.Burst-1) * l.interval)
+	}
+	if allowAt.Before(bucket.pausedUntil) {
+		allowAt = bucket.pausedUntil
+	}
+	delay := allowAt.Sub(now)
+	if delay > 0 && !l.canWait(ctx, delay) {
+		return 0, &RateLimitError{Key: key, RetryAfter: delay}
+	}
+	bucket.tat = tat.Add(l.interval)
+	return delay, nil
+}
+
+// sweep removes the idle buckets, whose quota is fully restored and which are not paused.
+// The removed bucket is the same as a new one, so it does not change the limiting.
+func (l *rateLimiter) sweep(now time.Time) {
+	for key, bucket := range l.buckets {
+		if !bucket.tat.After(now) && !bucket.pausedUntil.After(now) {
+			delete(l.buckets, key)
+		}
+	}
+	l.lastSweep = now
+}
+
+// canWait checks whether the request can wait for `delay`.
+func (l *rateLimiter) canWait(ctx context.Context, delay time.Duration) bool {
+	if !l.option.Wait {
+		return false
+	}
+	deadline, ok := ctx.Deadline()
+	return !ok || time.Until(deadline) >= delay
+}
+
+// adapt pauses the requests of `key` according to the rate limiting headers of the response.
+func (l *rateLimiter) adapt(key string, resp *http.Response) {
+	var pause time.Duration
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable:
+		pause = parseRetryAfter(resp.Header.Get(httpHeaderRetryAfter))
+		if pause == 0 && resp.StatusCode == http.StatusTooManyRequests {
+			pause = parseRateLimitReset(resp.Header.Get(httpHeaderRateLimitReset))
+		}
+	case strings.TrimSpace(resp.Header.Get(httpHeaderRateLimitRemaining)) == "0":
+		pause = parseRateLimitReset(resp.Header.Get(httpHeaderRateLimitReset))
+	}
+	if pause <= 0 {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	bucket := l.buckets[key]
+	if bucket == nil {
+		bucket = &rateLimitBucket{}
+		l.buckets[key] = bucket
+	}
+	pausedUntil := time.Now().Add(pause)
+	if pausedUntil.After(bucket.pausedUntil) {
+		bucket.pausedUntil = pausedUntil
+	}
+	// The quota is restored after the pause.
+	if bucket.tat.Before(pausedUntil) {
+		bucket.tat = pausedUntil
+	}
+}
+
+// parseRetryAfter parses the header Retry-After, which is either seconds or HTTP date.
+func parseRetryAfter(value string) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil {
+		return time.Duration(seconds * float64(time.Second))
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		return time.Until(t)
+	}
+	return 0
+}
+
+// parseRateLimitReset parses the header X-RateLimit-Reset, which is either unix timestamp
+// or seconds to reset, as different servers use different conventions.
+func parseRateLimitReset(value string) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+	seconds, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0
+	}
+	if seconds > rateLimitResetEpochThreshold {
+		return time.Until(time.Unix(0, int64(seconds*float64(time.Second))))
+	}
+	return time.Duration(seconds * float64(time.Second))
+}
+
+// maxTime returns the later one of `a` and `b`.
+func maxTime(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
@@ -13,6 +13,7 @@ import (
 	"io"
 	"mime/multipart"
 	"net/http"
+	"net/http/httptrace"
 	"os"
 	"strings"
 	"time"
@@ -127,6 +128,15 @@ func (c *Client) DoRequest(
 	if err != nil {
 		return nil, err
 	}
+	// Compression feature, which is done before the middleware sees the request.
+	if err = c.compressRequestBody(req); err != nil {
+		return nil, err
+	}
+	// Load balancing feature, which is done before the middleware, so that the middleware
+	// like request signing sees the URL that is requested.
+	if c.balancer != nil {
+		req = c.balancer.route(req)
+	}
 
 	// Client middleware.
 	if len(c.middlewareHandler) > 0 {
@@ -350,17 +360,40 @@ func (c *Client) prepareRequest(ctx context.Context, method, url string, data ..
 // callRequest sends request with give http.Request, and returns the responses object.
 // Note that the response object MUST be closed if it'll never be used.
 func (c *Client) callRequest(req *http.Request) (resp *Response, err error) {
-	resp = &Response{
-		request: req,
-	}
 	// Dump feature.
 	// The request body can be reused for dumping
 	// raw HTTP request-response procedure.
 	reqBodyContent, _ := io.ReadAll(req.Body)
-	resp.requestBody = reqBodyContent
+	// Metrics feature.
+	if c.metricsEnabled {
+		var (
+			metrics   = getClientMetrics()
+			startTime = time.Now()
+		)
+		req = req.WithContext(httptrace.WithClientTrace(
+			req.Context(), newClientTracerMetrics(req, newClientTracerNoop()),
+		))
+		metrics.handleMetricsBeforeRequest(req.Context(), req, len(reqBodyContent))
+		defer func() {
+			var httpResp *http.Response
+			if resp != nil {
+				httpResp = resp.Response
+			}
+			metrics.handleMetricsAfterRequest(req.Context(), req, httpResp, err, startTime)
+		}()
+	}
+	resp = &Response{
+		request:     req,
+		requestBody: reqBodyContent,
+	}
 	for {
 		req.Body = utils.NewReadCloser(reqBodyContent, false)
-		if resp.Response, err = c.Do(req); err != nil {
+		if c.balancer != nil {
+			resp.Response, err = c.balancer.send(c, req)
+		} else {
+			resp.Response, err = c.Do(req)
+		}
+		if err != nil {
 			err = jerr.WithMsgErrF(err, `request failed`)
 			// The response might not be nil when err != nil.
 			if resp.Response != nil {
@@ -374,6 +407,7 @@ func (c *Client) callRequest(req *http.Request) (resp *Response, err error) {
 				break
 			}
 		} else {
+			decompressResponseBody(resp.Response)
 			break
 		}
 	}
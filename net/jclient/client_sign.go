@@ -0,0 +1,202 @@
+package jclient
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/e7coding/coding-common/errs/jerr"
+	"github.com/e7coding/coding-common/internal/utils"
+)
+
+const (
+	signDefaultHeaderSignature = `X-Signature`
+	signDefaultHeaderKeyId     = `X-Key-Id`
+	signDefaultHeaderTimestamp = `X-Timestamp`
+	signDefaultHeaderBodyHash  = `X-Content-Sha256`
+)
+
+// HmacSignOption is the option for HMAC request signing middleware.
+type HmacSignOption struct {
+	// KeyId is the identity of the secret, which is sent using header HeaderKeyId.
+	KeyId string
+
+	// Secret is the HMAC secret key.
+	Secret []byte
+
+	// Hash is the hash function for HMAC and body hash, it is sha256.New in default.
+	Hash func() hash.Hash
+
+	// SignedHeaders are the names of the request headers to be signed,
+	// the timestamp and body hash headers are always signed.
+	SignedHeaders []string
+
+	// HeaderSignature is the header name of the signature, it is "X-Signature" in default.
+	HeaderSignature string
+
+	// HeaderKeyId is the header name of the key identity, it is "X-Key-Id" in default.
+	HeaderKeyId string
+
+	// HeaderTimestamp is the header name of the unix timestamp, it is "X-Timestamp" in default.
+	HeaderTimestamp string
+
+	// HeaderBodyHash is the header name of the body hash, it is "X-Content-Sha256" in default.
+	HeaderBodyHash string
+}
+
+// MiddlewareHmacSign returns a client middleware that signs requests using HMAC.
+//
+// The signed content is composed of the following lines joined with "\n":
+// 1. The upper case request method;
+// 2. The escaped URL path, "/" if it's empty;
+// 3. The query string sorted by key and value;
+// 4. The signed headers formatted as lower case "name:value", sorted by name;
+// 5. The lower case signed header names joined with ";";
+// 6. The hex encoded hash of the request body.
+//
+// The hex encoded signature, key identity, timestamp and body hash are then added to the request headers.
+// Note that the signing middleware should be added after any middleware that changes the request.
+func MiddlewareHmacSign(option HmacSignOption) HandlerFunc {
+	if option.Hash == nil {
+		option.Hash = sha256.New
+	}
+	if option.HeaderSignature == "" {
+		option.HeaderSignature = signDefaultHeaderSignature
+	}
+	if option.HeaderKeyId == "" {
+		option.HeaderKeyId = signDefaultHeaderKeyId
+	}
+	if option.HeaderTimestamp == "" {
+		option.HeaderTimestamp = signDefaultHeaderTimestamp
+	}
+	if option.HeaderBodyHash == "" {
+		option.HeaderBodyHash = signDefaultHeaderBodyHash
+	}
+	return func(c *Client, r *http.Request) (*Response, error) {
+		body, err := readRequestBody(r)
+		if err != nil {
+			return nil, err
+		}
+		bodyHash := option.Hash()
+		bodyHash.Write(body)
+		r.Header.Set(option.HeaderTimestamp, strconv.FormatInt(time.Now().Unix(), 10))
+		r.Header.Set(option.HeaderBodyHash, hex.EncodeToString(bodyHash.Sum(nil)))
+		r.Header.Set(option.HeaderSignature, hex.EncodeToString(
+			hmacSum(option.Hash, option.Secret, option.stringToSign(r)),
+		))
+		if option.KeyId != "" {
+			r.Header.Set(option.HeaderKeyId, option.KeyId)
+		}
+		return c.Next(r)
+	}
+}
+
+// stringToSign builds and returns the canonical content of the request for signing.
+func (o HmacSignOption) stringToSign(r *http.Request) string {
+	signedHeaders := append([]string{o.HeaderTimestamp, o.HeaderBodyHash}, o.SignedHeaders...)
+	headerNames, headerLines := canonicalHeaders(r, signedHeaders)
+	path := r.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	return strings.Join([]string{
+		strings.ToUpper(r.Method),
+		path,
+		canonicalQuery(r.URL.Query(), url.QueryEscape),
+		headerLines,
+		headerNames,
+		r.Header.Get(o.HeaderBodyHash),
+	}, "\n")
+}
+
+// readRequestBody reads and returns the request body, and resets the body for later reading.
+func readRequestBody(r *http.Request) ([]byte, error) {
+	if r.Body == nil || r.Body == http.NoBody {
+		return []byte{}, nil
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, jerr.WithMsgErr(err, `read request body failed`)
+	}
+	r.Body = utils.NewReadCloser(body, false)
+	return body, nil
+}
+
+// hmacSum returns the HMAC of `data` using hash function `h` and `key`.
+func hmacSum(h func() hash.Hash, key []byte, data string) []byte {
+	mac := hmac.New(h, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// canonicalQuery returns the query string sorted by key and then value,
+// with each key and value escaped using `escape`.
+func canonicalQuery(query url.Values, escape func(string) string) string {
+	pairs := make([][2]string, 0, len(query))
+	for key, values := range query {
+		for _, value := range values {
+			pairs = append(pairs, [2]string{escape(key), escape(value)})
+		}
+	}
+	// Sort the pairs instead of the joined "key=value", as "=" sorts after characters like "-".
+	sort.Slice(pairs, func(i, j int) bool {
+		if pairs[i][0] != pairs[j][0] {
+			return pairs[i][0] < pairs[j][0]
+		}
+		return pairs[i][1] < pairs[j][1]
+	})
+	joined := make([]string, len(pairs))
+	for i, pair := range pairs {
+		joined[i] = pair[0] + "=" + pair[1]
+	}
+	return strings.Join(joined, "&")
+}
+
+// canonicalHeaders returns the sorted lower case names joined with ";" and the
+// "name:value" lines of given headers. The header "host" uses the request host.
+// Multiple values of the same header are joined with "," and extra spaces are trimmed.
+func canonicalHeaders(r *http.Request, names []string) (headerNames string, headerLines string) {
+	var (
+		exists = make(map[string]struct{}, len(names))
+		sorted = make([]string, 0, len(names))
+	)
+	for _, name := range names {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if _, ok := exists[name]; ok || name == "" {
+			continue
+		}
+		exists[name] = struct{}{}
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+	lines := make([]string, 0, len(sorted))
+	for _, name := range sorted {
+		var values []string
+		if name == "host" {
+			values = []string{requestHost(r)}
+		} else {
+			values = append([]string(nil), r.Header.Values(name)...)
+		}
+		for i, value := range values {
+			values[i] = strings.Join(strings.Fields(value), " ")
+		}
+		lines = append(lines, name+":"+strings.Join(values, ","))
+	}
+	return strings.Join(sorted, ";"), strings.Join(lines, "\n")
+}
+
+// requestHost returns the host that the request is sent to.
+func requestHost(r *http.Request) string {
+	if r.Host != "" {
+		return r.Host
+	}
+	return r.URL.Host
+}
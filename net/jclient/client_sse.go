@@ -0,0 +1,284 @@
+package jclient
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/e7coding/coding-common/container/jatomic"
+	"github.com/e7coding/coding-common/errs/jerr"
+	"github.com/e7coding/coding-common/internal/intlog"
+)
+
+const (
+	httpHeaderAccept         = `Accept`
+	httpHeaderLastEventId    = `Last-Event-ID`
+	httpHeaderContentTypeSSE = `text/event-stream`
+	sseDefaultEvent          = `message`
+	sseDefaultRetry          = 3 * time.Second
+	sseMaxLineSize           = 16 * 1024 * 1024
+	sseFieldId               = `id`
+	sseFieldData             = `data`
+	sseFieldEvent            = `event`
+	sseFieldRetry            = `retry`
+)
+
+// SSEEvent is the event received from Server-Sent Events stream.
+type SSEEvent struct {
+	Id    string        // Id is the last event id, which is kept if the event has no id field.
+	Event string        // Event is the event type, which is "message" in default.
+	Data  string        // Data is the event data, multiple data lines are joined with "\n".
+	Retry time.Duration // Retry is the reconnection time set by this event, or 0 if not set.
+}
+
+// SSEStream is the Server-Sent Events stream, which reconnects automatically if the connection is lost.
+type SSEStream struct {
+	client      *Client            // The client for connecting, which carries the headers, middleware and tracing.
+	ctx         context.Context    // Context of the stream, which is done if the stream is closed.
+	cancel      context.CancelFunc // Cancel function for closing the stream.
+	url         string             // Stream URL.
+	data        []interface{}      // Request parameters.
+	mu          sync.Mutex         // Mutex for the response.
+	resp        *Response          // Response of current connection.
+	scanner     *bufio.Scanner     // Line scanner of current connection.
+	lastEventId *jatomic.String    // The last event id, which is sent in header Last-Event-ID when reconnecting.
+	retry       time.Duration      // Reconnection time.
+}
+
+// SSE connects to the Server-Sent Events stream of `url` using GET method and returns the stream,
+// the optional `data` is sent as query parameters.
+//
+// The stream reconnects automatically with header Last-Event-ID if the connection is lost, in the
+// reconnection time that the server sets using field "retry". The stream stops if the server responds
+// other status than 200 OK or content type other than "text/event-stream", or `ctx` is done.
+//
+// Note that the client should not have timeout set, which also limits the lifetime of the stream.
+func (c *Client) SSE(ctx context.Context, url string, data ...interface{}) (*SSEStream, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	s := &SSEStream{
+		client:      c,
+		url:         url,
+		data:        data,
+		retry:       sseDefaultRetry,
+		lastEventId: jatomic.NewString(),
+	}
+	s.ctx, s.cancel = context.WithCancel(ctx)
+	if _, err := s.connect(); err != nil {
+		s.cancel()
+		return nil, err
+	}
+	return s, nil
+}
+
+// Recv blocks until the next event is received and returns it.
+// It reconnects if the connection is lost, and it returns error only if the stream stops.
+// It returns io.EOF if the stream is closed by Close or the server responds 204 No Content.
+func (s *SSEStream) Recv() (*SSEEvent, error) {
+	for {
+		if s.ctx.Err() != nil {
+			return nil, s.stopError()
+		}
+		s.mu.Lock()
+		scanner := s.scanner
+		s.mu.Unlock()
+		if scanner == nil {
+			var (
+				fatal bool
+				err   error
+			)
+			if fatal, err = s.connect(); err != nil {
+				if fatal {
+					s.cancel()
+					return nil, err
+				}
+				intlog.Errorf(`%+v`, jerr.WithMsgErr(err, `SSE reconnecting failed`))
+				if !s.wait() {
+					return nil, s.stopError()
+				}
+				continue
+			}
+			s.mu.Lock()
+			scanner = s.scanner
+			s.mu.Unlock()
+		}
+		event, err := s.readEvent(scanner)
+		if err == nil {
+			return event, nil
+		}
+		// Connection lost, reconnect after the reconnection time.
+		s.closeResponse()
+		if err != io.EOF {
+			intlog.Errorf(`%+v`, err)
+		}
+		if !s.wait() {
+			return nil, s.stopError()
+		}
+	}
+}
+
+// LastEventId returns the id of the last received event, it is safe to be called concurrently with Recv.
+func (s *SSEStream) LastEventId() string {
+	return s.lastEventId.Load()
+}
+
+// Close closes the stream, it is safe to be called concurrently with Recv.
+func (s *SSEStream) Close() error {
+	s.cancel()
+	s.closeResponse()
+	return nil
+}
+
+// connect connects to the stream, the returned `fatal` is true if it should not reconnect.
+func (s *SSEStream) connect() (fatal bool, err error) {
+	header := map[string]string{
+		httpHeaderAccept:       httpHeaderContentTypeSSE,
+		httpHeaderCacheControl: cacheDirectiveNoCache,
+	}
+	if lastEventId := s.lastEventId.Load(); lastEventId != "" {
+		header[httpHeaderLastEventId] = lastEventId
+	}
+	resp, err := s.client.Header(header).Get(s.ctx, s.url, s.data...)
+	if err != nil {
+		return s.ctx.Err() != nil, err
+	}
+	switch {
+	case resp.StatusCode == http.StatusNoContent:
+		_ = resp.Close()
+		s.cancel()
+		return true, io.EOF
+
+	case resp.StatusCode != http.StatusOK:
+		_ = resp.Close()
+		return true, jerr.WithMsgF(`SSE request failed with status %d for "%s"`, resp.StatusCode, s.url)
+	}
+	if mediaType, _, _ := mime.ParseMediaType(resp.Header.Get(httpHeaderContentType)); mediaType != httpHeaderContentTypeSSE {
+		_ = resp.Close()
+		return true, jerr.WithMsgF(`invalid SSE content type "%s" for "%s"`, resp.Header.Get(httpHeaderContentType), s.url)
+	}
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 4096), sseMaxLineSize)
+	scanner.Split(scanSSELines)
+	s.mu.Lock()
+	s.resp, s.scanner = resp, scanner
+	s.mu.Unlock()
+	return false, nil
+}
+
+// readEvent reads lines until an event is dispatched.
+func (s *SSEStream) readEvent(scanner *bufio.Scanner) (*SSEEvent, error) {
+	var (
+		event = &SSEEvent{}
+		data  bytes.Buffer
+	)
+	for scanner.Scan() {
+		line := scanner.Text()
+		// Empty line dispatches the event.
+		if line == "" {
+			if data.Len() == 0 {
+				event = &SSEEvent{}
+				continue
+			}
+			event.Id = s.lastEventId.Load()
+			event.Data = strings.TrimSuffix(data.String(), "\n")
+			if event.Event == "" {
+				event.Event = sseDefaultEvent
+			}
+			return event, nil
+		}
+		// Comment line.
+		if line[0] == ':' {
+			continue
+		}
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case sseFieldEvent:
+			event.Event = value
+		case sseFieldData:
+			data.WriteString(value)
+			data.WriteByte('\n')
+		case sseFieldId:
+			if !strings.ContainsRune(value, 0) {
+				s.lastEventId.Store(value)
+			}
+		case sseFieldRetry:
+			if milliseconds, err := strconv.ParseUint(value, 10, 64); err == nil {
+				event.Retry = time.Duration(milliseconds) * time.Millisecond
+				s.retry = event.Retry
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, io.EOF
+}
+
+// wait waits for the reconnection time, it returns false if the stream is closed during waiting.
+func (s *SSEStream) wait() bool {
+	timer := time.NewTimer(s.retry)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-s.ctx.Done():
+		return false
+	}
+}
+
+// closeResponse closes the response of current connection.
+func (s *SSEStream) closeResponse() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.resp != nil {
+		if err := s.resp.Close(); err != nil {
+			intlog.Errorf(`%+v`, err)
+		}
+		s.resp, s.scanner = nil, nil
+	}
+}
+
+// stopError returns the error of the stopped stream.
+func (s *SSEStream) stopError() error {
+	if err := s.ctx.Err(); err != nil && err != context.Canceled {
+		return err
+	}
+	return io.EOF
+}
+
+// scanSSELines is the split function for bufio.Scanner, which splits lines by
+// "\r\n", "\n" or "\r" as the Server-Sent Events specification requires.
+func scanSSELines(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	if atEOF && len(data) == 0 {
+		return 0, nil, nil
+	}
+	if i := bytes.IndexAny(data, "\r\n"); i >= 0 {
+		if data[i] == '\n' {
+			return i + 1, data[:i], nil
+		}
+		// It needs more data to determine whether "\r" is followed by "\n".
+		if i+1 < len(data) {
+			if data[i+1] == '\n' {
+				return i + 2, data[:i], nil
+			}
+			return i + 1, data[:i], nil
+		}
+		if atEOF {
+			return i + 1, data[:i], nil
+		}
+		return 0, nil, nil
+	}
+	if atEOF {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
@@ -11,14 +11,25 @@ import (
 	"net/http"
 	"net/http/httptrace"
 	"net/textproto"
+	"sync"
+	"time"
 
-	"github.com/e7coding/coding-common/os/jtime"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
 )
 
+// clientTracerMetrics is used for implementing httptrace.ClientTrace,
+// which records the durations of each phase of the request as metrics.
 type clientTracerMetrics struct {
 	*httptrace.ClientTrace
-	Request          *http.Request
-	ConnectStartTime *jtime.Time
+	Request           *http.Request
+	metrics           *clientMetrics
+	getConnTime       time.Time
+	dnsStartTime      time.Time
+	connectStartTime  time.Time
+	tlsHandshakeStart time.Time
+	firstByteRecorded bool
+	mtx               sync.Mutex
 }
 
 // newClientTracerMetrics creates and returns object of httptrace.ClientTrace.
@@ -26,6 +37,7 @@ func newClientTracerMetrics(request *http.Request, baseClientTracer *httptrace.C
 	c := &clientTracerMetrics{
 		Request:     request,
 		ClientTrace: baseClientTracer,
+		metrics:     getClientMetrics(),
 	}
 	return &httptrace.ClientTrace{
 		GetConn:              c.GetConn,
@@ -47,11 +59,28 @@ func newClientTracerMetrics(request *http.Request, baseClientTracer *httptrace.C
 	}
 }
 
+// recordDuration records the duration since `startTime` to given histogram
+// with the common attributes of the request.
+func (ct *clientTracerMetrics) recordDuration(histogram metric.Float64Histogram, startTime time.Time) {
+	if histogram == nil || startTime.IsZero() {
+		return
+	}
+	histogram.Record(
+		ct.Request.Context(),
+		time.Since(startTime).Seconds(),
+		metric.WithAttributes(metricAttributes(ct.Request)...),
+	)
+}
+
 // GetConn is called before a connection is created or
 // retrieved from an idle pool. The hostPort is the
 // "host:port" of the target or proxy. GetConn is called even
 // if there's already an idle cached connection available.
 func (ct *clientTracerMetrics) GetConn(hostPort string) {
+	ct.mtx.Lock()
+	ct.getConnTime = time.Now()
+	ct.firstByteRecorded = false
+	ct.mtx.Unlock()
 	ct.ClientTrace.GetConn(hostPort)
 }
 
@@ -60,6 +89,13 @@ func (ct *clientTracerMetrics) GetConn(hostPort string) {
 // connection; instead, use the error from
 // Transport.RoundTrip.
 func (ct *clientTracerMetrics) GotConn(info httptrace.GotConnInfo) {
+	if ct.metrics.connectionTotal != nil {
+		attrs := append(
+			metricAttributes(ct.Request),
+			attribute.Bool(metricAttrConnectionReused, info.Reused),
+		)
+		ct.metrics.connectionTotal.Add(ct.Request.Context(), 1, metric.WithAttributes(attrs...))
+	}
 	ct.ClientTrace.GotConn(info)
 }
 
@@ -78,6 +114,13 @@ func (ct *clientTracerMetrics) PutIdleConn(err error) {
 // GotFirstResponseByte is called when the first byte of the response
 // headers is available.
 func (ct *clientTracerMetrics) GotFirstResponseByte() {
+	ct.mtx.Lock()
+	getConnTime, recorded := ct.getConnTime, ct.firstByteRecorded
+	ct.firstByteRecorded = true
+	ct.mtx.Unlock()
+	if !recorded {
+		ct.recordDuration(ct.metrics.firstByteDuration, getConnTime)
+	}
 	ct.ClientTrace.GotFirstResponseByte()
 }
 
@@ -97,11 +140,18 @@ func (ct *clientTracerMetrics) Got1xxResponse(code int, header textproto.MIMEHea
 
 // DNSStart is called when a DNS lookup begins.
 func (ct *clientTracerMetrics) DNSStart(info httptrace.DNSStartInfo) {
+	ct.mtx.Lock()
+	ct.dnsStartTime = time.Now()
+	ct.mtx.Unlock()
 	ct.ClientTrace.DNSStart(info)
 }
 
 // DNSDone is called when a DNS lookup ends.
 func (ct *clientTracerMetrics) DNSDone(info httptrace.DNSDoneInfo) {
+	ct.mtx.Lock()
+	dnsStartTime := ct.dnsStartTime
+	ct.mtx.Unlock()
+	ct.recordDuration(ct.metrics.dnsDuration, dnsStartTime)
 	ct.ClientTrace.DNSDone(info)
 }
 
@@ -112,7 +162,9 @@ func (ct *clientTracerMetrics) ConnectStart(network, addr string) {
 	if ct.Request.RemoteAddr == "" {
 		ct.Request.RemoteAddr = addr
 	}
-	ct.ConnectStartTime = jtime.Now()
+	ct.mtx.Lock()
+	ct.connectStartTime = time.Now()
+	ct.mtx.Unlock()
 	ct.ClientTrace.ConnectStart(network, addr)
 }
 
@@ -122,6 +174,12 @@ func (ct *clientTracerMetrics) ConnectStart(network, addr string) {
 // If net.Dialer.DualStack ("Happy Eyeballs") support is
 // enabled, this may be called multiple times.
 func (ct *clientTracerMetrics) ConnectDone(network, addr string, err error) {
+	if err == nil {
+		ct.mtx.Lock()
+		connectStartTime := ct.connectStartTime
+		ct.mtx.Unlock()
+		ct.recordDuration(ct.metrics.connectDuration, connectStartTime)
+	}
 	ct.ClientTrace.ConnectDone(network, addr, err)
 }
 
@@ -129,6 +187,9 @@ func (ct *clientTracerMetrics) ConnectDone(network, addr string, err error) {
 // connecting to an HTTPS site via an HTTP proxy, the handshake happens
 // after the CONNECT request is processed by the proxy.
 func (ct *clientTracerMetrics) TLSHandshakeStart() {
+	ct.mtx.Lock()
+	ct.tlsHandshakeStart = time.Now()
+	ct.mtx.Unlock()
 	ct.ClientTrace.TLSHandshakeStart()
 }
 
@@ -136,6 +197,12 @@ func (ct *clientTracerMetrics) TLSHandshakeStart() {
 // successful handshake's connection state, or a non-nil error on handshake
 // failure.
 func (ct *clientTracerMetrics) TLSHandshakeDone(state tls.ConnectionState, err error) {
+	if err == nil {
+		ct.mtx.Lock()
+		tlsHandshakeStart := ct.tlsHandshakeStart
+		ct.mtx.Unlock()
+		ct.recordDuration(ct.metrics.tlsDuration, tlsHandshakeStart)
+	}
 	ct.ClientTrace.TLSHandshakeDone(state, err)
 }
 
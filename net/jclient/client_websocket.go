@@ -0,0 +1,472 @@
+package jclient
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/e7coding/coding-common/container/jatomic"
+	"github.com/e7coding/coding-common/encoding/jjson"
+	"github.com/e7coding/coding-common/errs/jerr"
+	"github.com/e7coding/coding-common/internal/intlog"
+)
+
+// WebSocket close status codes, refer to RFC 6455 section 7.4.1.
+const (
+	WebSocketCloseNormal          = 1000
+	WebSocketCloseGoingAway       = 1001
+	WebSocketCloseProtocolError   = 1002
+	WebSocketCloseUnsupportedData = 1003
+	WebSocketCloseNoStatus        = 1005
+	WebSocketCloseAbnormal        = 1006
+	WebSocketCloseInvalidPayload  = 1007
+	WebSocketClosePolicyViolation = 1008
+	WebSocketCloseMessageTooBig   = 1009
+	WebSocketCloseInternalError   = 1011
+)
+
+const (
+	httpHeaderUpgrade             = `Upgrade`
+	httpHeaderConnection          = `Connection`
+	httpHeaderWsKey               = `Sec-WebSocket-Key`
+	httpHeaderWsAccept            = `Sec-WebSocket-Accept`
+	httpHeaderWsVersion           = `Sec-WebSocket-Version`
+	httpHeaderWsProtocol          = `Sec-WebSocket-Protocol`
+	httpHeaderWsExtensions        = `Sec-WebSocket-Extensions`
+	wsUpgradeToken                = `websocket`
+	wsVersion                     = `13`
+	wsAcceptGUID                  = `258EAFA5-E914-47DA-95CA-C5AB0DC85B11`
+	wsExtensionDeflate            = `permessage-deflate`
+	wsExtensionServerNoTakeover   = `server_no_context_takeover`
+	wsExtensionDeflateOffer       = `permessage-deflate; client_no_context_takeover; server_no_context_takeover`
+	wsDefaultCompressionThreshold = 512
+	wsDefaultPongWaitRate         = 2
+	wsDefaultReadLimit            = 32 * 1024 * 1024
+	wsCloseCodeSize               = 2
+)
+
+// WebSocketOption is the option for WebSocket connection.
+type WebSocketOption struct {
+	// Subprotocols are the requested subprotocols in preference order.
+	Subprotocols []string
+
+	// Compression enables permessage-deflate extension if the server supports it.
+	Compression bool
+
+	// CompressionThreshold is the min message size in bytes for compression, it is 512 in default.
+	CompressionThreshold int
+
+	// PingInterval is the interval of sending ping frames for keepalive, 0 disables keepalive.
+	PingInterval time.Duration
+
+	// PongWait is how long the connection is closed if nothing is received from the server,
+	// it is twice the PingInterval in default. It only works if keepalive is enabled.
+	// Note that the frames are received in ReadMessage, so the connection should be read
+	// continuously if keepalive is enabled.
+	PongWait time.Duration
+
+	// ReadLimit is the max size of a message in bytes, it is 32MB in default.
+	// The frames exceeding it are rejected before their payloads are allocated.
+	ReadLimit int64
+}
+
+// WebSocketCloseError is the error returned if the connection is closed by close frame.
+type WebSocketCloseError struct {
+	Code int    // Close status code.
+	Text string // Close reason.
+}
+
+// WebSocketConn is the WebSocket connection created by Client.WebSocket.
+type WebSocketConn struct {
+	response    *Response          // Handshake response.
+	rwc         io.ReadWriteCloser // Underlying connection.
+	reader      *bufio.Reader      // Buffered reader of the connection.
+	option      WebSocketOption    // Connection option.
+	subprotocol string             // Negotiated subprotocol.
+	compression bool               // Whether permessage-deflate is negotiated.
+	writeMu     sync.Mutex         // Mutex for frame writing.
+	lastRead    *jatomic.Int64     // Unix nano timestamp of last received frame.
+	closeSent   *jatomic.Bool      // Whether the close frame is sent.
+	closeOnce   sync.Once          // Closing the connection once.
+	closed      chan struct{}      // Closed if the connection is closed.
+}
+
+// WebSocket connects to the WebSocket server of `url` and returns the connection.
+// The `url` can be in scheme "ws", "wss", "http" or "https".
+//
+// The handshake request is sent using the client, thus it shares the headers, cookies,
+// TLS configuration, proxy and middleware of the client. Note that the timeout of the client
+// is ignored, use `ctx` to control the handshake timeout instead.
+func (c *Client) WebSocket(ctx context.Context, url string, option ...WebSocketOption) (*WebSocketConn, error) {
+	var wsOption WebSocketOption
+	if len(option) > 0 {
+		wsOption = option[0]
+	}
+	if wsOption.CompressionThreshold == 0 {
+		wsOption.CompressionThreshold = wsDefaultCompressionThreshold
+	}
+	if wsOption.ReadLimit <= 0 {
+		wsOption.ReadLimit = wsDefaultReadLimit
+	}
+	if wsOption.PongWait == 0 {
+		wsOption.PongWait = wsOption.PingInterval * wsDefaultPongWaitRate
+	}
+	keyBytes := make([]byte, 16)
+	if _, err := rand.Read(keyBytes); err != nil {
+		return nil, jerr.WithMsgErr(err, `generate WebSocket key failed`)
+	}
+	var (
+		key    = base64.StdEncoding.EncodeToString(keyBytes)
+		header = map[string]string{
+			httpHeaderUpgrade:    wsUpgradeToken,
+			httpHeaderConnection: httpHeaderUpgrade,
+			httpHeaderWsKey:      key,
+			httpHeaderWsVersion:  wsVersion,
+		}
+	)
+	if len(wsOption.Subprotocols) > 0 {
+		header[httpHeaderWsProtocol] = strings.Join(wsOption.Subprotocols, ", ")
+	}
+	if wsOption.Compression {
+		header[httpHeaderWsExtensions] = wsExtensionDeflateOffer
+	}
+	// The connection would be closed by the client timeout, so it's removed.
+	client := c.Header(header)
+	client.Client.Timeout = 0
+	client.prefix = wsToHttpURL(client.prefix)
+	resp, err := client.Get(ctx, wsToHttpURL(url))
+	if err != nil {
+		return nil, err
+	}
+	conn, err := newWebSocketConn(resp, key, wsOption)
+	if err != nil {
+		_ = resp.Close()
+		return nil, err
+	}
+	if wsOption.PingInterval > 0 {
+		go conn.keepalive()
+	}
+	return conn, nil
+}
+
+// newWebSocketConn validates the handshake response and creates the connection.
+func newWebSocketConn(resp *Response, key string, option WebSocketOption) (*WebSocketConn, error) {
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		return nil, jerr.WithMsgF(`WebSocket handshake failed with status %d`, resp.StatusCode)
+	}
+	if !strings.EqualFold(resp.Header.Get(httpHeaderUpgrade), wsUpgradeToken) ||
+		!headerContainsToken(resp.Header, httpHeaderConnection, httpHeaderUpgrade) {
+		return nil, jerr.WithMsg(`WebSocket handshake failed with invalid Upgrade or Connection header`)
+	}
+	acceptSum := sha1.Sum([]byte(key + wsAcceptGUID))
+	if resp.Header.Get(httpHeaderWsAccept) != base64.StdEncoding.EncodeToString(acceptSum[:]) {
+		return nil, jerr.WithMsg(`WebSocket handshake failed with invalid Sec-WebSocket-Accept header`)
+	}
+	rwc, ok := resp.Body.(io.ReadWriteCloser)
+	if !ok {
+		return nil, jerr.WithMsg(`WebSocket handshake response body is not writable`)
+	}
+	conn := &WebSocketConn{
+		response:    resp,
+		rwc:         rwc,
+		reader:      bufio.NewReader(rwc),
+		option:      option,
+		subprotocol: resp.Header.Get(httpHeaderWsProtocol),
+		lastRead:    jatomic.NewInt64(time.Now().UnixNano()),
+		closeSent:   jatomic.NewBool(),
+		closed:      make(chan struct{}),
+	}
+	if conn.subprotocol != "" && !containsString(option.Subprotocols, conn.subprotocol) {
+		return nil, jerr.WithMsgF(`WebSocket handshake failed with unrequested subprotocol "%s"`, conn.subprotocol)
+	}
+	for _, extension := range resp.Header.Values(httpHeaderWsExtensions) {
+		params := strings.Split(extension, ";")
+		if strings.TrimSpace(params[0]) != wsExtensionDeflate {
+			return nil, jerr.WithMsgF(`WebSocket handshake failed with unrequested extension "%s"`, extension)
+		}
+		// Context takeover is not supported, the server must accept the offer without it.
+		var serverNoTakeover bool
+		for _, param := range params[1:] {
+			if strings.TrimSpace(param) == wsExtensionServerNoTakeover {
+				serverNoTakeover = true
+			}
+		}
+		if !option.Compression || !serverNoTakeover {
+			return nil, jerr.WithMsgF(`WebSocket handshake failed with invalid extension "%s"`, extension)
+		}
+		conn.compression = true
+	}
+	return conn, nil
+}
+
+// Error implements the interface error.
+func (e *WebSocketCloseError) Error() string {
+	return fmt.Sprintf(`websocket closed with code %d: %s`, e.Code, e.Text)
+}
+
+// newWsProtocolError creates and returns a close error for protocol violation.
+func newWsProtocolError(text string) error {
+	return &WebSocketCloseError{Code: WebSocketCloseProtocolError, Text: text}
+}
+
+// Response returns the handshake response.
+func (c *WebSocketConn) Response() *Response {
+	return c.response
+}
+
+// Subprotocol returns the subprotocol negotiated with the server.
+func (c *WebSocketConn) Subprotocol() string {
+	return c.subprotocol
+}
+
+// ReadMessage blocks until a message is received, and returns its type and content.
+// The fragmented messages are reassembled and the control frames are handled automatically.
+// It returns *WebSocketCloseError if the connection is closed by the server.
+//
+// Note that it should not be called concurrently.
+func (c *WebSocketConn) ReadMessage() (messageType int, data []byte, err error) {
+	var compressed bool
+	for {
+		// The frame is limited by the remaining size of the message, as the message is reassembled.
+		frame, err := readWsFrame(c.reader, c.option.ReadLimit-int64(len(data)))
+		if err != nil {
+			return 0, nil, c.handleReadError(err)
+		}
+		c.lastRead.Store(time.Now().UnixNano())
+		switch frame.opcode {
+		case WebSocketPing:
+			if err = c.writeFrame(&wsFrame{fin: true, opcode: WebSocketPong, payload: frame.payload}); err != nil {
+				return 0, nil, err
+			}
+			continue
+
+		case WebSocketPong:
+			continue
+
+		case WebSocketClose:
+			return 0, nil, c.handleCloseFrame(frame.payload)
+
+		case WebSocketContinuation:
+			if messageType == 0 {
+				return 0, nil, c.handleReadError(newWsProtocolError(`unexpected continuation frame`))
+			}
+
+		default:
+			if messageType != 0 {
+				return 0, nil, c.handleReadError(newWsProtocolError(`unexpected new message in fragmented message`))
+			}
+			if frame.rsv1 && !c.compression {
+				return 0, nil, c.handleReadError(newWsProtocolError(`unexpected compressed message`))
+			}
+			messageType, compressed = frame.opcode, frame.rsv1
+		}
+		data = append(data, frame.payload...)
+		if frame.fin {
+			break
+		}
+	}
+	if compressed {
+		if data, err = decompressWsMessage(data, c.option.ReadLimit); err != nil {
+			return 0, nil, c.handleReadError(err)
+		}
+	}
+	if messageType == WebSocketText && !utf8.Valid(data) {
+		return 0, nil, c.handleReadError(&WebSocketCloseError{
+			Code: WebSocketCloseInvalidPayload, Text: `invalid UTF-8 text message`,
+		})
+	}
+	return messageType, data, nil
+}
+
+// ReadJSON reads a message and decodes it as JSON into `pointer`.
+func (c *WebSocketConn) ReadJSON(pointer interface{}) error {
+	_, data, err := c.ReadMessage()
+	if err != nil {
+		return err
+	}
+	return jjson.DecodeTo(data, pointer)
+}
+
+// WriteMessage sends a message of `messageType`, which is WebSocketText or WebSocketBinary.
+// It is safe to be called concurrently.
+func (c *WebSocketConn) WriteMessage(messageType int, data []byte) (err error) {
+	if messageType != WebSocketText && messageType != WebSocketBinary {
+		return jerr.WithMsgF(`invalid WebSocket message type %d`, messageType)
+	}
+	frame := &wsFrame{fin: true, opcode: messageType, payload: data}
+	if c.compression && len(data) >= c.option.CompressionThreshold {
+		if frame.payload, err = compressWsMessage(data); err != nil {
+			return jerr.WithMsgErr(err, `compress WebSocket message failed`)
+		}
+		frame.rsv1 = true
+	}
+	return c.writeFrame(frame)
+}
+
+// WriteJSON encodes `value` as JSON and sends it as text message.
+func (c *WebSocketConn) WriteJSON(value interface{}) error {
+	data, err := jjson.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return c.WriteMessage(WebSocketText, data)
+}
+
+// Ping sends a ping frame with optional application `data`, which must be no more than 125 bytes.
+func (c *WebSocketConn) Ping(data ...byte) error {
+	if len(data) > wsFrameMaxControlSize {
+		return jerr.WithMsgF(`WebSocket ping data size %d exceeds %d`, len(data), wsFrameMaxControlSize)
+	}
+	return c.writeFrame(&wsFrame{fin: true, opcode: WebSocketPing, payload: data})
+}
+
+// Close sends close frame with normal status and closes the connection.
+func (c *WebSocketConn) Close() error {
+	return c.CloseWithCode(WebSocketCloseNormal, "")
+}
+
+// CloseWithCode sends close frame with `code` and `reason`, and closes the connection.
+func (c *WebSocketConn) CloseWithCode(code int, reason string) error {
+	err := c.sendClose(code, reason)
+	if closeErr := c.closeConn(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// writeFrame writes the frame to the connection with write lock.
+func (c *WebSocketConn) writeFrame(frame *wsFrame) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	select {
+	case <-c.closed:
+		return jerr.WithMsg(`WebSocket connection is closed`)
+	default:
+	}
+	if err := writeWsFrame(c.rwc, frame); err != nil {
+		return jerr.WithMsgErr(err, `write WebSocket frame failed`)
+	}
+	return nil
+}
+
+// sendClose sends the close frame once.
+func (c *WebSocketConn) sendClose(code int, reason string) error {
+	if !c.closeSent.CAS(false, true) {
+		return nil
+	}
+	var payload []byte
+	if code != WebSocketCloseNoStatus {
+		payload = binary.BigEndian.AppendUint16(make([]byte, 0, wsCloseCodeSize+len(reason)), uint16(code))
+		payload = append(payload, reason...)
+		if len(payload) > wsFrameMaxControlSize {
+			payload = payload[:wsFrameMaxControlSize]
+		}
+	}
+	return c.writeFrame(&wsFrame{fin: true, opcode: WebSocketClose, payload: payload})
+}
+
+// closeConn closes the underlying connection once.
+func (c *WebSocketConn) closeConn() (err error) {
+	c.closeOnce.Do(func() {
+		close(c.closed)
+		err = c.rwc.Close()
+	})
+	return
+}
+
+// handleCloseFrame replies the close frame from server and closes the connection.
+func (c *WebSocketConn) handleCloseFrame(payload []byte) error {
+	closeErr := &WebSocketCloseError{Code: WebSocketCloseNoStatus}
+	if len(payload) >= wsCloseCodeSize {
+		closeErr.Code = int(binary.BigEndian.Uint16(payload))
+		closeErr.Text = string(payload[wsCloseCodeSize:])
+	}
+	if err := c.sendClose(closeErr.Code, ""); err != nil {
+		intlog.Errorf(`%+v`, err)
+	}
+	if err := c.closeConn(); err != nil {
+		intlog.Errorf(`%+v`, err)
+	}
+	return closeErr
+}
+
+// handleReadError closes the connection on read error, it sends close frame with
+// the status code if the error is *WebSocketCloseError.
+func (c *WebSocketConn) handleReadError(err error) error {
+	if closeErr, ok := err.(*WebSocketCloseError); ok {
+		if sendErr := c.sendClose(closeErr.Code, closeErr.Text); sendErr != nil {
+			intlog.Errorf(`%+v`, sendErr)
+		}
+	}
+	if closeErr := c.closeConn(); closeErr != nil {
+		intlog.Errorf(`%+v`, closeErr)
+	}
+	return err
+}
+
+// keepalive sends ping frames periodically, and closes the connection if nothing
+// is received from the server in PongWait.
+func (c *WebSocketConn) keepalive() {
+	ticker := time.NewTicker(c.option.PingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.closed:
+			return
+		case <-ticker.C:
+		}
+		if time.Since(time.Unix(0, c.lastRead.Load())) > c.option.PongWait {
+			intlog.Print(`WebSocket connection closed for pong timeout`)
+			_ = c.CloseWithCode(WebSocketCloseGoingAway, `pong timeout`)
+			return
+		}
+		if err := c.Ping(); err != nil {
+			intlog.Errorf(`%+v`, err)
+			return
+		}
+	}
+}
+
+// wsToHttpURL converts the WebSocket scheme of `url` to the corresponding HTTP scheme.
+func wsToHttpURL(url string) string {
+	lowerURL := strings.ToLower(url)
+	switch {
+	case strings.HasPrefix(lowerURL, "ws://"):
+		return "http://" + url[len("ws://"):]
+	case strings.HasPrefix(lowerURL, "wss://"):
+		return "https://" + url[len("wss://"):]
+	}
+	return url
+}
+
+// headerContainsToken checks whether the comma separated header values contain `token` case-insensitively.
+func headerContainsToken(header http.Header, name, token string) bool {
+	for _, value := range header.Values(name) {
+		for _, item := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(item), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// containsString checks whether `array` contains `s`.
+func containsString(array []string, s string) bool {
+	for _, v := range array {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,186 @@
+package jclient
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"crypto/rand"
+	"encoding/binary"
+	"io"
+
+	"github.com/e7coding/coding-common/errs/jerr"
+)
+
+// WebSocket message types and control frame opcodes, refer to RFC 6455 section 11.8.
+const (
+	WebSocketContinuation = 0x0 // Continuation frame.
+	WebSocketText         = 0x1 // Text message.
+	WebSocketBinary       = 0x2 // Binary message.
+	WebSocketClose        = 0x8 // Close control frame.
+	WebSocketPing         = 0x9 // Ping control frame.
+	WebSocketPong         = 0xA // Pong control frame.
+)
+
+const (
+	wsFrameBitFin          = 0x80
+	wsFrameBitRsv1         = 0x40
+	wsFrameBitsRsv         = 0x70
+	wsFrameBitMask         = 0x80
+	wsFrameMaskOpcode      = 0x0F
+	wsFrameMaskPayloadLen  = 0x7F
+	wsFramePayloadLen16    = 126
+	wsFramePayloadLen64    = 127
+	wsFrameMaxControlSize  = 125
+	wsFrameMaxHeaderSize   = 14
+	wsDeflateTail          = "\x00\x00\xff\xff"
+	wsDeflateFinalBlock    = "\x01\x00\x00\xff\xff"
+	wsDeflateCompressLevel = flate.BestSpeed
+)
+
+// wsFrame is a single WebSocket frame.
+type wsFrame struct {
+	fin     bool   // Final fragment of a message.
+	rsv1    bool   // Compressed message, only set in the first fragment.
+	opcode  int    // Frame opcode.
+	payload []byte // Unmasked payload data.
+}
+
+// isControl checks whether the opcode is control frame opcode.
+func isWsControl(opcode int) bool {
+	return opcode >= WebSocketClose
+}
+
+// writeWsFrame encodes and writes the frame `f` to `w` with a random masking key,
+// as all frames sent from client to server must be masked.
+func writeWsFrame(w io.Writer, f *wsFrame) error {
+	var (
+		header = make([]byte, 2, wsFrameMaxHeaderSize)
+		length = len(f.payload)
+	)
+	header[0] = byte(f.opcode)
+	if f.fin {
+		header[0] |= wsFrameBitFin
+	}
+	if f.rsv1 {
+		header[0] |= wsFrameBitRsv1
+	}
+	switch {
+	case length <= wsFrameMaxControlSize:
+		header[1] = byte(length)
+	case length <= 0xFFFF:
+		header[1] = wsFramePayloadLen16
+		header = binary.BigEndian.AppendUint16(header, uint16(length))
+	default:
+		header[1] = wsFramePayloadLen64
+		header = binary.BigEndian.AppendUint64(header, uint64(length))
+	}
+	header[1] |= wsFrameBitMask
+	var maskKey [4]byte
+	if _, err := rand.Read(maskKey[:]); err != nil {
+		return jerr.WithMsgErr(err, `generate WebSocket masking key failed`)
+	}
+	header = append(header, maskKey[:]...)
+	buffer := make([]byte, len(header)+length)
+	copy(buffer, header)
+	copy(buffer[len(header):], f.payload)
+	maskWsPayload(maskKey, buffer[len(header):])
+	_, err := w.Write(buffer)
+	return err
+}
+
+// readWsFrame reads and decodes a frame from `r`.
+// The data frame is rejected before its payload is allocated if the payload length exceeds `limit`.
+func readWsFrame(r *bufio.Reader, limit int64) (*wsFrame, error) {
+	var header [2]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, err
+	}
+	f := &wsFrame{
+		fin:    header[0]&wsFrameBitFin != 0,
+		rsv1:   header[0]&wsFrameBitRsv1 != 0,
+		opcode: int(header[0] & wsFrameMaskOpcode),
+	}
+	if header[0]&wsFrameBitsRsv&^wsFrameBitRsv1 != 0 {
+		return nil, newWsProtocolError(`reserved bits are set`)
+	}
+	if header[1]&wsFrameBitMask != 0 {
+		return nil, newWsProtocolError(`frames from server must not be masked`)
+	}
+	length := uint64(header[1] & wsFrameMaskPayloadLen)
+	switch length {
+	case wsFramePayloadLen16:
+		var buffer [2]byte
+		if _, err := io.ReadFull(r, buffer[:]); err != nil {
+			return nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(buffer[:]))
+	case wsFramePayloadLen64:
+		var buffer [8]byte
+		if _, err := io.ReadFull(r, buffer[:]); err != nil {
+			return nil, err
+		}
+		length = binary.BigEndian.Uint64(buffer[:])
+	}
+	if f.rsv1 && (f.opcode == WebSocketContinuation || isWsControl(f.opcode)) {
+		// The compression bit is only set in the first frame of a data message.
+		return nil, newWsProtocolError(`unexpected compression bit`)
+	}
+	if isWsControl(f.opcode) {
+		if !f.fin || length > wsFrameMaxControlSize {
+			return nil, newWsProtocolError(`invalid control frame`)
+		}
+	} else if f.opcode != WebSocketContinuation && f.opcode != WebSocketText && f.opcode != WebSocketBinary {
+		return nil, newWsProtocolError(`unknown opcode`)
+	}
+	// Control frames are limited by wsFrameMaxControlSize, as they can be interleaved in a message.
+	if !isWsControl(f.opcode) && length > uint64(max(limit, 0)) {
+		return nil, &WebSocketCloseError{Code: WebSocketCloseMessageTooBig, Text: `message too big`}
+	}
+	f.payload = make([]byte, length)
+	if _, err := io.ReadFull(r, f.payload); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// maskWsPayload masks or unmasks the payload in place using `key`.
+func maskWsPayload(key [4]byte, payload []byte) {
+	for i := range payload {
+		payload[i] ^= key[i&3]
+	}
+}
+
+// compressWsMessage compresses the message for permessage-deflate extension,
+// in which the trailing empty block of the sync flush is removed.
+func compressWsMessage(data []byte) ([]byte, error) {
+	var buffer bytes.Buffer
+	writer, err := flate.NewWriter(&buffer, wsDeflateCompressLevel)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = writer.Write(data); err != nil {
+		return nil, err
+	}
+	if err = writer.Flush(); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buffer.Bytes(), []byte(wsDeflateTail)), nil
+}
+
+// decompressWsMessage decompresses the message for permessage-deflate extension.
+// The size of decompressed data is limited by `limit`.
+func decompressWsMessage(data []byte, limit int64) ([]byte, error) {
+	reader := flate.NewReader(io.MultiReader(
+		bytes.NewReader(data),
+		bytes.NewReader([]byte(wsDeflateTail+wsDeflateFinalBlock)),
+	))
+	defer reader.Close()
+	content, err := io.ReadAll(io.LimitReader(reader, limit+1))
+	if err != nil {
+		return nil, jerr.WithMsgErr(err, `decompress WebSocket message failed`)
+	}
+	if int64(len(content)) > limit {
+		return nil, &WebSocketCloseError{Code: WebSocketCloseMessageTooBig, Text: `message too big`}
+	}
+	return content, nil
+}
@@ -0,0 +1,149 @@
+// Package jproxyproto implements the PROXY protocol v1 and v2 of HAProxy, which passes the
+// original client address through proxies and load balancers.
+//
+// See https://www.haproxy.org/download/2.9/doc/proxy-protocol.txt.
+package jproxyproto
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net"
+
+	"github.com/e7coding/coding-common/errs/jerr"
+)
+
+// Command is the command of PROXY protocol header.
+type Command byte
+
+const (
+	// CommandLocal means the connection is established by the proxy itself, eg: for health checks.
+	// The addresses of the header should be ignored.
+	CommandLocal Command = 0x0
+	// CommandProxy means the connection is established on behalf of the client.
+	CommandProxy Command = 0x1
+)
+
+// TLV types of PROXY protocol v2.
+const (
+	TLVTypeALPN      = 0x01 // Application-Layer Protocol Negotiation.
+	TLVTypeAuthority = 0x02 // Host name of the client, eg: the SNI of TLS.
+	TLVTypeCRC32C    = 0x03 // CRC32c checksum of the header.
+	TLVTypeNoop      = 0x04 // Padding.
+	TLVTypeUniqueID  = 0x05 // Unique ID of the connection.
+	TLVTypeSSL       = 0x20 // SSL information.
+	TLVTypeNetNS     = 0x30 // Network namespace.
+)
+
+// Header is the PROXY protocol header.
+type Header struct {
+	// Version is the protocol version, which is 1 or 2.
+	Version int
+
+	// Command is the command of the header, which is always CommandProxy for version 1.
+	Command Command
+
+	// SourceAddr is the address of the original client, which is *net.TCPAddr, *net.UDPAddr,
+	// *net.UnixAddr, or nil if the address family is unspecified.
+	SourceAddr net.Addr
+
+	// DestAddr is the address that the client connects to, of the same type as SourceAddr.
+	DestAddr net.Addr
+
+	// TLVs is the additional information of version 2.
+	TLVs []TLV
+}
+
+// TLV is the Type-Length-Value extension of PROXY protocol v2.
+type TLV struct {
+	Type  byte
+	Value []byte
+}
+
+var (
+	// signatureV1 is the prefix of version 1 header.
+	signatureV1 = []byte("PROXY ")
+	// signatureV2 is the prefix of version 2 header.
+	signatureV2 = []byte("\r\n\r\n\x00\r\nQUIT\n")
+)
+
+// NewHeader creates and returns a header of `version` with CommandProxy for the connection from
+// `source` to `dest`, which should be both *net.TCPAddr, *net.UDPAddr or *net.UnixAddr.
+func NewHeader(version int, source, dest net.Addr) *Header {
+	return &Header{
+		Version:    version,
+		Command:    CommandProxy,
+		SourceAddr: source,
+		DestAddr:   dest,
+	}
+}
+
+// Read reads a header of version 1 or 2 from `reader`.
+// The data after the header is kept in `reader`.
+func Read(reader *bufio.Reader) (*Header, error) {
+	prefix, err := reader.Peek(len(signatureV1))
+	if err != nil {
+		return nil, jerr.WithMsgErr(err, `read proxy protocol header failed`)
+	}
+	if bytes.Equal(prefix, signatureV1) {
+		return readV1(reader)
+	}
+	if prefix, err = reader.Peek(len(signatureV2)); err == nil && bytes.Equal(prefix, signatureV2) {
+		return readV2(reader)
+	}
+	return nil, jerr.WithMsg(`invalid proxy protocol header signature`)
+}
+
+// Parse parses the header of version 2 at the beginning of datagram `data`, and returns the header
+// and the payload after it. Version 1 is not supported as it does not work with datagrams.
+func Parse(data []byte) (*Header, []byte, error) {
+	if !bytes.HasPrefix(data, signatureV2) {
+		return nil, nil, jerr.WithMsg(`invalid proxy protocol v2 header signature`)
+	}
+	reader := bytes.NewReader(data)
+	header, err := readV2(reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	return header, data[len(data)-reader.Len():], nil
+}
+
+// HasSignature checks whether `data` starts with a header of version 1 or 2.
+func HasSignature(data []byte) bool {
+	return bytes.HasPrefix(data, signatureV1) || bytes.HasPrefix(data, signatureV2)
+}
+
+// Bytes encodes the header.
+func (h *Header) Bytes() ([]byte, error) {
+	switch h.Version {
+	case 1:
+		return h.encodeV1()
+	case 2:
+		return h.encodeV2()
+	default:
+		return nil, jerr.WithMsgF(`invalid proxy protocol version %d`, h.Version)
+	}
+}
+
+// WriteTo writes the encoded header to `writer`, which implements interface io.WriterTo.
+func (h *Header) WriteTo(writer io.Writer) (int64, error) {
+	data, err := h.Bytes()
+	if err != nil {
+		return 0, err
+	}
+	n, err := writer.Write(data)
+	if err != nil {
+		err = jerr.WithMsgErr(err, `write proxy protocol header failed`)
+	}
+	return int64(n), err
+}
+
+// TLV returns the value of the first TLV of `tlvType` and whether it exists.
+func (h *Header) TLV(tlvType byte) ([]byte, bool) {
+	for _, tlv := range h.TLVs {
+		if tlv.Type == tlvType {
+			return tlv.Value, true
+		}
+	}
+	return nil, false
+}
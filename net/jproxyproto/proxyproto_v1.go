@@ -0,0 +1,99 @@
+package jproxyproto
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/e7coding/coding-common/errs/jerr"
+)
+
+// maxLengthV1 is the max length of version 1 header, including the trailing CRLF.
+const maxLengthV1 = 107
+
+// readV1 reads a version 1 header, eg: "PROXY TCP4 192.168.0.1 192.168.0.11 56324 443\r\n".
+func readV1(reader *bufio.Reader) (*Header, error) {
+	var line []byte
+	for {
+		b, err := reader.ReadByte()
+		if err != nil {
+			return nil, jerr.WithMsgErr(err, `read proxy protocol v1 header failed`)
+		}
+		line = append(line, b)
+		if b == '\n' {
+			break
+		}
+		if len(line) >= maxLengthV1 {
+			return nil, jerr.WithMsg(`proxy protocol v1 header too long`)
+		}
+	}
+	if !bytes.HasSuffix(line, []byte("\r\n")) {
+		return nil, jerr.WithMsg(`proxy protocol v1 header does not end with CRLF`)
+	}
+	var (
+		fields = strings.Split(string(line[:len(line)-2]), " ")
+		header = &Header{Version: 1, Command: CommandProxy}
+	)
+	if len(fields) < 2 {
+		return nil, jerr.WithMsgF(`invalid proxy protocol v1 header "%s"`, line)
+	}
+	switch fields[1] {
+	case "UNKNOWN":
+		// The receiver must ignore anything presented before the CRLF.
+		return header, nil
+	case "TCP4", "TCP6":
+	default:
+		return nil, jerr.WithMsgF(`invalid proxy protocol v1 protocol "%s"`, fields[1])
+	}
+	if len(fields) != 6 {
+		return nil, jerr.WithMsgF(`invalid proxy protocol v1 header "%s"`, line)
+	}
+	source, err := parseAddrV1(fields[1], fields[2], fields[4])
+	if err != nil {
+		return nil, err
+	}
+	dest, err := parseAddrV1(fields[1], fields[3], fields[5])
+	if err != nil {
+		return nil, err
+	}
+	header.SourceAddr, header.DestAddr = source, dest
+	return header, nil
+}
+
+// parseAddrV1 parses the address of version 1 header.
+func parseAddrV1(protocol, ip, port string) (*net.TCPAddr, error) {
+	parsedIP := net.ParseIP(ip)
+	if parsedIP == nil || (protocol == "TCP4") != (parsedIP.To4() != nil) {
+		return nil, jerr.WithMsgF(`invalid proxy protocol v1 %s address "%s"`, protocol, ip)
+	}
+	parsedPort, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return nil, jerr.WithMsgErrF(err, `invalid proxy protocol v1 port "%s"`, port)
+	}
+	return &net.TCPAddr{IP: parsedIP, Port: int(parsedPort)}, nil
+}
+
+// encodeV1 encodes the header of version 1, in which only TCP addresses are supported.
+// Any other addresses or CommandLocal are encoded as "UNKNOWN".
+func (h *Header) encodeV1() ([]byte, error) {
+	source, ok1 := h.SourceAddr.(*net.TCPAddr)
+	dest, ok2 := h.DestAddr.(*net.TCPAddr)
+	if h.Command == CommandLocal || !ok1 || !ok2 {
+		return []byte("PROXY UNKNOWN\r\n"), nil
+	}
+	var (
+		protocol = "TCP4"
+		sourceIP = source.IP.To4()
+		destIP   = dest.IP.To4()
+	)
+	if sourceIP == nil || destIP == nil {
+		protocol, sourceIP, destIP = "TCP6", source.IP.To16(), dest.IP.To16()
+	}
+	if sourceIP == nil || destIP == nil {
+		return nil, jerr.WithMsgF(`invalid proxy protocol v1 address "%s" or "%s"`, source, dest)
+	}
+	return []byte("PROXY " + protocol + " " + sourceIP.String() + " " + destIP.String() + " " +
+		strconv.Itoa(source.Port) + " " + strconv.Itoa(dest.Port) + "\r\n"), nil
+}
@@ -0,0 +1,232 @@
+package jproxyproto
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+
+	"github.com/e7coding/coding-common/errs/jerr"
+)
+
+// Address families and transport protocols of version 2 header.
+const (
+	familyUnspec = 0x0
+	familyInet   = 0x1
+	familyInet6  = 0x2
+	familyUnix   = 0x3
+
+	transportUnspec = 0x0
+	transportStream = 0x1
+	transportDgram  = 0x2
+)
+
+const (
+	headerSizeV2    = 16  // Size of the fixed part of version 2 header.
+	addrSizeInet    = 12  // Size of IPv4 addresses: source ip(4) + dest ip(4) + source port(2) + dest port(2).
+	addrSizeInet6   = 36  // Size of IPv6 addresses: source ip(16) + dest ip(16) + source port(2) + dest port(2).
+	addrSizeUnix    = 216 // Size of unix addresses: source path(108) + dest path(108).
+	unixPathSize    = 108 // Size of each unix path.
+	tlvHeaderSize   = 3   // Size of TLV header: type(1) + length(2).
+	versionV2       = 0x2 // Version in the high 4 bits of the 13th byte.
+	maxBlockSizeV2  = 0xFFFF
+	commandMaskV2   = 0x0F
+	versionShiftV2  = 4
+	familyShiftV2   = 4
+	transportMaskV2 = 0x0F
+)
+
+// readV2 reads a version 2 header.
+func readV2(reader io.Reader) (*Header, error) {
+	var fixed [headerSizeV2]byte
+	if _, err := io.ReadFull(reader, fixed[:]); err != nil {
+		return nil, jerr.WithMsgErr(err, `read proxy protocol v2 header failed`)
+	}
+	if !bytes.Equal(fixed[:len(signatureV2)], signatureV2) {
+		return nil, jerr.WithMsg(`invalid proxy protocol v2 header signature`)
+	}
+	if fixed[12]>>versionShiftV2 != versionV2 {
+		return nil, jerr.WithMsgF(`invalid proxy protocol v2 version %d`, fixed[12]>>versionShiftV2)
+	}
+	header := &Header{
+		Version: 2,
+		Command: Command(fixed[12] & commandMaskV2),
+	}
+	if header.Command != CommandLocal && header.Command != CommandProxy {
+		return nil, jerr.WithMsgF(`invalid proxy protocol v2 command %d`, header.Command)
+	}
+	block := make([]byte, binary.BigEndian.Uint16(fixed[14:]))
+	if _, err := io.ReadFull(reader, block); err != nil {
+		return nil, jerr.WithMsgErr(err, `read proxy protocol v2 addresses failed`)
+	}
+	var (
+		family    = fixed[13] >> familyShiftV2
+		transport = fixed[13] & transportMaskV2
+		addrSize  int
+	)
+	switch family {
+	case familyUnspec:
+		// The receiver must ignore the address information.
+		return header, nil
+	case familyInet:
+		addrSize = addrSizeInet
+	case familyInet6:
+		addrSize = addrSizeInet6
+	case familyUnix:
+		addrSize = addrSizeUnix
+	default:
+		return nil, jerr.WithMsgF(`invalid proxy protocol v2 address family %d`, family)
+	}
+	if transport != transportStream && transport != transportDgram {
+		return nil, jerr.WithMsgF(`invalid proxy protocol v2 transport protocol %d`, transport)
+	}
+	if len(block) < addrSize {
+		return nil, jerr.WithMsgF(`invalid proxy protocol v2 address length %d`, len(block))
+	}
+	header.SourceAddr, header.DestAddr = decodeAddrV2(family, transport, block[:addrSize])
+	tlvs, err := decodeTLVs(block[addrSize:])
+	if err != nil {
+		return nil, err
+	}
+	header.TLVs = tlvs
+	return header, nil
+}
+
+// decodeAddrV2 decodes the addresses of version 2 header.
+func decodeAddrV2(family, transport byte, data []byte) (source, dest net.Addr) {
+	if family == familyUnix {
+		network := "unix"
+		if transport == transportDgram {
+			network = "unixgram"
+		}
+		return &net.UnixAddr{Name: unixPath(data[:unixPathSize]), Net: network},
+			&net.UnixAddr{Name: unixPath(data[unixPathSize:]), Net: network}
+	}
+	var (
+		ipSize     = (len(data) - 4) / 2
+		sourceIP   = net.IP(append([]byte(nil), data[:ipSize]...))
+		destIP     = net.IP(append([]byte(nil), data[ipSize:2*ipSize]...))
+		sourcePort = int(binary.BigEndian.Uint16(data[2*ipSize:]))
+		destPort   = int(binary.BigEndian.Uint16(data[2*ipSize+2:]))
+	)
+	if transport == transportDgram {
+		return &net.UDPAddr{IP: sourceIP, Port: sourcePort}, &net.UDPAddr{IP: destIP, Port: destPort}
+	}
+	return &net.TCPAddr{IP: sourceIP, Port: sourcePort}, &net.TCPAddr{IP: destIP, Port: destPort}
+}
+
+// decodeTLVs decodes the TLVs after the addresses.
+func decodeTLVs(data []byte) ([]TLV, error) {
+	var tlvs []TLV
+	for len(data) > 0 {
+		if len(data) < tlvHeaderSize {
+			return nil, jerr.WithMsgF(`invalid proxy protocol v2 TLV length %d`, len(data))
+		}
+		length := int(binary.BigEndian.Uint16(data[1:]))
+		if len(data) < tlvHeaderSize+length {
+			return nil, jerr.WithMsgF(`invalid proxy protocol v2 TLV value length %d`, length)
+		}
+		tlvs = append(tlvs, TLV{
+			Type:  data[0],
+			Value: append([]byte(nil), data[tlvHeaderSize:tlvHeaderSize+length]...),
+		})
+		data = data[tlvHeaderSize+length:]
+	}
+	return tlvs, nil
+}
+
+// encodeV2 encodes the header of version 2.
+func (h *Header) encodeV2() ([]byte, error) {
+	if h.Command != CommandLocal && h.Command != CommandProxy {
+		return nil, jerr.WithMsgF(`invalid proxy protocol v2 command %d`, h.Command)
+	}
+	family, transport, addrs, err := encodeAddrV2(h.SourceAddr, h.DestAddr)
+	if err != nil {
+		return nil, err
+	}
+	block := addrs
+	for _, tlv := range h.TLVs {
+		if len(tlv.Value) > maxBlockSizeV2 {
+			return nil, jerr.WithMsgF(`proxy protocol v2 TLV value too long: %d`, len(tlv.Value))
+		}
+		block = append(block, tlv.Type, 0, 0)
+		binary.BigEndian.PutUint16(block[len(block)-2:], uint16(len(tlv.Value)))
+		block = append(block, tlv.Value...)
+	}
+	if len(block) > maxBlockSizeV2 {
+		return nil, jerr.WithMsgF(`proxy protocol v2 header too long: %d`, len(block))
+	}
+	data := make([]byte, headerSizeV2, headerSizeV2+len(block))
+	copy(data, signatureV2)
+	data[12] = versionV2<<versionShiftV2 | byte(h.Command)
+	data[13] = family<<familyShiftV2 | transport
+	binary.BigEndian.PutUint16(data[14:], uint16(len(block)))
+	return append(data, block...), nil
+}
+
+// encodeAddrV2 encodes the addresses of version 2 header, and returns the address family and
+// transport protocol. The family is unspecified if any address is nil.
+func encodeAddrV2(source, dest net.Addr) (family, transport byte, data []byte, err error) {
+	if source == nil || dest == nil {
+		return familyUnspec, transportUnspec, nil, nil
+	}
+	var sourceIP, destIP net.IP
+	var sourcePort, destPort int
+	switch s := source.(type) {
+	case *net.TCPAddr:
+		d, ok := dest.(*net.TCPAddr)
+		if !ok {
+			return 0, 0, nil, jerr.WithMsgF(`mismatched proxy protocol addresses %T and %T`, source, dest)
+		}
+		transport, sourceIP, destIP, sourcePort, destPort = transportStream, s.IP, d.IP, s.Port, d.Port
+
+	case *net.UDPAddr:
+		d, ok := dest.(*net.UDPAddr)
+		if !ok {
+			return 0, 0, nil, jerr.WithMsgF(`mismatched proxy protocol addresses %T and %T`, source, dest)
+		}
+		transport, sourceIP, destIP, sourcePort, destPort = transportDgram, s.IP, d.IP, s.Port, d.Port
+
+	case *net.UnixAddr:
+		d, ok := dest.(*net.UnixAddr)
+		if !ok {
+			return 0, 0, nil, jerr.WithMsgF(`mismatched proxy protocol addresses %T and %T`, source, dest)
+		}
+		if len(s.Name) > unixPathSize || len(d.Name) > unixPathSize {
+			return 0, 0, nil, jerr.WithMsg(`proxy protocol unix address too long`)
+		}
+		transport = transportStream
+		if s.Net == "unixgram" {
+			transport = transportDgram
+		}
+		data = make([]byte, addrSizeUnix)
+		copy(data, s.Name)
+		copy(data[unixPathSize:], d.Name)
+		return familyUnix, transport, data, nil
+
+	default:
+		return 0, 0, nil, jerr.WithMsgF(`unsupported proxy protocol address type %T`, source)
+	}
+	if sourceIP.To4() != nil && destIP.To4() != nil {
+		family, sourceIP, destIP = familyInet, sourceIP.To4(), destIP.To4()
+	} else {
+		family, sourceIP, destIP = familyInet6, sourceIP.To16(), destIP.To16()
+		if sourceIP == nil || destIP == nil {
+			return 0, 0, nil, jerr.WithMsgF(`invalid proxy protocol address "%s" or "%s"`, source, dest)
+		}
+	}
+	data = make([]byte, 0, addrSizeInet6)
+	data = append(data, sourceIP...)
+	data = append(data, destIP...)
+	data = binary.BigEndian.AppendUint16(data, uint16(sourcePort))
+	data = binary.BigEndian.AppendUint16(data, uint16(destPort))
+	return family, transport, data, nil
+}
+
+// unixPath returns the unix path of null-padded `data`.
+func unixPath(data []byte) string {
+	if i := bytes.IndexByte(data, 0); i >= 0 {
+		return string(data[:i])
+	}
+	return string(data)
+}
@@ -0,0 +1,278 @@
+package jtcp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+
+	"github.com/e7coding/coding-common/errs/jerr"
+)
+
+const (
+	defaultFrameMaxDataSize = 1 << 20 // Default max data size for codecs without header size limit.
+	lengthHeaderSizeMax     = 8       // Max header size of LengthCodec.
+)
+
+// Codec is the framing codec, which splits the data stream of connection into frames.
+type Codec interface {
+	// Encode returns the frame containing `data`.
+	Encode(data []byte) ([]byte, error)
+
+	// Decode reads a frame from `reader` and returns the data of the frame.
+	Decode(reader *bufio.Reader) ([]byte, error)
+}
+
+// LengthCodecOption is the option for LengthCodec.
+type LengthCodecOption struct {
+	// HeaderSize is the size of the length header in bytes, which is 1 to 8.
+	// It's 2 bytes in default.
+	HeaderSize int
+
+	// LittleEndian specifies the byte order of the length header, it is big endian in default.
+	LittleEndian bool
+
+	// LengthIncludesHeader specifies whether the length in header includes the header itself,
+	// which is used by some legacy device protocols.
+	LengthIncludesHeader bool
+
+	// MaxDataSize is the max data size in bytes for data length validation.
+	// If it's not manually set, it'll automatically be set correspondingly with the HeaderSize,
+	// but no more than 0x7FFFFFFF.
+	MaxDataSize int
+}
+
+// LengthCodec frames the data with a fixed-size length header.
+// The default option is the same as the simple package protocol of SendPkg/RecvPkg.
+type LengthCodec struct {
+	option LengthCodecOption
+}
+
+// VarintCodec frames the data with a varint length header, as the length-delimited messages of protobuf.
+type VarintCodec struct {
+	maxDataSize int
+}
+
+// DelimiterCodec frames the data with a trailing delimiter, eg: "\n" for line based protocols.
+// Note that the data should not contain the delimiter.
+type DelimiterCodec struct {
+	delimiter   []byte
+	maxDataSize int
+}
+
+// FixedLengthCodec frames the data with fixed length.
+type FixedLengthCodec struct {
+	length int
+}
+
+// NewLengthCodec creates and returns a LengthCodec.
+func NewLengthCodec(option ...LengthCodecOption) (*LengthCodec, error) {
+	var opt LengthCodecOption
+	if len(option) > 0 {
+		opt = option[0]
+	}
+	if opt.HeaderSize == 0 {
+		opt.HeaderSize = pkgHeaderSizeDefault
+	}
+	if opt.HeaderSize < 0 || opt.HeaderSize > lengthHeaderSizeMax {
+		return nil, jerr.WithMsgF(
+			`length header size %d definition exceeds max header size %d`,
+			opt.HeaderSize, lengthHeaderSizeMax,
+		)
+	}
+	maxDataSize := 0x7FFFFFFF
+	if opt.HeaderSize < 4 {
+		maxDataSize = 1<<(8*opt.HeaderSize) - 1
+	}
+	if opt.LengthIncludesHeader {
+		maxDataSize -= opt.HeaderSize
+	}
+	if opt.MaxDataSize == 0 {
+		opt.MaxDataSize = maxDataSize
+	}
+	if opt.MaxDataSize > maxDataSize {
+		return nil, jerr.WithMsgF(
+			`frame data size %d definition exceeds allowed max data size %d`,
+			opt.MaxDataSize, maxDataSize,
+		)
+	}
+	return &LengthCodec{option: opt}, nil
+}
+
+// Encode implements interface Codec.
+func (c *LengthCodec) Encode(data []byte) ([]byte, error) {
+	if len(data) > c.option.MaxDataSize {
+		return nil, jerr.WithMsgF(
+			`data too long, data size %d exceeds allowed max data size %d`,
+			len(data), c.option.MaxDataSize,
+		)
+	}
+	var (
+		length = uint64(len(data))
+		header [lengthHeaderSizeMax]byte
+		frame  = make([]byte, c.option.HeaderSize, c.option.HeaderSize+len(data))
+	)
+	if c.option.LengthIncludesHeader {
+		length += uint64(c.option.HeaderSize)
+	}
+	if c.option.LittleEndian {
+		binary.LittleEndian.PutUint64(header[:], length)
+		copy(frame, header[:c.option.HeaderSize])
+	} else {
+		binary.BigEndian.PutUint64(header[:], length)
+		copy(frame, header[lengthHeaderSizeMax-c.option.HeaderSize:])
+	}
+	return append(frame, data...), nil
+}
+
+// Decode implements interface Codec.
+func (c *LengthCodec) Decode(reader *bufio.Reader) ([]byte, error) {
+	var header [lengthHeaderSizeMax]byte
+	if c.option.LittleEndian {
+		if _, err := io.ReadFull(reader, header[:c.option.HeaderSize]); err != nil {
+			return nil, err
+		}
+	} else {
+		if _, err := io.ReadFull(reader, header[lengthHeaderSizeMax-c.option.HeaderSize:]); err != nil {
+			return nil, err
+		}
+	}
+	var length uint64
+	if c.option.LittleEndian {
+		length = binary.LittleEndian.Uint64(header[:])
+	} else {
+		length = binary.BigEndian.Uint64(header[:])
+	}
+	if c.option.LengthIncludesHeader {
+		if length < uint64(c.option.HeaderSize) {
+			return nil, jerr.WithMsgF(`invalid frame length %d less than header size`, length)
+		}
+		length -= uint64(c.option.HeaderSize)
+	}
+	return readFrameData(reader, length, c.option.MaxDataSize)
+}
+
+// NewVarintCodec creates and returns a VarintCodec.
+// The optional parameter `maxDataSize` specifies the max data size, which is 1MB in default.
+func NewVarintCodec(maxDataSize ...int) *VarintCodec {
+	c := &VarintCodec{maxDataSize: defaultFrameMaxDataSize}
+	if len(maxDataSize) > 0 && maxDataSize[0] > 0 {
+		c.maxDataSize = maxDataSize[0]
+	}
+	return c
+}
+
+// Encode implements interface Codec.
+func (c *VarintCodec) Encode(data []byte) ([]byte, error) {
+	if len(data) > c.maxDataSize {
+		return nil, jerr.WithMsgF(
+			`data too long, data size %d exceeds allowed max data size %d`,
+			len(data), c.maxDataSize,
+		)
+	}
+	frame := binary.AppendUvarint(make([]byte, 0, binary.MaxVarintLen64+len(data)), uint64(len(data)))
+	return append(frame, data...), nil
+}
+
+// Decode implements interface Codec.
+func (c *VarintCodec) Decode(reader *bufio.Reader) ([]byte, error) {
+	length, err := binary.ReadUvarint(reader)
+	if err != nil {
+		return nil, err
+	}
+	return readFrameData(reader, length, c.maxDataSize)
+}
+
+// NewDelimiterCodec creates and returns a DelimiterCodec with `delimiter`.
+// The optional parameter `maxDataSize` specifies the max data size, which is 1MB in default.
+func NewDelimiterCodec(delimiter []byte, maxDataSize ...int) (*DelimiterCodec, error) {
+	if len(delimiter) == 0 {
+		return nil, jerr.WithMsg(`empty delimiter for DelimiterCodec`)
+	}
+	c := &DelimiterCodec{
+		delimiter:   append([]byte(nil), delimiter...),
+		maxDataSize: defaultFrameMaxDataSize,
+	}
+	if len(maxDataSize) > 0 && maxDataSize[0] > 0 {
+		c.maxDataSize = maxDataSize[0]
+	}
+	return c, nil
+}
+
+// Encode implements interface Codec.
+func (c *DelimiterCodec) Encode(data []byte) ([]byte, error) {
+	if len(data) > c.maxDataSize {
+		return nil, jerr.WithMsgF(
+			`data too long, data size %d exceeds allowed max data size %d`,
+			len(data), c.maxDataSize,
+		)
+	}
+	if bytes.Contains(data, c.delimiter) {
+		return nil, jerr.WithMsg(`data contains the delimiter`)
+	}
+	frame := make([]byte, 0, len(data)+len(c.delimiter))
+	frame = append(frame, data...)
+	return append(frame, c.delimiter...), nil
+}
+
+// Decode implements interface Codec.
+// The returned data does not contain the delimiter.
+func (c *DelimiterCodec) Decode(reader *bufio.Reader) ([]byte, error) {
+	var (
+		last = c.delimiter[len(c.delimiter)-1]
+		data []byte
+	)
+	for {
+		line, err := reader.ReadSlice(last)
+		data = append(data, line...)
+		if err == nil && bytes.HasSuffix(data, c.delimiter) {
+			return data[:len(data)-len(c.delimiter)], nil
+		}
+		if len(data) > c.maxDataSize+len(c.delimiter) {
+			return nil, jerr.WithMsgF(`invalid frame size exceeds allowed max data size %d`, c.maxDataSize)
+		}
+		if err != nil && err != bufio.ErrBufferFull {
+			if err == io.EOF && len(data) > 0 {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+	}
+}
+
+// NewFixedLengthCodec creates and returns a FixedLengthCodec with frame `length`.
+func NewFixedLengthCodec(length int) (*FixedLengthCodec, error) {
+	if length <= 0 {
+		return nil, jerr.WithMsgF(`invalid fixed frame length %d`, length)
+	}
+	return &FixedLengthCodec{length: length}, nil
+}
+
+// Encode implements interface Codec.
+// The data must be exactly the fixed length.
+func (c *FixedLengthCodec) Encode(data []byte) ([]byte, error) {
+	if len(data) != c.length {
+		return nil, jerr.WithMsgF(`data size %d does not match fixed frame length %d`, len(data), c.length)
+	}
+	return data, nil
+}
+
+// Decode implements interface Codec.
+func (c *FixedLengthCodec) Decode(reader *bufio.Reader) ([]byte, error) {
+	return readFrameData(reader, uint64(c.length), c.length)
+}
+
+// readFrameData reads the frame data of `length`, which is validated using `maxDataSize`.
+func readFrameData(reader *bufio.Reader, length uint64, maxDataSize int) ([]byte, error) {
+	if length > uint64(maxDataSize) {
+		return nil, jerr.WithMsgF(`invalid frame size %d`, length)
+	}
+	data := make([]byte, length)
+	if _, err := io.ReadFull(reader, data); err != nil {
+		if err == io.EOF && length > 0 {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return data, nil
+}
@@ -9,8 +9,10 @@ package jtcp
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"crypto/tls"
 	"github.com/e7coding/coding-common/errs/jerr"
+	"github.com/e7coding/coding-common/net/jproxyproto"
 	"io"
 	"net"
 	"time"
@@ -18,11 +20,15 @@ import (
 
 // Conn is the TCP connection object.
 type Conn struct {
-	net.Conn                     // Underlying TCP connection object.
-	reader         *bufio.Reader // Buffer reader for connection.
-	deadlineRecv   time.Time     // Timeout point for reading.
-	deadlineSend   time.Time     // Timeout point for writing.
-	bufferWaitRecv time.Duration // Interval duration for reading buffer.
+	net.Conn                           // Underlying TCP connection object.
+	reader         *bufio.Reader       // Buffer reader for connection.
+	deadlineRecv   time.Time           // Timeout point for reading.
+	deadlineSend   time.Time           // Timeout point for writing.
+	bufferWaitRecv time.Duration       // Interval duration for reading buffer.
+	recvTimeout    time.Duration       // Timeout for each receiving if no deadline is set.
+	ctx            context.Context     // Context of the connection, which is done if the server shuts down.
+	cancel         context.CancelFunc  // Cancel function of ctx.
+	proxyHeader    *jproxyproto.Header // PROXY protocol header of the connection accepted by Server.
 }
 
 const (
@@ -33,7 +39,7 @@ const (
 // NewConn creates and returns a new connection with given address.
 func NewConn(addr string, timeout ...time.Duration) (*Conn, error) {
 	if conn, err := NewNetConn(addr, timeout...); err == nil {
-		return NewConnByNetConn(conn), nil
+		return NewConnByNetConn(newObservedClientConn(conn, addr)), nil
 	} else {
 		return nil, err
 	}
@@ -43,7 +49,7 @@ func NewConn(addr string, timeout ...time.Duration) (*Conn, error) {
 // with given address and TLS configuration.
 func NewConnTLS(addr string, tlsConfig *tls.Config) (*Conn, error) {
 	if conn, err := NewNetConnTLS(addr, tlsConfig); err == nil {
-		return NewConnByNetConn(conn), nil
+		return NewConnByNetConn(newObservedClientConn(conn, addr)), nil
 	} else {
 		return nil, err
 	}
@@ -53,7 +59,7 @@ func NewConnTLS(addr string, tlsConfig *tls.Config) (*Conn, error) {
 // with given address and TLS certificate and key files.
 func NewConnKeyCrt(addr, crtFile, keyFile string) (*Conn, error) {
 	if conn, err := NewNetConnKeyCrt(addr, crtFile, keyFile); err == nil {
-		return NewConnByNetConn(conn), nil
+		return NewConnByNetConn(newObservedClientConn(conn, addr)), nil
 	} else {
 		return nil, err
 	}
@@ -61,13 +67,35 @@ func NewConnKeyCrt(addr, crtFile, keyFile string) (*Conn, error) {
 
 // NewConnByNetConn creates and returns a TCP connection object with given net.Conn object.
 func NewConnByNetConn(conn net.Conn) *Conn {
-	return &Conn{
+	c := &Conn{
 		Conn:           conn,
 		reader:         bufio.NewReader(conn),
 		deadlineRecv:   time.Time{},
 		deadlineSend:   time.Time{},
 		bufferWaitRecv: receiveAllWaitTimeout,
 	}
+	// The spans of the observed connection are children of the connection span.
+	if observed, ok := conn.(*observedConn); ok {
+		c.ctx = observed.ctx
+	}
+	return c
+}
+
+// Context returns the context of the connection.
+// For the connection accepted by Server, the context is done if the server is shutting down
+// or the handler returns, which the handler can use to stop processing gracefully.
+// If observability is enabled, the context carries the span of the connection.
+func (c *Conn) Context() context.Context {
+	if c.ctx == nil {
+		return context.Background()
+	}
+	return c.ctx
+}
+
+// SetRecvTimeout sets the timeout for each receiving operation, which takes effect only if
+// no deadline is set using SetDeadline or SetDeadlineRecv.
+func (c *Conn) SetRecvTimeout(timeout time.Duration) {
+	c.recvTimeout = timeout
 }
 
 // Send writes data to remote address.
@@ -113,6 +141,14 @@ func (c *Conn) Recv(length int, retry ...Retry) ([]byte, error) {
 		buffer     []byte // Buffer object.
 		bufferWait bool   // Whether buffer reading timeout set.
 	)
+	if c.recvTimeout > 0 && c.deadlineRecv.IsZero() {
+		if err = c.SetDeadlineRecv(time.Now().Add(c.recvTimeout)); err != nil {
+			return nil, err
+		}
+		defer func() {
+			_ = c.SetDeadlineRecv(time.Time{})
+		}()
+	}
 	if length > 0 {
 		buffer = make([]byte, length)
 	} else {
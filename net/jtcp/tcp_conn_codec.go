@@ -0,0 +1,49 @@
+package jtcp
+
+import (
+	"time"
+)
+
+// ReadFrame reads a frame from the connection using `codec` and returns the data of the frame.
+func (c *Conn) ReadFrame(codec Codec) (data []byte, err error) {
+	if c.recvTimeout > 0 && c.deadlineRecv.IsZero() {
+		if err = c.SetDeadlineRecv(time.Now().Add(c.recvTimeout)); err != nil {
+			return nil, err
+		}
+		defer func() {
+			_ = c.SetDeadlineRecv(time.Time{})
+		}()
+	}
+	return codec.Decode(c.reader)
+}
+
+// WriteFrame encodes `data` into a frame using `codec` and writes it to the connection.
+func (c *Conn) WriteFrame(codec Codec, data []byte, retry ...Retry) error {
+	frame, err := codec.Encode(data)
+	if err != nil {
+		return err
+	}
+	return c.Send(frame, retry...)
+}
+
+// ReadFrameWithTimeout reads a frame from the connection using `codec` with timeout.
+func (c *Conn) ReadFrameWithTimeout(codec Codec, timeout time.Duration) (data []byte, err error) {
+	if err = c.SetDeadlineRecv(time.Now().Add(timeout)); err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = c.SetDeadlineRecv(time.Time{})
+	}()
+	return c.ReadFrame(codec)
+}
+
+// WriteFrameWithTimeout writes a frame of `data` to the connection using `codec` with timeout.
+func (c *Conn) WriteFrameWithTimeout(codec Codec, data []byte, timeout time.Duration, retry ...Retry) (err error) {
+	if err = c.SetDeadlineSend(time.Now().Add(timeout)); err != nil {
+		return err
+	}
+	defer func() {
+		_ = c.SetDeadlineSend(time.Time{})
+	}()
+	return c.WriteFrame(codec, data, retry...)
+}
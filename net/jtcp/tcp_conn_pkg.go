@@ -7,8 +7,10 @@
 package jtcp
 
 import (
+	"context"
 	"encoding/binary"
 	"github.com/e7coding/coding-common/errs/jerr"
+	"go.opentelemetry.io/otel/trace"
 	"time"
 )
 
@@ -31,6 +33,12 @@ type PkgOption struct {
 
 	// Retry policy when operation fails.
 	Retry Retry
+
+	// Tracing specifies whether the trace context is propagated inside each package, which is
+	// injected from the context of sending using jtrace.Carrier, and extracted by RecvPkgCtx.
+	// The package is: DataLength|CarrierLength(16bit)|Carrier(JSON)|DataField, and the DataLength
+	// contains the carrier, so both sides should use the same value.
+	Tracing bool
 }
 
 // SendPkg send data using simple package protocol.
@@ -41,10 +49,21 @@ type PkgOption struct {
 // 1. The DataLength is the length of DataField, which does not contain the header size.
 // 2. The integer bytes of the package are encoded using BigEndian order.
 func (c *Conn) SendPkg(data []byte, option ...PkgOption) error {
+	return c.SendPkgCtx(c.Context(), data, option...)
+}
+
+// SendPkgCtx is the same as SendPkg, but it propagates the trace context of `ctx` inside the
+// package if PkgOption.Tracing is enabled.
+func (c *Conn) SendPkgCtx(ctx context.Context, data []byte, option ...PkgOption) error {
 	pkgOption, err := getPkgOption(option...)
 	if err != nil {
 		return err
 	}
+	if pkgOption.Tracing {
+		if data, err = injectPkgCarrier(ctx, data); err != nil {
+			return err
+		}
+	}
 	length := len(data)
 	if length > pkgOption.MaxDataSize {
 		return jerr.WithMsgF(
@@ -76,32 +95,68 @@ func (c *Conn) SendPkgWithTimeout(data []byte, timeout time.Duration, option ...
 
 // SendRecvPkg writes data to connection and blocks reading response using simple package protocol.
 func (c *Conn) SendRecvPkg(data []byte, option ...PkgOption) ([]byte, error) {
-	if err := c.SendPkg(data, option...); err == nil {
-		return c.RecvPkg(option...)
-	} else {
-		return nil, err
-	}
+	return c.SendRecvPkgCtx(c.Context(), data, option...)
+}
+
+// SendRecvPkgCtx is the same as SendRecvPkg, but the round trip span is the child of `ctx` if
+// observability is enabled, and the trace context is propagated if PkgOption.Tracing is enabled.
+func (c *Conn) SendRecvPkgCtx(ctx context.Context, data []byte, option ...PkgOption) ([]byte, error) {
+	return c.sendRecvPkg(ctx, data, 0, option...)
 }
 
 // SendRecvPkgWithTimeout writes data to connection and reads response with timeout using simple package protocol.
 func (c *Conn) SendRecvPkgWithTimeout(data []byte, timeout time.Duration, option ...PkgOption) ([]byte, error) {
-	if err := c.SendPkg(data, option...); err == nil {
-		return c.RecvPkgWithTimeout(timeout, option...)
-	} else {
+	return c.sendRecvPkg(c.Context(), data, timeout, option...)
+}
+
+// sendRecvPkg writes data to connection and reads response using simple package protocol,
+// it reads with timeout if `timeout` > 0.
+func (c *Conn) sendRecvPkg(
+	ctx context.Context, data []byte, timeout time.Duration, option ...PkgOption,
+) (result []byte, err error) {
+	if IsObservabilityEnabled() {
+		var span trace.Span
+		ctx, span = startSendRecvPkgSpan(ctx, c, data)
+		defer func() {
+			endSendRecvPkgSpan(span, result, err)
+		}()
+	}
+	if err = c.SendPkgCtx(ctx, data, option...); err != nil {
 		return nil, err
 	}
+	if timeout > 0 {
+		return c.RecvPkgWithTimeout(timeout, option...)
+	}
+	return c.RecvPkg(option...)
 }
 
 // RecvPkg receives data from connection using simple package protocol.
 func (c *Conn) RecvPkg(option ...PkgOption) (result []byte, err error) {
+	_, result, err = c.RecvPkgCtx(option...)
+	return
+}
+
+// RecvPkgCtx is the same as RecvPkg, but it also returns the context carrying the trace context
+// propagated inside the package if PkgOption.Tracing is enabled, which is derived from Conn.Context.
+// The handler can use the returned context to create the spans as children of the remote span.
+func (c *Conn) RecvPkgCtx(option ...PkgOption) (ctx context.Context, result []byte, err error) {
+	ctx = c.Context()
+	pkgOption, err := getPkgOption(option...)
+	if err != nil {
+		return ctx, nil, err
+	}
+	if result, err = c.recvPkg(pkgOption); err != nil || !pkgOption.Tracing {
+		return ctx, result, err
+	}
+	return extractPkgCarrier(ctx, result)
+}
+
+// recvPkg receives the package data from connection using simple package protocol.
+func (c *Conn) recvPkg(pkgOption *PkgOption) (result []byte, err error) {
 	var (
 		buffer []byte
 		length int
 	)
-	pkgOption, err := getPkgOption(option...)
-	if err != nil {
-		return nil, err
-	}
 	// Header field.
 	buffer, err = c.Recv(pkgOption.HeaderSize, pkgOption.Retry)
 	if err != nil {
@@ -10,6 +10,7 @@ import (
 	"crypto/rand"
 	"crypto/tls"
 	"github.com/e7coding/coding-common/errs/jerr"
+	"github.com/e7coding/coding-common/internal/unixsock"
 	"net"
 	"time"
 
@@ -27,17 +28,18 @@ type Retry struct {
 	Interval time.Duration // Retry interval.
 }
 
-// NewNetConn creates and returns a net.Conn with given address like "127.0.0.1:80".
+// NewNetConn creates and returns a net.Conn with given address like "127.0.0.1:80",
+// or unix domain socket address like "unix:///var/run/app.sock".
 // The optional parameter `timeout` specifies the timeout for dialing connection.
 func NewNetConn(address string, timeout ...time.Duration) (net.Conn, error) {
 	var (
-		network  = `tcp`
-		duration = defaultConnTimeout
+		network, addr = unixsock.Parse(address, `tcp`)
+		duration      = defaultConnTimeout
 	)
 	if len(timeout) > 0 {
 		duration = timeout[0]
 	}
-	conn, err := net.DialTimeout(network, address, duration)
+	conn, err := net.DialTimeout(network, addr, duration)
 	if err != nil {
 		err = jerr.WithMsgErrF(
 			err,
@@ -48,19 +50,20 @@ func NewNetConn(address string, timeout ...time.Duration) (net.Conn, error) {
 	return conn, err
 }
 
-// NewNetConnTLS creates and returns a TLS net.Conn with given address like "127.0.0.1:80".
+// NewNetConnTLS creates and returns a TLS net.Conn with given address like "127.0.0.1:80",
+// or unix domain socket address like "unix:///var/run/app.sock".
 // The optional parameter `timeout` specifies the timeout for dialing connection.
 func NewNetConnTLS(address string, tlsConfig *tls.Config, timeout ...time.Duration) (net.Conn, error) {
 	var (
-		network = `tcp`
-		dialer  = &net.Dialer{
+		network, addr = unixsock.Parse(address, `tcp`)
+		dialer        = &net.Dialer{
 			Timeout: defaultConnTimeout,
 		}
 	)
 	if len(timeout) > 0 {
 		dialer.Timeout = timeout[0]
 	}
-	conn, err := tls.DialWithDialer(dialer, network, address, tlsConfig)
+	conn, err := tls.DialWithDialer(dialer, network, addr, tlsConfig)
 	if err != nil {
 		err = jerr.WithMsgErrF(
 			err,
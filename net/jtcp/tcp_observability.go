@@ -0,0 +1,302 @@
+package jtcp
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/e7coding/coding-common"
+	"github.com/e7coding/coding-common/container/jatomic"
+	"github.com/e7coding/coding-common/internal/intlog"
+	"github.com/e7coding/coding-common/net/jtrace"
+)
+
+const (
+	instrumentName               = "github.com/e7coding/coding-common/net/jtcp"
+	tracingSpanServerConn        = "jtcp.Server.Conn"
+	tracingSpanClientConn        = "jtcp.Conn"
+	tracingSpanSendRecvPkg       = "jtcp.SendRecvPkg"
+	tracingAttrNetAddressRemote  = "net.address.remote"
+	tracingAttrNetAddressLocal   = "net.address.local"
+	tracingAttrBytesReceived     = "net.bytes.received"
+	tracingAttrBytesSent         = "net.bytes.sent"
+	tracingAttrPkgRequestSize    = "jtcp.pkg.request.size"
+	tracingAttrPkgResponseSize   = "jtcp.pkg.response.size"
+	tracingEventHandlerPanic     = "jtcp.handler.panic"
+	metricAttrConnSide           = "connection.side"
+	metricAttrServerAddress      = "server.address"
+	metricAttrIODirection        = "network.io.direction"
+	metricAttrErrorType          = "error.type"
+	metricConnSideServer         = "server"
+	metricConnSideClient         = "client"
+	metricIODirectionReceive     = "receive"
+	metricIODirectionTransmit    = "transmit"
+	metricErrorTypeAccept        = "accept"
+	metricErrorTypeProxyProtocol = "proxy_protocol"
+	metricUnitBytes              = "By"
+)
+
+var (
+	// observabilityEnabled specifies whether the observability feature is enabled.
+	observabilityEnabled = jatomic.NewBool()
+
+	// globalMetrics is lazily initialized as the meter provider
+	// might be configured after package initialization.
+	globalMetrics     *tcpMetrics
+	globalMetricsOnce sync.Once
+)
+
+// tcpMetrics holds all the instruments that the package records metrics with.
+type tcpMetrics struct {
+	connActive    metric.Int64UpDownCounter // Count of the open connections.
+	ioBytes       metric.Int64Counter       // Bytes received and sent by the connections.
+	acceptErrors  metric.Int64Counter       // Count of the errors accepting connections by server.
+	handlerPanics metric.Int64Counter       // Count of the panics of server handlers.
+}
+
+// observedConn is a net.Conn that records the spans and metrics of the connection.
+type observedConn struct {
+	net.Conn
+	ctx      context.Context      // Context of the connection span.
+	span     trace.Span           // Span of the connection lifetime.
+	attrs    []attribute.KeyValue // Common metric attributes of the connection.
+	metrics  *tcpMetrics          // Instruments of the package.
+	received *jatomic.Int64       // Total bytes received.
+	sent     *jatomic.Int64       // Total bytes sent.
+	once     sync.Once            // Ensures the span ends once.
+	ioAttrs  [2]metric.AddOption  // Metric options of receive and transmit directions.
+}
+
+// SetObservability enables or disables the OpenTelemetry instrumentation of the package, which is
+// disabled in default. It takes effect for the servers and connections created after it's called.
+//
+// If it's enabled:
+//  1. Each connection records a span for its lifetime, and the span of the connection accepted by
+//     Server is in the context of Conn.Context, so that the handler spans are its children.
+//  2. Each Conn.SendRecvPkg records a span for the round trip.
+//  3. The metrics of bytes in/out, active connections, accept errors and handler panics are recorded.
+//  4. The handler panic of Server is recorded, and the connection is closed before it's panicked again.
+//
+// The spans and metrics are exported by the providers set by otel.SetTracerProvider and
+// otel.SetMeterProvider. See PkgOption.Tracing for the trace context propagation.
+func SetObservability(enabled bool) {
+	observabilityEnabled.Set(enabled)
+}
+
+// IsObservabilityEnabled checks and returns whether the observability feature is enabled.
+func IsObservabilityEnabled() bool {
+	return observabilityEnabled.Val()
+}
+
+// getTracer returns the tracer of the package.
+func getTracer() trace.Tracer {
+	return otel.GetTracerProvider().Tracer(
+		instrumentName,
+		trace.WithInstrumentationVersion(gf.VERSION),
+	)
+}
+
+// getMetrics creates if necessary and returns the instruments of the package.
+func getMetrics() *tcpMetrics {
+	globalMetricsOnce.Do(func() {
+		globalMetrics = newTcpMetrics(otel.GetMeterProvider().Meter(
+			instrumentName,
+			metric.WithInstrumentationVersion(gf.VERSION),
+		))
+	})
+	return globalMetrics
+}
+
+// newTcpMetrics creates and returns the instruments using given meter.
+// Any failed instrument creation is logged internally and the instrument is skipped in recording.
+func newTcpMetrics(meter metric.Meter) *tcpMetrics {
+	var (
+		err error
+		m   = &tcpMetrics{}
+	)
+	if m.connActive, err = meter.Int64UpDownCounter(
+		"tcp.connection.active",
+		metric.WithDescription("Count of the open TCP connections."),
+	); err != nil {
+		intlog.Errorf(`%+v`, err)
+	}
+	if m.ioBytes, err = meter.Int64Counter(
+		"tcp.io",
+		metric.WithUnit(metricUnitBytes),
+		metric.WithDescription("Bytes received and sent by the TCP connections."),
+	); err != nil {
+		intlog.Errorf(`%+v`, err)
+	}
+	if m.acceptErrors, err = meter.Int64Counter(
+		"tcp.server.accept.errors",
+		metric.WithDescription("Count of the errors accepting TCP connections by server."),
+	); err != nil {
+		intlog.Errorf(`%+v`, err)
+	}
+	if m.handlerPanics, err = meter.Int64Counter(
+		"tcp.server.handler.panics",
+		metric.WithDescription("Count of the panics of TCP server handlers."),
+	); err != nil {
+		intlog.Errorf(`%+v`, err)
+	}
+	return m
+}
+
+// recordAcceptError records the error accepting connection by the server of `address`.
+func (m *tcpMetrics) recordAcceptError(address, errorType string) {
+	if m.acceptErrors != nil {
+		m.acceptErrors.Add(context.Background(), 1, metric.WithAttributes(
+			attribute.String(metricAttrServerAddress, address),
+			attribute.String(metricAttrErrorType, errorType),
+		))
+	}
+}
+
+// newObservedConn creates and returns an observedConn, which starts the span of `conn` with
+// parent `ctx`. The parameter `side` is metricConnSideServer or metricConnSideClient, and
+// `address` is the server address.
+func newObservedConn(ctx context.Context, conn net.Conn, side, address string) *observedConn {
+	var (
+		spanName = tracingSpanClientConn
+		spanKind = trace.SpanKindClient
+	)
+	if side == metricConnSideServer {
+		spanName, spanKind = tracingSpanServerConn, trace.SpanKindServer
+	}
+	ctx, span := getTracer().Start(ctx, spanName, trace.WithSpanKind(spanKind))
+	span.SetAttributes(jtrace.CommonLabels()...)
+	span.SetAttributes(
+		attribute.String(tracingAttrNetAddressRemote, conn.RemoteAddr().String()),
+		attribute.String(tracingAttrNetAddressLocal, conn.LocalAddr().String()),
+	)
+	c := &observedConn{
+		Conn:     conn,
+		ctx:      ctx,
+		span:     span,
+		metrics:  getMetrics(),
+		received: jatomic.NewInt64(),
+		sent:     jatomic.NewInt64(),
+		attrs: []attribute.KeyValue{
+			attribute.String(metricAttrConnSide, side),
+			attribute.String(metricAttrServerAddress, address),
+		},
+	}
+	c.ioAttrs[0] = metric.WithAttributes(append(
+		c.attrs, attribute.String(metricAttrIODirection, metricIODirectionReceive),
+	)...)
+	c.ioAttrs[1] = metric.WithAttributes(append(
+		c.attrs, attribute.String(metricAttrIODirection, metricIODirectionTransmit),
+	)...)
+	if c.metrics.connActive != nil {
+		c.metrics.connActive.Add(ctx, 1, metric.WithAttributes(c.attrs...))
+	}
+	return c
+}
+
+// Read implements interface io.Reader.
+func (c *observedConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if n > 0 {
+		c.received.Add(int64(n))
+		if c.metrics.ioBytes != nil {
+			c.metrics.ioBytes.Add(c.ctx, int64(n), c.ioAttrs[0])
+		}
+	}
+	return n, err
+}
+
+// Write implements interface io.Writer.
+func (c *observedConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	if n > 0 {
+		c.sent.Add(int64(n))
+		if c.metrics.ioBytes != nil {
+			c.metrics.ioBytes.Add(c.ctx, int64(n), c.ioAttrs[1])
+		}
+	}
+	return n, err
+}
+
+// Close implements interface io.Closer, which ends the span of the connection.
+func (c *observedConn) Close() error {
+	err := c.Conn.Close()
+	c.once.Do(func() {
+		if c.metrics.connActive != nil {
+			c.metrics.connActive.Add(c.ctx, -1, metric.WithAttributes(c.attrs...))
+		}
+		c.span.SetAttributes(
+			attribute.Int64(tracingAttrBytesReceived, c.received.Load()),
+			attribute.Int64(tracingAttrBytesSent, c.sent.Load()),
+		)
+		c.span.End()
+	})
+	return err
+}
+
+// recordPanic records the panic of the server handler, it does nothing if `c` is nil.
+func (c *observedConn) recordPanic(exception interface{}) {
+	if c == nil {
+		return
+	}
+	if c.metrics.handlerPanics != nil {
+		c.metrics.handlerPanics.Add(c.ctx, 1, metric.WithAttributes(c.attrs...))
+	}
+	c.span.AddEvent(tracingEventHandlerPanic)
+	c.span.SetStatus(codes.Error, fmt.Sprintf(`%+v`, exception))
+}
+
+// newObservedClientConn wraps the client connection `conn` to `address` with observability if
+// it's enabled.
+func newObservedClientConn(conn net.Conn, address string) net.Conn {
+	if !IsObservabilityEnabled() {
+		return conn
+	}
+	return newObservedConn(context.Background(), conn, metricConnSideClient, address)
+}
+
+// startSendRecvPkgSpan starts the span of SendRecvPkg round trip of connection `c`.
+func startSendRecvPkgSpan(ctx context.Context, c *Conn, data []byte) (context.Context, trace.Span) {
+	ctx, span := getTracer().Start(ctx, tracingSpanSendRecvPkg, trace.WithSpanKind(trace.SpanKindClient))
+	span.SetAttributes(
+		attribute.String(tracingAttrNetAddressRemote, c.RemoteAddr().String()),
+		attribute.Int(tracingAttrPkgRequestSize, len(data)),
+	)
+	return ctx, span
+}
+
+// endSendRecvPkgSpan ends the span of SendRecvPkg round trip with its result.
+func endSendRecvPkgSpan(span trace.Span, result []byte, err error) {
+	if err != nil {
+		span.SetStatus(codes.Error, fmt.Sprintf(`%+v`, err))
+	} else {
+		span.SetAttributes(attribute.Int(tracingAttrPkgResponseSize, len(result)))
+	}
+	span.End()
+}
+
+// injectPkgCarrier injects the trace context of `ctx` into the package data using the carrier frame:
+// CarrierSize(16bit)|Carrier(JSON)|Data.
+func injectPkgCarrier(ctx context.Context, data []byte) ([]byte, error) {
+	buffer, err := jtrace.InjectCarrier(ctx).AppendFrame(nil)
+	if err != nil {
+		return nil, err
+	}
+	return append(buffer, data...), nil
+}
+
+// extractPkgCarrier extracts the trace context from the package data injected by injectPkgCarrier,
+// and returns the context derived from `ctx` with the remote span context and the data.
+func extractPkgCarrier(ctx context.Context, data []byte) (context.Context, []byte, error) {
+	carrier, data, err := jtrace.ParseCarrierFrame(data)
+	if err != nil {
+		return ctx, nil, err
+	}
+	return jtrace.ExtractCarrier(ctx, carrier), data, nil
+}
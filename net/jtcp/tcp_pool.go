@@ -7,16 +7,21 @@
 package jtcp
 
 import (
+	"context"
+	"github.com/e7coding/coding-common/container/jatomic"
 	"github.com/e7coding/coding-common/container/jmap"
 	"time"
 )
 
-// PoolConn is a connection with pool feature for TCP.
-// Note that it is NOT a pool or connection manager, it is just a TCP connection object.
+// PoolConn is a connection borrowed from Pool for TCP.
+// It should be returned to the pool by Close after use.
 type PoolConn struct {
-	*Conn // Underlying connection object.
-	// pool   *gpool.Pool // Connection pool, which is not a real connection pool, but a connection reusable pool.
-	status int // Status of current connection, which is used to mark this connection usable or not.
+	*Conn                   // Underlying connection object.
+	pool      *Pool         // Connection pool that the connection belongs to.
+	status    int           // Status of current connection, which is used to mark this connection usable or not.
+	createdAt time.Time     // Creation time of the underlying connection, for MaxLifetime checks.
+	reused    bool          // Whether the connection has been returned to the pool before.
+	borrowed  *jatomic.Bool // Whether the connection is borrowed and not returned yet, so that Close returns it only once.
 }
 
 const defaultPoolExpire = 10 * time.Second // Default TTL for connection in the pool.
@@ -33,37 +38,34 @@ var (
 )
 
 // NewPoolConn creates and returns a connection with pool feature.
+// It borrows the connection from the default pool of `addr`, whose idle connections expire
+// in 10 seconds. Use NewPool for a configurable pool.
 func NewPoolConn(addr string, timeout ...time.Duration) (*PoolConn, error) {
-	//v := addressPoolMap.GetOrPutFunc(addr, func() interface{} {
-	//	var pool *gpool.Pool
-	//	pool = gpool.New(defaultPoolExpire, func() (interface{}, error) {
-	//		if conn, err := NewConn(addr, timeout...); err == nil {
-	//			return &PoolConn{conn, pool, connStatusActive}, nil
-	//		} else {
-	//			return nil, err
-	//		}
-	//	})
-	//	return pool
-	//})
-	//value, err := v.(*gpool.Pool).Get()
-	//if err != nil {
-	//	return nil, err
-	//}
-	// return value.(*PoolConn), nil
-	// TODO
-	return nil, nil
+	var err error
+	v := addressPoolMap.GetOrPutFunc(addr, func() interface{} {
+		option := PoolOption{MaxIdleTime: defaultPoolExpire}
+		if len(timeout) > 0 {
+			option.DialTimeout = timeout[0]
+		}
+		var pool *Pool
+		pool, err = NewPool(addr, option)
+		return pool
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.(*Pool).Get(context.Background())
 }
 
-// Close puts back the connection to the pool if it's active,
-// or closes the connection if it's not active.
+// Close puts back the connection to the pool if it's not broken,
+// or closes the connection if it's broken or exceeds its max lifetime.
 //
 // Note that, if `c` calls Close function closing itself, `c` can not
-// be used again.
+// be used again. Calling Close more than once does nothing.
 func (c *PoolConn) Close() error {
-	//if c.pool != nil && c.status == connStatusActive {
-	//	c.status = connStatusUnknown
-	//	return c.pool.Put(c)
-	//}
+	if c.pool != nil {
+		return c.pool.put(c)
+	}
 	return c.Conn.Close()
 }
 
@@ -71,13 +73,11 @@ func (c *PoolConn) Close() error {
 // writing data.
 func (c *PoolConn) Send(data []byte, retry ...Retry) error {
 	err := c.Conn.Send(data, retry...)
-	if err != nil && c.status == connStatusUnknown {
-		//if v, e := c.pool.Get(); e == nil {
-		//	c.Conn = v.(*PoolConn).Conn
-		//	err = c.Send(data, retry...)
-		//} else {
-		//	err = e
-		//}
+	if err != nil && c.status == connStatusUnknown && c.pool != nil {
+		// The idle connection might be closed by the peer, it retries using a new connection.
+		if err = c.pool.redial(c); err == nil {
+			err = c.Conn.Send(data, retry...)
+		}
 	}
 	if err != nil {
 		c.status = connStatusError
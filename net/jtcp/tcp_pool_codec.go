@@ -0,0 +1,49 @@
+package jtcp
+
+import (
+	"time"
+)
+
+// ReadFrame reads a frame from the connection using `codec` and returns the data of the frame.
+func (c *PoolConn) ReadFrame(codec Codec) ([]byte, error) {
+	data, err := c.Conn.ReadFrame(codec)
+	if err != nil {
+		c.status = connStatusError
+	} else {
+		c.status = connStatusActive
+	}
+	return data, err
+}
+
+// WriteFrame encodes `data` into a frame using `codec` and writes it to the connection.
+func (c *PoolConn) WriteFrame(codec Codec, data []byte, retry ...Retry) error {
+	err := c.Conn.WriteFrame(codec, data, retry...)
+	if err != nil {
+		c.status = connStatusError
+	} else {
+		c.status = connStatusActive
+	}
+	return err
+}
+
+// ReadFrameWithTimeout reads a frame from the connection using `codec` with timeout.
+func (c *PoolConn) ReadFrameWithTimeout(codec Codec, timeout time.Duration) (data []byte, err error) {
+	if err = c.SetDeadlineRecv(time.Now().Add(timeout)); err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = c.SetDeadlineRecv(time.Time{})
+	}()
+	return c.ReadFrame(codec)
+}
+
+// WriteFrameWithTimeout writes a frame of `data` to the connection using `codec` with timeout.
+func (c *PoolConn) WriteFrameWithTimeout(codec Codec, data []byte, timeout time.Duration, retry ...Retry) (err error) {
+	if err = c.SetDeadlineSend(time.Now().Add(timeout)); err != nil {
+		return err
+	}
+	defer func() {
+		_ = c.SetDeadlineSend(time.Time{})
+	}()
+	return c.WriteFrame(codec, data, retry...)
+}
@@ -0,0 +1,249 @@
+package jtcp
+
+import (
+	"context"
+	"time"
+
+	"github.com/e7coding/coding-common/container/jatomic"
+	"github.com/e7coding/coding-common/container/jpool"
+	"github.com/e7coding/coding-common/errs/jerr"
+	"github.com/e7coding/coding-common/internal/intlog"
+)
+
+// poolMaintainInterval is the interval of replenishing the pool to MinConns.
+const poolMaintainInterval = time.Second
+
+// PoolOption is the option for Pool.
+type PoolOption struct {
+	// MinConns is the min count of connections kept in the pool, which are created when the
+	// pool is created and replenished in background.
+	MinConns int
+
+	// MaxConns is the max count of connections, including idle and borrowed ones, 0 means no limit.
+	// Borrowing blocks if the limit is reached, until a connection is returned or the context is done.
+	MaxConns int
+
+	// MaxLifetime is the max duration a connection may be reused since it's created, 0 means no limit.
+	MaxLifetime time.Duration
+
+	// MaxIdleTime is the max duration a connection may stay idle in the pool, 0 means no limit.
+	MaxIdleTime time.Duration
+
+	// DialTimeout is the timeout of creating each connection, 0 means no timeout.
+	DialTimeout time.Duration
+
+	// TestOnBorrow validates the idle connection before it's borrowed.
+	// The connection is closed and another one is borrowed if it returns error.
+	TestOnBorrow func(conn *PoolConn) error
+}
+
+// PoolStats is the statistics of Pool.
+type PoolStats struct {
+	Total        int           // Count of connections, including idle and borrowed ones.
+	Idle         int           // Count of idle connections.
+	InUse        int           // Count of borrowed connections.
+	WaitCount    int64         // Total count of borrowings that waited for a connection.
+	WaitDuration time.Duration // Total duration of borrowings waiting for a connection.
+	Created      int64         // Total count of created connections.
+	Closed       int64         // Total count of closed connections, due to errors, idle time or lifetime.
+}
+
+// Pool is a bounded connection pool for TCP, with connection validation and statistics.
+//
+// Eg:
+//
+//	pool, _ := jtcp.NewPool("127.0.0.1:8888", jtcp.PoolOption{MaxConns: 10, MaxIdleTime: time.Minute})
+//	conn, err := pool.Get(ctx)
+//	if err != nil {
+//	    return err
+//	}
+//	defer conn.Close()
+type Pool struct {
+	address      string
+	option       PoolOption
+	pool         *jpool.Pool
+	inUse        *jatomic.Int64
+	waitCount    *jatomic.Int64
+	waitDuration *jatomic.Int64
+	created      *jatomic.Int64
+	closed       *jatomic.Int64
+	cancel       context.CancelFunc
+}
+
+// NewPool creates and returns a connection pool for `address`.
+func NewPool(address string, option ...PoolOption) (*Pool, error) {
+	var opt PoolOption
+	if len(option) > 0 {
+		opt = option[0]
+	}
+	if opt.MinConns < 0 || opt.MaxConns < 0 {
+		return nil, jerr.WithMsgF(`invalid pool size, MinConns %d, MaxConns %d`, opt.MinConns, opt.MaxConns)
+	}
+	if opt.MaxConns > 0 && opt.MinConns > opt.MaxConns {
+		return nil, jerr.WithMsgF(`pool MinConns %d exceeds MaxConns %d`, opt.MinConns, opt.MaxConns)
+	}
+	p := &Pool{
+		address:      address,
+		option:       opt,
+		inUse:        jatomic.NewInt64(),
+		waitCount:    jatomic.NewInt64(),
+		waitDuration: jatomic.NewInt64(),
+		created:      jatomic.NewInt64(),
+		closed:       jatomic.NewInt64(),
+	}
+	p.pool = jpool.New(opt.MaxIdleTime, func() (interface{}, error) {
+		return p.dial()
+	}, func(v interface{}) {
+		p.closeConn(v.(*PoolConn))
+	})
+	p.pool.SetMaxSize(opt.MaxConns)
+	if opt.MinConns > 0 {
+		if err := p.pool.Fill(opt.MinConns); err != nil {
+			p.pool.Close()
+			return nil, err
+		}
+		var ctx context.Context
+		ctx, p.cancel = context.WithCancel(context.Background())
+		go p.maintain(ctx)
+	}
+	return p, nil
+}
+
+// Get borrows a connection from the pool, which should be returned by PoolConn.Close.
+// It blocks if MaxConns is reached, until a connection is returned or `ctx` is done.
+func (p *Pool) Get(ctx context.Context) (*PoolConn, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	for {
+		var (
+			start  = time.Now()
+			waited = p.option.MaxConns > 0 && p.pool.Size() == 0 && p.pool.Total() >= p.option.MaxConns
+		)
+		v, err := p.pool.GetCtx(ctx)
+		if waited {
+			p.waitCount.Add(1)
+			p.waitDuration.Add(int64(time.Since(start)))
+		}
+		if err != nil {
+			return nil, err
+		}
+		conn := v.(*PoolConn)
+		if p.expired(conn) {
+			p.pool.Discard(conn)
+			continue
+		}
+		if conn.reused && p.option.TestOnBorrow != nil {
+			if err = p.option.TestOnBorrow(conn); err != nil {
+				intlog.Printf(`pool connection to "%s" failed test on borrow: %+v`, p.address, err)
+				p.pool.Discard(conn)
+				continue
+			}
+		}
+		conn.status = connStatusUnknown
+		conn.borrowed.Set(true)
+		p.inUse.Add(1)
+		return conn, nil
+	}
+}
+
+// Stats returns the statistics of the pool.
+func (p *Pool) Stats() PoolStats {
+	return PoolStats{
+		Total:        p.pool.Total(),
+		Idle:         p.pool.Size(),
+		InUse:        int(p.inUse.Load()),
+		WaitCount:    p.waitCount.Load(),
+		WaitDuration: time.Duration(p.waitDuration.Load()),
+		Created:      p.created.Load(),
+		Closed:       p.closed.Load(),
+	}
+}
+
+// Close closes the pool and its idle connections.
+// The borrowed connections are closed when they are returned.
+func (p *Pool) Close() {
+	if p.cancel != nil {
+		p.cancel()
+	}
+	p.pool.Close()
+}
+
+// put returns the borrowed connection to the pool, or closes it if it's broken or expired.
+// It does nothing if the connection is already returned.
+func (p *Pool) put(conn *PoolConn) error {
+	if !conn.borrowed.CAS(true, false) {
+		return nil
+	}
+	p.inUse.Add(-1)
+	if conn.status == connStatusError || p.expired(conn) {
+		p.pool.Discard(conn)
+		return nil
+	}
+	conn.status = connStatusUnknown
+	conn.reused = true
+	if err := p.pool.Put(conn); err != nil {
+		p.pool.Discard(conn)
+	}
+	return nil
+}
+
+// dial creates a new connection of the pool.
+func (p *Pool) dial() (*PoolConn, error) {
+	var timeout []time.Duration
+	if p.option.DialTimeout > 0 {
+		timeout = append(timeout, p.option.DialTimeout)
+	}
+	conn, err := NewConn(p.address, timeout...)
+	if err != nil {
+		return nil, err
+	}
+	p.created.Add(1)
+	return &PoolConn{
+		Conn:      conn,
+		pool:      p,
+		status:    connStatusActive,
+		createdAt: time.Now(),
+		borrowed:  jatomic.NewBool(),
+	}, nil
+}
+
+// redial replaces the underlying connection of `conn` with a new one, which keeps its place in the pool.
+func (p *Pool) redial(conn *PoolConn) error {
+	newConn, err := p.dial()
+	if err != nil {
+		return err
+	}
+	p.closeConn(conn)
+	conn.Conn, conn.createdAt, conn.reused = newConn.Conn, newConn.createdAt, false
+	return nil
+}
+
+// closeConn closes the underlying connection of `conn`.
+func (p *Pool) closeConn(conn *PoolConn) {
+	p.closed.Add(1)
+	if err := conn.Conn.Close(); err != nil {
+		intlog.Errorf(`%+v`, err)
+	}
+}
+
+// expired checks whether `conn` exceeds MaxLifetime.
+func (p *Pool) expired(conn *PoolConn) bool {
+	return p.option.MaxLifetime > 0 && time.Since(conn.createdAt) > p.option.MaxLifetime
+}
+
+// maintain replenishes the pool to MinConns periodically until `ctx` is done.
+func (p *Pool) maintain(ctx context.Context) {
+	ticker := time.NewTicker(poolMaintainInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := p.pool.Fill(p.option.MinConns); err != nil && ctx.Err() == nil {
+				intlog.Errorf(`%+v`, err)
+			}
+		}
+	}
+}
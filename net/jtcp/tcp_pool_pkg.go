@@ -7,19 +7,25 @@
 package jtcp
 
 import (
+	"context"
 	"time"
+
+	"go.opentelemetry.io/otel/trace"
 )
 
 // SendPkg sends a package containing `data` to the connection.
 // The optional parameter `option` specifies the package options for sending.
 func (c *PoolConn) SendPkg(data []byte, option ...PkgOption) (err error) {
-	if err = c.Conn.SendPkg(data, option...); err != nil && c.status == connStatusUnknown {
-		//if v, e := c.pool.NewFunc(); e == nil {
-		//	c.Conn = v.(*PoolConn).Conn
-		//	err = c.Conn.SendPkg(data, option...)
-		//} else {
-		//	err = e
-		//}
+	return c.SendPkgCtx(c.Context(), data, option...)
+}
+
+// SendPkgCtx is the same as SendPkg, but it propagates the trace context of `ctx` inside the
+// package if PkgOption.Tracing is enabled.
+func (c *PoolConn) SendPkgCtx(ctx context.Context, data []byte, option ...PkgOption) (err error) {
+	if err = c.Conn.SendPkgCtx(ctx, data, option...); err != nil && c.status == connStatusUnknown && c.pool != nil {
+		if err = c.pool.redial(c); err == nil {
+			err = c.Conn.SendPkgCtx(ctx, data, option...)
+		}
 	}
 	if err != nil {
 		c.status = connStatusError
@@ -32,13 +38,20 @@ func (c *PoolConn) SendPkg(data []byte, option ...PkgOption) (err error) {
 // RecvPkg receives package from connection using simple package protocol.
 // The optional parameter `option` specifies the package options for receiving.
 func (c *PoolConn) RecvPkg(option ...PkgOption) ([]byte, error) {
-	data, err := c.Conn.RecvPkg(option...)
+	_, data, err := c.RecvPkgCtx(option...)
+	return data, err
+}
+
+// RecvPkgCtx is the same as RecvPkg, but it also returns the context carrying the trace context
+// propagated inside the package if PkgOption.Tracing is enabled.
+func (c *PoolConn) RecvPkgCtx(option ...PkgOption) (context.Context, []byte, error) {
+	ctx, data, err := c.Conn.RecvPkgCtx(option...)
 	if err != nil {
 		c.status = connStatusError
 	} else {
 		c.status = connStatusActive
 	}
-	return data, err
+	return ctx, data, err
 }
 
 // RecvPkgWithTimeout reads data from connection with timeout using simple package protocol.
@@ -67,18 +80,37 @@ func (c *PoolConn) SendPkgWithTimeout(data []byte, timeout time.Duration, option
 
 // SendRecvPkg writes data to connection and blocks reading response using simple package protocol.
 func (c *PoolConn) SendRecvPkg(data []byte, option ...PkgOption) ([]byte, error) {
-	if err := c.SendPkg(data, option...); err == nil {
-		return c.RecvPkg(option...)
-	} else {
-		return nil, err
-	}
+	return c.SendRecvPkgCtx(c.Context(), data, option...)
+}
+
+// SendRecvPkgCtx is the same as SendRecvPkg, but the round trip span is the child of `ctx` if
+// observability is enabled, and the trace context is propagated if PkgOption.Tracing is enabled.
+func (c *PoolConn) SendRecvPkgCtx(ctx context.Context, data []byte, option ...PkgOption) ([]byte, error) {
+	return c.sendRecvPkg(ctx, data, 0, option...)
 }
 
 // SendRecvPkgWithTimeout reads data from connection with timeout using simple package protocol.
 func (c *PoolConn) SendRecvPkgWithTimeout(data []byte, timeout time.Duration, option ...PkgOption) ([]byte, error) {
-	if err := c.SendPkg(data, option...); err == nil {
-		return c.RecvPkgWithTimeout(timeout, option...)
-	} else {
+	return c.sendRecvPkg(c.Context(), data, timeout, option...)
+}
+
+// sendRecvPkg writes data to connection and reads response using simple package protocol,
+// it reads with timeout if `timeout` > 0.
+func (c *PoolConn) sendRecvPkg(
+	ctx context.Context, data []byte, timeout time.Duration, option ...PkgOption,
+) (result []byte, err error) {
+	if IsObservabilityEnabled() {
+		var span trace.Span
+		ctx, span = startSendRecvPkgSpan(ctx, c.Conn, data)
+		defer func() {
+			endSendRecvPkgSpan(span, result, err)
+		}()
+	}
+	if err = c.SendPkgCtx(ctx, data, option...); err != nil {
 		return nil, err
 	}
+	if timeout > 0 {
+		return c.RecvPkgWithTimeout(timeout, option...)
+	}
+	return c.RecvPkg(option...)
 }
@@ -0,0 +1,105 @@
+package jtcp
+
+import (
+	"bufio"
+	"crypto/tls"
+	"net"
+	"time"
+
+	"github.com/e7coding/coding-common/net/jproxyproto"
+)
+
+// defaultProxyHeaderTimeout is the default timeout of reading PROXY protocol header.
+const defaultProxyHeaderTimeout = 5 * time.Second
+
+// proxyConn is a net.Conn whose PROXY protocol header is read, and the data buffered
+// along with the header is read first.
+type proxyConn struct {
+	net.Conn
+	reader *bufio.Reader
+	header *jproxyproto.Header
+}
+
+// SetProxyProtocol enables or disables the PROXY protocol v1/v2 for the connections accepted by
+// server, which is used if the server is behind HAProxy or a load balancer like NLB.
+// If it's enabled, each connection must start with a PROXY protocol header, or else it's closed,
+// and the RemoteAddr of Conn returns the address of the original client. The header is read before
+// TLS handshake if TLS is configured. It should be called before Run.
+//
+// The optional parameter `timeout` specifies the timeout of reading the header, which is 5 seconds
+// in default.
+func (s *Server) SetProxyProtocol(enabled bool, timeout ...time.Duration) {
+	s.proxyProtocol = enabled
+	s.proxyHeaderTimeout = defaultProxyHeaderTimeout
+	if len(timeout) > 0 && timeout[0] > 0 {
+		s.proxyHeaderTimeout = timeout[0]
+	}
+}
+
+// readProxyHeader reads the PROXY protocol header of `conn`, and returns the connection for reading
+// the data after the header, which is wrapped with TLS if TLS is configured.
+func (s *Server) readProxyHeader(conn net.Conn) (net.Conn, *jproxyproto.Header, error) {
+	if err := conn.SetReadDeadline(time.Now().Add(s.proxyHeaderTimeout)); err != nil {
+		return nil, nil, err
+	}
+	reader := bufio.NewReader(conn)
+	header, err := jproxyproto.Read(reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err = conn.SetReadDeadline(time.Time{}); err != nil {
+		return nil, nil, err
+	}
+	var result net.Conn = &proxyConn{Conn: conn, reader: reader, header: header}
+	if s.tlsConfig != nil {
+		result = tls.Server(result, s.tlsConfig)
+	}
+	return result, header, nil
+}
+
+// Read implements interface io.Reader.
+func (c *proxyConn) Read(b []byte) (int, error) {
+	if c.reader.Buffered() > 0 {
+		return c.reader.Read(b)
+	}
+	return c.Conn.Read(b)
+}
+
+// RemoteAddr implements interface net.Conn, which returns the address of the original client.
+func (c *proxyConn) RemoteAddr() net.Addr {
+	if c.header.Command == jproxyproto.CommandProxy && c.header.SourceAddr != nil {
+		return c.header.SourceAddr
+	}
+	return c.Conn.RemoteAddr()
+}
+
+// LocalAddr implements interface net.Conn, which returns the address that the original client
+// connects to.
+func (c *proxyConn) LocalAddr() net.Addr {
+	if c.header.Command == jproxyproto.CommandProxy && c.header.DestAddr != nil {
+		return c.header.DestAddr
+	}
+	return c.Conn.LocalAddr()
+}
+
+// ProxyHeader returns the PROXY protocol header of the connection accepted by Server with
+// PROXY protocol enabled, or nil if there's no header.
+func (c *Conn) ProxyHeader() *jproxyproto.Header {
+	return c.proxyHeader
+}
+
+// SendProxyHeader sends the PROXY protocol `header` to the connection, which should be
+// called before any other data is sent.
+//
+// Eg:
+//
+//	conn, _ := jtcp.NewConn("127.0.0.1:8888")
+//	header := jproxyproto.NewHeader(2, clientConn.RemoteAddr(), clientConn.LocalAddr())
+//	err := conn.SendProxyHeader(header)
+func (c *Conn) SendProxyHeader(header *jproxyproto.Header) error {
+	data, err := header.Bytes()
+	if err != nil {
+		return err
+	}
+	return c.Send(data)
+}
@@ -0,0 +1,179 @@
+package jtcp
+
+import (
+	"encoding/binary"
+	"time"
+
+	"github.com/e7coding/coding-common/encoding/jbinary"
+	"github.com/e7coding/coding-common/errs/jerr"
+	"github.com/e7coding/coding-common/internal/json"
+)
+
+// Payload encodings of RPC.
+const (
+	RPCEncodingJSON   = 0 // JSON encoding.
+	RPCEncodingBinary = 1 // Big endian binary encoding using jbinary, for fixed-size values.
+)
+
+// RPC frame types.
+const (
+	rpcFrameRequest  = 1 // Request from client.
+	rpcFrameResponse = 2 // Final response from server.
+	rpcFrameStream   = 3 // Streaming response item from server, which is followed by a final response.
+	rpcFrameError    = 4 // Final error response from server, whose payload is the error message.
+	rpcFrameCancel   = 5 // Cancellation of the request from client.
+)
+
+const (
+	// rpcFrameHeaderSize is the header size of RPC frame:
+	// type(1) + encoding(1) + request id(8) + method length(2).
+	rpcFrameHeaderSize       = 12
+	rpcMethodMaxLength       = 0xFFFF
+	defaultRPCTimeout        = 30 * time.Second
+	defaultRPCHeaderSize     = 4
+	defaultRPCMaxConcurrency = 256
+)
+
+// RPCOption is the option for RPCClient and RPCServer.
+type RPCOption struct {
+	// Codec is the framing codec of the connection, which must be the same for both sides.
+	// It's a LengthCodec with 4 bytes header in default.
+	Codec Codec
+
+	// Encoding is the payload encoding of the client requests, it is RPCEncodingJSON in default.
+	// The server responds using the encoding of the request.
+	Encoding int
+
+	// Timeout is the timeout of each call if the context has no deadline, it is 30 seconds in default.
+	Timeout time.Duration
+
+	// MaxConcurrency is the max count of requests that the server handles concurrently for each
+	// connection, it is 256 in default. The requests exceeding the limit are queued up to the same
+	// count and handled in order, and the requests exceeding the queue fail with error.
+	MaxConcurrency int
+}
+
+// RPCError is the error returned by the remote handler.
+type RPCError struct {
+	Method  string // Method name of the call.
+	Message string // Error message from server.
+}
+
+// Error implements interface error.
+func (e *RPCError) Error() string {
+	return `rpc method "` + e.Method + `" failed: ` + e.Message
+}
+
+// rpcFrame is the frame of RPC.
+type rpcFrame struct {
+	frameType int
+	encoding  int
+	id        uint64
+	method    string
+	payload   []byte
+}
+
+// getRPCOption returns the RPC option with default values.
+func getRPCOption(option ...RPCOption) (RPCOption, error) {
+	var opt RPCOption
+	if len(option) > 0 {
+		opt = option[0]
+	}
+	if opt.Codec == nil {
+		codec, err := NewLengthCodec(LengthCodecOption{HeaderSize: defaultRPCHeaderSize})
+		if err != nil {
+			return opt, err
+		}
+		opt.Codec = codec
+	}
+	if opt.Encoding != RPCEncodingJSON && opt.Encoding != RPCEncodingBinary {
+		return opt, jerr.WithMsgF(`invalid rpc encoding %d`, opt.Encoding)
+	}
+	if opt.Timeout == 0 {
+		opt.Timeout = defaultRPCTimeout
+	}
+	if opt.MaxConcurrency <= 0 {
+		opt.MaxConcurrency = defaultRPCMaxConcurrency
+	}
+	return opt, nil
+}
+
+// marshal encodes the frame.
+func (f *rpcFrame) marshal() ([]byte, error) {
+	if len(f.method) > rpcMethodMaxLength {
+		return nil, jerr.WithMsgF(`rpc method name too long: %d`, len(f.method))
+	}
+	data := make([]byte, rpcFrameHeaderSize, rpcFrameHeaderSize+len(f.method)+len(f.payload))
+	data[0] = byte(f.frameType)
+	data[1] = byte(f.encoding)
+	binary.BigEndian.PutUint64(data[2:], f.id)
+	binary.BigEndian.PutUint16(data[10:], uint16(len(f.method)))
+	data = append(data, f.method...)
+	return append(data, f.payload...), nil
+}
+
+// unmarshalRPCFrame decodes the frame.
+func unmarshalRPCFrame(data []byte) (*rpcFrame, error) {
+	if len(data) < rpcFrameHeaderSize {
+		return nil, jerr.WithMsgF(`invalid rpc frame size %d`, len(data))
+	}
+	var (
+		methodLength = int(binary.BigEndian.Uint16(data[10:]))
+		f            = &rpcFrame{
+			frameType: int(data[0]),
+			encoding:  int(data[1]),
+			id:        binary.BigEndian.Uint64(data[2:]),
+		}
+	)
+	if len(data) < rpcFrameHeaderSize+methodLength {
+		return nil, jerr.WithMsgF(`invalid rpc frame method length %d`, methodLength)
+	}
+	f.method = string(data[rpcFrameHeaderSize : rpcFrameHeaderSize+methodLength])
+	f.payload = data[rpcFrameHeaderSize+methodLength:]
+	return f, nil
+}
+
+// encodeRPCPayload encodes `value` using `encoding`, in which []byte and string are sent as they are.
+func encodeRPCPayload(encoding int, value interface{}) ([]byte, error) {
+	switch v := value.(type) {
+	case nil:
+		return nil, nil
+	case []byte:
+		return v, nil
+	case string:
+		return []byte(v), nil
+	}
+	if encoding == RPCEncodingBinary {
+		return jbinary.BeEncode(value), nil
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, jerr.WithMsgErr(err, `rpc payload json marshal failed`)
+	}
+	return data, nil
+}
+
+// decodeRPCPayload decodes `payload` using `encoding` into `pointer`,
+// in which *[]byte and *string receive the payload as it is.
+func decodeRPCPayload(encoding int, payload []byte, pointer interface{}) error {
+	switch p := pointer.(type) {
+	case nil:
+		return nil
+	case *[]byte:
+		*p = payload
+		return nil
+	case *string:
+		*p = string(payload)
+		return nil
+	}
+	if encoding == RPCEncodingBinary {
+		return jbinary.BeDecode(payload, pointer)
+	}
+	if len(payload) == 0 {
+		return nil
+	}
+	if err := json.UnmarshalUseNumber(payload, pointer); err != nil {
+		return jerr.WithMsgErr(err, `rpc payload json unmarshal failed`)
+	}
+	return nil
+}
@@ -0,0 +1,352 @@
+package jtcp
+
+import (
+	"context"
+	"io"
+	"sync"
+
+	"github.com/e7coding/coding-common/container/jatomic"
+	"github.com/e7coding/coding-common/errs/jerr"
+	"github.com/e7coding/coding-common/internal/intlog"
+)
+
+// rpcStreamBufferSize is the buffer size of streaming response items for each call.
+const rpcStreamBufferSize = 64
+
+// RPCClient is the RPC client that multiplexes concurrent calls on one connection.
+type RPCClient struct {
+	conn     *Conn
+	option   RPCOption
+	nextId   *jatomic.Uint64
+	writeMu  sync.Mutex
+	mu       sync.Mutex
+	pending  map[uint64]*rpcCall // Calls in progress.
+	closed   bool                // Whether the client is closed.
+	closeErr error               // The error that closes the client.
+	done     chan struct{}       // Closed if the client is closed.
+}
+
+// RPCStreamReader is the reader of streaming responses.
+type RPCStreamReader struct {
+	client *RPCClient
+	call   *rpcCall
+	method string
+	cancel context.CancelFunc
+	err    error // Final error, which is io.EOF if the stream ends normally.
+}
+
+// rpcCall is a call in progress.
+type rpcCall struct {
+	id   uint64
+	ch   chan *rpcFrame // Response frames.
+	done chan struct{}  // Closed if the call is removed before its final response is delivered.
+	err  error          // Error of the call if it fails before its final response, which is set before done is closed.
+}
+
+// NewRPCClient creates and returns a RPCClient on `conn`, which starts reading responses
+// in background. The connection is closed if the client is closed.
+func NewRPCClient(conn *Conn, option ...RPCOption) (*RPCClient, error) {
+	opt, err := getRPCOption(option...)
+	if err != nil {
+		return nil, err
+	}
+	c := &RPCClient{
+		conn:    conn,
+		option:  opt,
+		nextId:  jatomic.NewUint64(),
+		pending: make(map[uint64]*rpcCall),
+		done:    make(chan struct{}),
+	}
+	go c.readLoop()
+	return c, nil
+}
+
+// DialRPC connects to `address` and returns a RPCClient on the connection.
+func DialRPC(address string, option ...RPCOption) (*RPCClient, error) {
+	conn, err := NewConn(address)
+	if err != nil {
+		return nil, err
+	}
+	client, err := NewRPCClient(conn, option...)
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	return client, nil
+}
+
+// Call calls `method` with `request` and decodes the response into `response`.
+// The call times out using the deadline of `ctx`, or the Timeout of option if `ctx` has no deadline.
+// It returns *RPCError if the remote handler returns error.
+func (c *RPCClient) Call(ctx context.Context, method string, request interface{}, response interface{}) error {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+	call, err := c.send(method, request, 1)
+	if err != nil {
+		return err
+	}
+	defer c.remove(call.id)
+	f, err := c.receive(ctx, call)
+	if err != nil {
+		if ctx.Err() != nil {
+			c.sendCancel(call.id)
+			return jerr.WithMsgErrF(err, `rpc call "%s" failed`, method)
+		}
+		return err
+	}
+	if f.frameType == rpcFrameError {
+		return &RPCError{Method: method, Message: string(f.payload)}
+	}
+	return decodeRPCPayload(f.encoding, f.payload, response)
+}
+
+// CallStream calls streaming `method` with `request` and returns the reader of the responses.
+// The stream is canceled if `ctx` is done, and the Timeout of option does not apply to it.
+func (c *RPCClient) CallStream(ctx context.Context, method string, request interface{}) (*RPCStreamReader, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	call, err := c.send(method, request, rpcStreamBufferSize)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	reader := &RPCStreamReader{
+		client: c,
+		call:   call,
+		method: method,
+		cancel: cancel,
+	}
+	go func() {
+		<-ctx.Done()
+		reader.close()
+	}()
+	return reader, nil
+}
+
+// Close closes the client and the connection, the calls in progress fail.
+func (c *RPCClient) Close() error {
+	c.shutdown(jerr.WithMsg(`rpc client closed`))
+	return c.conn.Close()
+}
+
+// Recv receives the next streaming response into `pointer`.
+// It returns io.EOF if the stream ends, or *RPCError if the remote handler returns error.
+func (r *RPCStreamReader) Recv(pointer interface{}) error {
+	if r.err != nil {
+		return r.err
+	}
+	f, err := r.client.receive(context.Background(), r.call)
+	if err != nil {
+		r.err = err
+		return r.err
+	}
+	switch f.frameType {
+	case rpcFrameStream:
+		return decodeRPCPayload(f.encoding, f.payload, pointer)
+	case rpcFrameError:
+		r.err = &RPCError{Method: r.method, Message: string(f.payload)}
+	default:
+		r.err = io.EOF
+	}
+	r.cancel()
+	return r.err
+}
+
+// Close cancels the stream.
+func (r *RPCStreamReader) Close() error {
+	r.cancel()
+	return nil
+}
+
+// close removes the stream from client and cancels it on server if it does not end yet.
+func (r *RPCStreamReader) close() {
+	if r.client.remove(r.call.id) {
+		r.client.sendCancel(r.call.id)
+	}
+}
+
+// withTimeout returns the context with default timeout if `ctx` has no deadline.
+func (c *RPCClient) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if _, ok := ctx.Deadline(); ok {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, c.option.Timeout)
+}
+
+// send registers a call and sends the request frame.
+func (c *RPCClient) send(method string, request interface{}, bufferSize int) (*rpcCall, error) {
+	payload, err := encodeRPCPayload(c.option.Encoding, request)
+	if err != nil {
+		return nil, err
+	}
+	call := &rpcCall{
+		id:   c.nextId.Add(1),
+		ch:   make(chan *rpcFrame, bufferSize),
+		done: make(chan struct{}),
+	}
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil, c.closeErr
+	}
+	c.pending[call.id] = call
+	c.mu.Unlock()
+	err = c.write(&rpcFrame{
+		frameType: rpcFrameRequest,
+		encoding:  c.option.Encoding,
+		id:        call.id,
+		method:    method,
+		payload:   payload,
+	})
+	if err != nil {
+		c.remove(call.id)
+		return nil, err
+	}
+	return call, nil
+}
+
+// receive receives the next response frame of the call.
+func (c *RPCClient) receive(ctx context.Context, call *rpcCall) (*rpcFrame, error) {
+	select {
+	case f := <-call.ch:
+		return f, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-call.done:
+		// The frame received before the call is removed is still delivered.
+		select {
+		case f := <-call.ch:
+			return f, nil
+		default:
+		}
+		if call.err != nil {
+			return nil, call.err
+		}
+		if err := c.getCloseErr(); err != nil {
+			return nil, err
+		}
+		return nil, jerr.WithMsgF(`rpc call %d canceled`, call.id)
+	}
+}
+
+// sendCancel notifies the server to cancel the request.
+func (c *RPCClient) sendCancel(id uint64) {
+	if err := c.write(&rpcFrame{frameType: rpcFrameCancel, id: id}); err != nil {
+		intlog.Errorf(`%+v`, err)
+	}
+}
+
+// write writes the frame to the connection, it's safe for concurrent use.
+func (c *RPCClient) write(f *rpcFrame) error {
+	data, err := f.marshal()
+	if err != nil {
+		return err
+	}
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if err = c.conn.WriteFrame(c.option.Codec, data); err != nil {
+		return jerr.WithMsgErr(err, `rpc write request failed`)
+	}
+	return nil
+}
+
+// remove removes the call before its final response, it returns false if the call is already removed.
+func (c *RPCClient) remove(id uint64) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	call, ok := c.pending[id]
+	if ok {
+		delete(c.pending, id)
+		close(call.done)
+	}
+	return ok
+}
+
+// fail removes the call with `err` before its final response, and cancels it on server.
+func (c *RPCClient) fail(call *rpcCall, err error) {
+	c.mu.Lock()
+	ok := c.pending[call.id] == call
+	if ok {
+		delete(c.pending, call.id)
+		call.err = err
+		close(call.done)
+	}
+	c.mu.Unlock()
+	if ok {
+		// It does not write in the read loop, as the writing might block.
+		go c.sendCancel(call.id)
+	}
+}
+
+// readLoop reads responses and dispatches them to the calls until the connection fails.
+func (c *RPCClient) readLoop() {
+	for {
+		data, err := c.conn.ReadFrame(c.option.Codec)
+		if err != nil {
+			c.shutdown(jerr.WithMsgErr(err, `rpc connection failed`))
+			return
+		}
+		f, err := unmarshalRPCFrame(data)
+		if err != nil {
+			c.shutdown(err)
+			return
+		}
+		c.dispatch(f)
+	}
+}
+
+// dispatch delivers the response frame to its call without blocking, as blocking the read loop stalls
+// all calls on the connection. The stream fails if its responses are not received in time and its
+// buffer is full. The call is removed from pending calls after its final response is delivered.
+func (c *RPCClient) dispatch(f *rpcFrame) {
+	c.mu.Lock()
+	call, ok := c.pending[f.id]
+	c.mu.Unlock()
+	if !ok {
+		return
+	}
+	select {
+	case call.ch <- f:
+	case <-call.done:
+		return
+	default:
+		c.fail(call, jerr.WithMsgF(
+			`rpc stream %d failed: responses are not received in time, buffer size %d exceeded`,
+			call.id, cap(call.ch),
+		))
+		return
+	}
+	if f.frameType != rpcFrameStream {
+		c.mu.Lock()
+		if c.pending[f.id] == call {
+			delete(c.pending, f.id)
+		}
+		c.mu.Unlock()
+	}
+}
+
+// shutdown marks the client closed with `err` and fails all calls in progress.
+func (c *RPCClient) shutdown(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return
+	}
+	c.closed, c.closeErr = true, err
+	close(c.done)
+	for id, call := range c.pending {
+		delete(c.pending, id)
+		close(call.done)
+	}
+}
+
+// getCloseErr returns the error that closes the client, or nil if the client is not closed.
+func (c *RPCClient) getCloseErr() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.closeErr
+}
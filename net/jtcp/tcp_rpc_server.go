@@ -0,0 +1,291 @@
+package jtcp
+
+import (
+	"context"
+	"sync"
+
+	"github.com/e7coding/coding-common/errs/jerr"
+	"github.com/e7coding/coding-common/internal/intlog"
+)
+
+// RPCHandler handles the RPC request and returns the response, which is encoded using the
+// encoding of the request.
+type RPCHandler func(ctx context.Context, req *RPCRequest) (interface{}, error)
+
+// RPCStreamHandler handles the RPC request and sends the streaming responses using `stream`.
+type RPCStreamHandler func(ctx context.Context, req *RPCRequest, stream *RPCStream) error
+
+// RPCRequest is the request received by RPCServer.
+type RPCRequest struct {
+	Conn     *Conn  // Connection of the request.
+	Method   string // Method name.
+	Payload  []byte // Raw payload.
+	Encoding int    // Payload encoding.
+}
+
+// RPCStream is the stream for sending streaming responses.
+type RPCStream struct {
+	conn *rpcServerConn
+	req  *rpcFrame
+}
+
+// RPCServer dispatches the RPC requests to the registered handlers.
+// It's used as the handler of Server:
+//
+//	rpcServer, _ := jtcp.NewRPCServer()
+//	rpcServer.Register("echo", func(ctx context.Context, req *jtcp.RPCRequest) (interface{}, error) {
+//	    return req.Payload, nil
+//	})
+//	jtcp.NewServer(":8888", rpcServer.Handle).Run()
+type RPCServer struct {
+	option   RPCOption
+	mu       sync.RWMutex
+	handlers map[string]RPCHandler
+	streams  map[string]RPCStreamHandler
+}
+
+// rpcServerConn is the state of a connection handled by RPCServer.
+type rpcServerConn struct {
+	conn    *Conn
+	codec   Codec
+	writeMu sync.Mutex
+	mu      sync.Mutex
+	cancels map[uint64]context.CancelFunc // Cancel functions of requests being handled or queued.
+	running int                           // Count of requests being handled.
+	queue   []*rpcServerRequest           // Requests waiting for handling as the concurrency limit is reached.
+}
+
+// rpcServerRequest is a request received by RPCServer.
+type rpcServerRequest struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	frame  *rpcFrame
+}
+
+// NewRPCServer creates and returns a RPCServer.
+func NewRPCServer(option ...RPCOption) (*RPCServer, error) {
+	opt, err := getRPCOption(option...)
+	if err != nil {
+		return nil, err
+	}
+	return &RPCServer{
+		option:   opt,
+		handlers: make(map[string]RPCHandler),
+		streams:  make(map[string]RPCStreamHandler),
+	}, nil
+}
+
+// Register registers `handler` for `method`.
+func (s *RPCServer) Register(method string, handler RPCHandler) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handlers[method] = handler
+}
+
+// RegisterStream registers streaming `handler` for `method`.
+func (s *RPCServer) RegisterStream(method string, handler RPCStreamHandler) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.streams[method] = handler
+}
+
+// Handle serves the RPC requests of the connection until it's closed.
+// Each request is handled in its own goroutine, with context canceled if the client cancels the
+// call or the connection context is done. At most MaxConcurrency of option requests are handled
+// concurrently, and the others are queued, so that the reading never blocks and the cancellations
+// are always received.
+func (s *RPCServer) Handle(conn *Conn) {
+	var (
+		ctx, cancel = context.WithCancel(conn.Context())
+		serverConn  = &rpcServerConn{
+			conn:    conn,
+			codec:   s.option.Codec,
+			cancels: make(map[uint64]context.CancelFunc),
+		}
+		wg sync.WaitGroup
+	)
+	defer func() {
+		cancel()
+		wg.Wait()
+	}()
+	for {
+		data, err := conn.ReadFrame(s.option.Codec)
+		if err != nil {
+			return
+		}
+		f, err := unmarshalRPCFrame(data)
+		if err != nil {
+			intlog.Errorf(`%+v`, err)
+			return
+		}
+		switch f.frameType {
+		case rpcFrameRequest:
+			reqCtx, reqCancel := context.WithCancel(ctx)
+			req := &rpcServerRequest{ctx: reqCtx, cancel: reqCancel, frame: f}
+			serverConn.mu.Lock()
+			switch {
+			case serverConn.running < s.option.MaxConcurrency:
+				serverConn.cancels[f.id] = reqCancel
+				serverConn.running++
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					s.work(serverConn, req)
+				}()
+
+			case len(serverConn.queue) < s.option.MaxConcurrency:
+				serverConn.cancels[f.id] = reqCancel
+				serverConn.queue = append(serverConn.queue, req)
+
+			default:
+				reqCancel()
+				serverConn.mu.Unlock()
+				s.reject(serverConn, f, jerr.WithMsgF(
+					`too many concurrent requests, max concurrency %d exceeded`, s.option.MaxConcurrency,
+				))
+				continue
+			}
+			serverConn.mu.Unlock()
+
+		case rpcFrameCancel:
+			serverConn.mu.Lock()
+			if reqCancel, ok := serverConn.cancels[f.id]; ok {
+				reqCancel()
+			}
+			serverConn.mu.Unlock()
+		}
+	}
+}
+
+// work handles `req`, and then the queued requests in order until the queue is empty.
+// The queued requests canceled before handling are dropped.
+func (s *RPCServer) work(conn *rpcServerConn, req *rpcServerRequest) {
+	for req != nil {
+		if req.ctx.Err() == nil {
+			s.serve(req.ctx, conn, req.frame)
+		}
+		req.cancel()
+		conn.mu.Lock()
+		delete(conn.cancels, req.frame.id)
+		req = nil
+		if len(conn.queue) > 0 {
+			req = conn.queue[0]
+			conn.queue[0] = nil
+			conn.queue = conn.queue[1:]
+		} else {
+			conn.running--
+		}
+		conn.mu.Unlock()
+	}
+}
+
+// reject sends the error response of request `f` without handling it.
+func (s *RPCServer) reject(conn *rpcServerConn, f *rpcFrame, err error) {
+	response := &rpcFrame{
+		frameType: rpcFrameError,
+		encoding:  f.encoding,
+		id:        f.id,
+		payload:   []byte(err.Error()),
+	}
+	if err = conn.write(response); err != nil {
+		intlog.Errorf(`%+v`, err)
+	}
+}
+
+// serve calls the handler of the request and sends the response.
+func (s *RPCServer) serve(ctx context.Context, conn *rpcServerConn, f *rpcFrame) {
+	s.mu.RLock()
+	var (
+		handler       = s.handlers[f.method]
+		streamHandler = s.streams[f.method]
+	)
+	s.mu.RUnlock()
+	var (
+		req = &RPCRequest{
+			Conn:     conn.conn,
+			Method:   f.method,
+			Payload:  f.payload,
+			Encoding: f.encoding,
+		}
+		result interface{}
+		err    error
+	)
+	switch {
+	case handler != nil:
+		result, err = s.call(ctx, handler, req)
+	case streamHandler != nil:
+		err = s.callStream(ctx, streamHandler, req, &RPCStream{conn: conn, req: f})
+	default:
+		err = jerr.WithMsgF(`rpc method "%s" not found`, f.method)
+	}
+	response := &rpcFrame{
+		frameType: rpcFrameResponse,
+		encoding:  f.encoding,
+		id:        f.id,
+	}
+	if err == nil {
+		response.payload, err = encodeRPCPayload(f.encoding, result)
+	}
+	if err != nil {
+		response.frameType = rpcFrameError
+		response.payload = []byte(err.Error())
+	}
+	if err = conn.write(response); err != nil {
+		intlog.Errorf(`%+v`, err)
+	}
+}
+
+// call calls the handler with panic recovered.
+func (s *RPCServer) call(ctx context.Context, handler RPCHandler, req *RPCRequest) (result interface{}, err error) {
+	defer func() {
+		if exception := recover(); exception != nil {
+			err = jerr.WithMsgF(`rpc method "%s" panic: %v`, req.Method, exception)
+		}
+	}()
+	return handler(ctx, req)
+}
+
+// callStream calls the streaming handler with panic recovered.
+func (s *RPCServer) callStream(
+	ctx context.Context, handler RPCStreamHandler, req *RPCRequest, stream *RPCStream,
+) (err error) {
+	defer func() {
+		if exception := recover(); exception != nil {
+			err = jerr.WithMsgF(`rpc method "%s" panic: %v`, req.Method, exception)
+		}
+	}()
+	return handler(ctx, req, stream)
+}
+
+// Decode decodes the request payload into `pointer` using the encoding of the request.
+func (r *RPCRequest) Decode(pointer interface{}) error {
+	return decodeRPCPayload(r.Encoding, r.Payload, pointer)
+}
+
+// Send sends a streaming response item, which is encoded using the encoding of the request.
+func (s *RPCStream) Send(value interface{}) error {
+	payload, err := encodeRPCPayload(s.req.encoding, value)
+	if err != nil {
+		return err
+	}
+	return s.conn.write(&rpcFrame{
+		frameType: rpcFrameStream,
+		encoding:  s.req.encoding,
+		id:        s.req.id,
+		payload:   payload,
+	})
+}
+
+// write writes the frame to the connection, it's safe for concurrent use.
+func (c *rpcServerConn) write(f *rpcFrame) error {
+	data, err := f.marshal()
+	if err != nil {
+		return err
+	}
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if err = c.conn.WriteFrame(c.codec, data); err != nil {
+		return jerr.WithMsgErrF(err, `rpc write response failed for request %d`, f.id)
+	}
+	return nil
+}
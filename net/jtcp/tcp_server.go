@@ -7,12 +7,19 @@
 package jtcp
 
 import (
+	"context"
 	"crypto/tls"
 	"fmt"
+	"github.com/e7coding/coding-common/container/jatomic"
 	"github.com/e7coding/coding-common/container/jmap"
 	"github.com/e7coding/coding-common/errs/jerr"
+	"github.com/e7coding/coding-common/internal/intlog"
+	"github.com/e7coding/coding-common/internal/unixsock"
+	"github.com/e7coding/coding-common/net/jproxyproto"
 	"net"
+	"os"
 	"sync"
+	"time"
 
 	"github.com/e7coding/coding-common/jutil/jconv"
 	"github.com/e7coding/coding-common/text/jstr"
@@ -24,16 +31,31 @@ const (
 )
 
 const (
-	defaultServer = "default"
+	defaultServer        = "default"
+	shutdownPollInterval = 10 * time.Millisecond // Interval of checking handled connections when shutting down.
 )
 
 // Server is a TCP server.
 type Server struct {
-	mu        sync.Mutex   // Used for Server.listen concurrent safety. -- The golang test with data race checks this.
-	listen    net.Listener // TCP address listener.
-	address   string       // Server listening address.
-	handler   func(*Conn)  // Connection handler.
-	tlsConfig *tls.Config  // TLS configuration.
+	mu          sync.Mutex                        // Used for Server.listen concurrent safety. -- The golang test with data race checks this.
+	listen      net.Listener                      // TCP address listener.
+	address     string                            // Server listening address.
+	handler     func(*Conn)                       // Connection handler.
+	tlsConfig   *tls.Config                       // TLS configuration.
+	ctx         context.Context                   // Context of the server, which is done if the server shuts down.
+	cancel      context.CancelFunc                // Cancel function of ctx.
+	shutdown    *jatomic.Bool                     // Whether the server is shut down.
+	connMu      sync.Mutex                        // Mutex for conns, pending and shutdown.
+	conns       map[*Conn]struct{}                // Connections being handled.
+	pending     map[net.Conn]struct{}             // Accepted connections not handled yet, eg: reading PROXY protocol header.
+	maxConns    int                               // Max concurrent connections, 0 means no limit.
+	idleTimeout time.Duration                     // Max duration of waiting for data from connection.
+	recvTimeout time.Duration                     // Timeout of each receiving from connection.
+	connState   func(conn *Conn, state ConnState) // Hook for connection state changes.
+
+	proxyProtocol      bool          // Whether PROXY protocol header is read from each connection.
+	proxyHeaderTimeout time.Duration // Timeout of reading PROXY protocol header.
+	unixSocketPerm     os.FileMode   // Permission of unix domain socket file.
 }
 
 // Map for name to server, for singleton purpose.
@@ -53,12 +75,18 @@ func GetServer(name ...interface{}) *Server {
 }
 
 // NewServer creates and returns a new normal TCP server.
+// The parameter `address` is TCP address like "127.0.0.1:80", or unix domain socket address
+// like "unix:///var/run/app.sock".
 // The parameter `name` is optional, which is used to specify the instance name of the server.
 func NewServer(address string, handler func(*Conn), name ...string) *Server {
 	s := &Server{
-		address: address,
-		handler: handler,
+		address:  address,
+		handler:  handler,
+		shutdown: jatomic.NewBool(),
+		conns:    make(map[*Conn]struct{}),
+		pending:  make(map[net.Conn]struct{}),
 	}
+	s.ctx, s.cancel = context.WithCancel(context.Background())
 	if len(name) > 0 && name[0] != "" {
 		serverMapping.Put(name[0], s)
 	}
@@ -113,6 +141,82 @@ func (s *Server) SetTLSConfig(tlsConfig *tls.Config) {
 	s.tlsConfig = tlsConfig
 }
 
+// SetUnixSocketPerm sets the permission of the socket file if the server listens on unix domain
+// socket address like "unix:///var/run/app.sock", eg: 0660. It should be called before Run.
+func (s *Server) SetUnixSocketPerm(perm os.FileMode) {
+	s.unixSocketPerm = perm
+}
+
+// SetMaxConns sets the max count of concurrent connections, 0 means no limit.
+// The server stops accepting new connections if the limit is reached, until some handled
+// connections are closed. It should be called before Run.
+func (s *Server) SetMaxConns(maxConns int) {
+	s.maxConns = maxConns
+}
+
+// SetIdleTimeout sets the max duration of waiting for data from each connection, 0 means no limit.
+// The receiving fails with timeout error if no data arrives in time. It should be called before Run.
+func (s *Server) SetIdleTimeout(timeout time.Duration) {
+	s.idleTimeout = timeout
+}
+
+// SetRecvTimeout sets the timeout of each receiving operation of the connections, 0 means no limit.
+// See Conn.SetRecvTimeout. It should be called before Run.
+func (s *Server) SetRecvTimeout(timeout time.Duration) {
+	s.recvTimeout = timeout
+}
+
+// SetConnState sets the hook that is called when the state of a connection changes.
+// It should be called before Run.
+func (s *Server) SetConnState(hook func(conn *Conn, state ConnState)) {
+	s.connState = hook
+}
+
+// Shutdown shuts down the server gracefully. It stops accepting new connections, cancels the
+// context of each connection, and waits for the handlers to return. If `ctx` is done before all
+// handlers return, it closes the remaining connections and returns the error of `ctx`.
+//
+// Note that the handler blocking on receiving does not notice the shutdown, so it should either
+// receive with timeout, or check Conn.Context between the receivings.
+func (s *Server) Shutdown(ctx context.Context) error {
+	// It is set with connMu locked, so that the accepting connection is either counted or closed.
+	s.connMu.Lock()
+	s.shutdown.Set(true)
+	s.connMu.Unlock()
+	s.cancel()
+	if err := s.Close(); err != nil {
+		intlog.Errorf(`%+v`, err)
+	}
+	ticker := time.NewTicker(shutdownPollInterval)
+	defer ticker.Stop()
+	for {
+		if s.GetConnCount() == 0 {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			s.connMu.Lock()
+			for conn := range s.conns {
+				_ = conn.Close()
+			}
+			for netConn := range s.pending {
+				_ = netConn.Close()
+			}
+			s.connMu.Unlock()
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// GetConnCount returns the count of connections being handled, including the accepted connections
+// whose PROXY protocol header is being read.
+func (s *Server) GetConnCount() int {
+	s.connMu.Lock()
+	defer s.connMu.Unlock()
+	return len(s.conns) + len(s.pending)
+}
+
 // Close closes the listener and shutdowns the server.
 func (s *Server) Close() error {
 	s.mu.Lock()
@@ -129,40 +233,159 @@ func (s *Server) Run() (err error) {
 		err = jerr.WithMsg("start running failed: socket handler not defined")
 		return
 	}
-	if s.tlsConfig != nil {
-		// TLS Server
-		s.mu.Lock()
-		s.listen, err = tls.Listen("tcp", s.address, s.tlsConfig)
-		s.mu.Unlock()
-		if err != nil {
-			err = jerr.WithMsgErrF(err, `tls.Listen failed for address "%s"`, s.address)
-			return
-		}
-	} else {
-		// Normal Server
-		var tcpAddr *net.TCPAddr
-		if tcpAddr, err = net.ResolveTCPAddr("tcp", s.address); err != nil {
-			err = jerr.WithMsgErrF(err, `net.ResolveTCPAddr failed for address "%s"`, s.address)
-			return err
-		}
-		s.mu.Lock()
-		s.listen, err = net.ListenTCP("tcp", tcpAddr)
-		s.mu.Unlock()
-		if err != nil {
-			err = jerr.WithMsgErrF(err, `net.ListenTCP failed for address "%s"`, s.address)
-			return err
-		}
+	listen, err := s.newListener()
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.listen = listen
+	s.mu.Unlock()
+	// The server might be shut down before listening.
+	if s.shutdown.Val() {
+		return s.Close()
 	}
 	// Listening loop.
+	var limiter chan struct{}
+	if s.maxConns > 0 {
+		limiter = make(chan struct{}, s.maxConns)
+	}
 	for {
+		if limiter != nil {
+			select {
+			case limiter <- struct{}{}:
+			case <-s.ctx.Done():
+				return nil
+			}
+		}
 		var conn net.Conn
 		if conn, err = s.listen.Accept(); err != nil {
+			if s.shutdown.Val() {
+				return nil
+			}
+			if IsObservabilityEnabled() {
+				getMetrics().recordAcceptError(s.address, metricErrorTypeAccept)
+			}
 			err = jerr.WithMsgErrF(err, `Listener.Accept failed`)
 			return err
 		} else if conn != nil {
-			go s.handler(NewConnByNetConn(conn))
+			// The connection is registered before serving, so that Shutdown waits for it.
+			s.connMu.Lock()
+			if s.shutdown.Val() {
+				s.connMu.Unlock()
+				_ = conn.Close()
+				return nil
+			}
+			s.pending[conn] = struct{}{}
+			s.connMu.Unlock()
+			go s.serveConn(conn, limiter)
+		} else if limiter != nil {
+			<-limiter
+		}
+	}
+}
+
+// newListener creates the listener of the server address, which is TCP address like "127.0.0.1:80",
+// or unix domain socket address like "unix:///var/run/app.sock". The stale socket file is removed
+// before listening, and the socket file is removed if the listener is closed.
+func (s *Server) newListener() (listen net.Listener, err error) {
+	network, address := unixsock.Parse(s.address, `tcp`)
+	if network == unixsock.NetworkUnixgram {
+		return nil, jerr.WithMsgF(`unsupported network "%s" for TCP server`, network)
+	}
+	if network == unixsock.NetworkUnix {
+		if err = unixsock.Prepare(network, address); err != nil {
+			return nil, err
+		}
+		if listen, err = net.Listen(network, address); err != nil {
+			return nil, jerr.WithMsgErrF(err, `net.Listen failed for address "%s"`, s.address)
+		}
+		if err = unixsock.Chmod(address, s.unixSocketPerm); err != nil {
+			_ = listen.Close()
+			return nil, err
+		}
+	} else {
+		var tcpAddr *net.TCPAddr
+		if tcpAddr, err = net.ResolveTCPAddr(network, address); err != nil {
+			return nil, jerr.WithMsgErrF(err, `net.ResolveTCPAddr failed for address "%s"`, s.address)
+		}
+		if listen, err = net.ListenTCP(network, tcpAddr); err != nil {
+			return nil, jerr.WithMsgErrF(err, `net.ListenTCP failed for address "%s"`, s.address)
+		}
+	}
+	// TLS Server, or it handshakes after reading PROXY protocol header.
+	if s.tlsConfig != nil && !s.proxyProtocol {
+		listen = tls.NewListener(listen, s.tlsConfig)
+	}
+	return listen, nil
+}
+
+// serveConn handles the accepted connection, and closes it after the handler returns.
+func (s *Server) serveConn(netConn net.Conn, limiter chan struct{}) {
+	accepted := netConn
+	if s.idleTimeout > 0 {
+		netConn = newIdleTimeoutConn(netConn, s.idleTimeout)
+	}
+	var proxyHeader *jproxyproto.Header
+	if s.proxyProtocol {
+		proxiedConn, header, err := s.readProxyHeader(netConn)
+		if err != nil {
+			if IsObservabilityEnabled() {
+				getMetrics().recordAcceptError(s.address, metricErrorTypeProxyProtocol)
+			}
+			intlog.Errorf(`%+v`, err)
+			_ = netConn.Close()
+			s.connMu.Lock()
+			delete(s.pending, accepted)
+			s.connMu.Unlock()
+			if limiter != nil {
+				<-limiter
+			}
+			return
 		}
+		netConn, proxyHeader = proxiedConn, header
+	}
+	var (
+		ctx      = s.ctx
+		observed *observedConn
+	)
+	if IsObservabilityEnabled() {
+		observed = newObservedConn(s.ctx, netConn, metricConnSideServer, s.address)
+		ctx, netConn = observed.ctx, observed
 	}
+	conn := NewConnByNetConn(netConn)
+	conn.proxyHeader = proxyHeader
+	conn.ctx, conn.cancel = context.WithCancel(ctx)
+	conn.recvTimeout = s.recvTimeout
+	s.connMu.Lock()
+	delete(s.pending, accepted)
+	s.conns[conn] = struct{}{}
+	s.connMu.Unlock()
+	if s.connState != nil {
+		s.connState(conn, ConnStateNew)
+	}
+	defer func() {
+		// The panic of the handler is recorded if observability is enabled, and it is panicked again
+		// after the connection is closed, so that it's not swallowed by the server.
+		exception := recover()
+		if exception != nil {
+			observed.recordPanic(exception)
+		}
+		conn.cancel()
+		_ = conn.Close()
+		s.connMu.Lock()
+		delete(s.conns, conn)
+		s.connMu.Unlock()
+		if limiter != nil {
+			<-limiter
+		}
+		if s.connState != nil {
+			s.connState(conn, ConnStateClosed)
+		}
+		if exception != nil {
+			panic(exception)
+		}
+	}()
+	s.handler(conn)
 }
 
 // GetListenedAddress retrieves and returns the address string which are listened by current server.
@@ -183,7 +406,9 @@ func (s *Server) GetListenedPort() int {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	if ln := s.listen; ln != nil {
-		return ln.Addr().(*net.TCPAddr).Port
+		if addr, ok := ln.Addr().(*net.TCPAddr); ok {
+			return addr.Port
+		}
 	}
 	return -1
 }
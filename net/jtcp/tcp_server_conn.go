@@ -0,0 +1,75 @@
+package jtcp
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+// ConnState is the state of a connection accepted by Server, which is reported to the hook set by
+// Server.SetConnState.
+type ConnState int
+
+const (
+	ConnStateNew    ConnState = iota // The connection is accepted and is about to be handled.
+	ConnStateClosed                  // The handler returns and the connection is closed by server.
+)
+
+// String implements interface fmt.Stringer.
+func (s ConnState) String() string {
+	switch s {
+	case ConnStateNew:
+		return "new"
+	case ConnStateClosed:
+		return "closed"
+	default:
+		return "unknown"
+	}
+}
+
+// idleTimeoutConn is a net.Conn that fails the reading if no data arrives within the idle timeout.
+// The read deadline set by user is kept, and the earlier one of it and the idle deadline takes effect.
+type idleTimeoutConn struct {
+	net.Conn
+	idleTimeout  time.Duration
+	mu           sync.Mutex
+	readDeadline time.Time // Read deadline set by user.
+}
+
+// newIdleTimeoutConn creates and returns a net.Conn with idle timeout.
+func newIdleTimeoutConn(conn net.Conn, idleTimeout time.Duration) net.Conn {
+	return &idleTimeoutConn{
+		Conn:        conn,
+		idleTimeout: idleTimeout,
+	}
+}
+
+// Read implements interface io.Reader.
+func (c *idleTimeoutConn) Read(b []byte) (int, error) {
+	c.mu.Lock()
+	deadline := time.Now().Add(c.idleTimeout)
+	if !c.readDeadline.IsZero() && c.readDeadline.Before(deadline) {
+		deadline = c.readDeadline
+	}
+	c.mu.Unlock()
+	if err := c.Conn.SetReadDeadline(deadline); err != nil {
+		return 0, err
+	}
+	return c.Conn.Read(b)
+}
+
+// SetDeadline implements interface net.Conn.
+func (c *idleTimeoutConn) SetDeadline(t time.Time) error {
+	c.mu.Lock()
+	c.readDeadline = t
+	c.mu.Unlock()
+	return c.Conn.SetDeadline(t)
+}
+
+// SetReadDeadline implements interface net.Conn.
+func (c *idleTimeoutConn) SetReadDeadline(t time.Time) error {
+	c.mu.Lock()
+	c.readDeadline = t
+	c.mu.Unlock()
+	return c.Conn.SetReadDeadline(t)
+}
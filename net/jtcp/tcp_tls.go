@@ -0,0 +1,299 @@
+package jtcp
+
+import (
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/e7coding/coding-common/errs/jerr"
+	"github.com/e7coding/coding-common/internal/intlog"
+	"github.com/e7coding/coding-common/os/jfile"
+	"github.com/e7coding/coding-common/os/jfsnotify"
+)
+
+// certReloadDelay is the delay of reloading certificate after the files change, which merges
+// the events of writing both certificate and key files.
+const certReloadDelay = 100 * time.Millisecond
+
+// CertManager manages the certificate loaded from the certificate and key files, and reloads it
+// if the files change without restarting the server. The certificate is served through
+// tls.Config.GetCertificate, so the new connections use the new certificate, and the connections
+// already established are not affected.
+//
+// The directories of the files are watched, so that the files replaced by renaming or updated by
+// symlink swapping like kubernetes secret volume are also detected. The previous certificate is kept
+// if the reloading fails, eg: the key file is not updated yet.
+//
+// Eg:
+//
+//	manager, err := jtcp.NewCertManager("server.crt", "server.key")
+//	if err != nil {
+//	    return err
+//	}
+//	defer manager.Close()
+//	s := jtcp.NewServer(":8888", handler)
+//	s.SetTLSCertManager(manager)
+type CertManager struct {
+	crtFile   string                // Absolute path of the certificate file.
+	keyFile   string                // Absolute path of the key file.
+	mu        sync.RWMutex          // Mutex for the following fields.
+	cert      *tls.Certificate      // Certificate being served.
+	timer     *time.Timer           // Timer of the delayed reloading.
+	hook      func(err error)       // Hook called after each reloading.
+	callbacks []*jfsnotify.Callback // Watching callbacks of the directories.
+	closed    bool                  // Whether the manager is closed.
+}
+
+// NewCertManager creates and returns a CertManager, which loads the certificate from `crtFile` and
+// `keyFile` and watches the files for changes.
+func NewCertManager(crtFile, keyFile string) (*CertManager, error) {
+	crtPath, err := jfile.Search(crtFile)
+	if err != nil {
+		return nil, err
+	}
+	keyPath, err := jfile.Search(keyFile)
+	if err != nil {
+		return nil, err
+	}
+	m := &CertManager{
+		crtFile: crtPath,
+		keyFile: keyPath,
+	}
+	if err = m.Reload(); err != nil {
+		return nil, err
+	}
+	dirs := []string{filepath.Dir(crtPath)}
+	if dir := filepath.Dir(keyPath); dir != dirs[0] {
+		dirs = append(dirs, dir)
+	}
+	for _, dir := range dirs {
+		callback, err := jfsnotify.Add(dir, m.onFileEvent, jfsnotify.WatchOption{NoRecursive: true})
+		if err != nil {
+			_ = m.Close()
+			return nil, err
+		}
+		m.callbacks = append(m.callbacks, callback)
+	}
+	return m, nil
+}
+
+// Reload loads the certificate from the files immediately, and replaces the certificate being
+// served if it succeeds.
+func (m *CertManager) Reload() error {
+	cert, err := tls.LoadX509KeyPair(m.crtFile, m.keyFile)
+	if err != nil {
+		return jerr.WithMsgErrF(err,
+			`tls.LoadX509KeyPair failed for certFile "%s" and keyFile "%s"`,
+			m.crtFile, m.keyFile,
+		)
+	}
+	if cert.Leaf == nil {
+		if cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0]); err != nil {
+			return jerr.WithMsgErrF(err, `x509.ParseCertificate failed for certFile "%s"`, m.crtFile)
+		}
+	}
+	m.mu.Lock()
+	m.cert = &cert
+	m.mu.Unlock()
+	return nil
+}
+
+// SetReloadHook sets the hook that is called after each reloading triggered by the file changes,
+// with the error of the reloading, which is nil if it succeeds.
+func (m *CertManager) SetReloadHook(hook func(err error)) {
+	m.mu.Lock()
+	m.hook = hook
+	m.mu.Unlock()
+}
+
+// Certificate returns the certificate being served.
+func (m *CertManager) Certificate() *tls.Certificate {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.cert
+}
+
+// GetCertificate implements tls.Config.GetCertificate, which returns the certificate being served.
+func (m *CertManager) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return m.Certificate(), nil
+}
+
+// GetClientCertificate implements tls.Config.GetClientCertificate, which returns the certificate
+// being served for the client side of mutual TLS.
+func (m *CertManager) GetClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	return m.Certificate(), nil
+}
+
+// TLSConfig creates and returns a TLS configuration using the certificate of the manager.
+func (m *CertManager) TLSConfig() *tls.Config {
+	return &tls.Config{
+		GetCertificate:       m.GetCertificate,
+		GetClientCertificate: m.GetClientCertificate,
+		Time:                 time.Now,
+		Rand:                 rand.Reader,
+	}
+}
+
+// Close stops watching the files. The certificate loaded is still served.
+func (m *CertManager) Close() error {
+	m.mu.Lock()
+	m.closed = true
+	if m.timer != nil {
+		m.timer.Stop()
+	}
+	callbacks := m.callbacks
+	m.callbacks = nil
+	m.mu.Unlock()
+	var err error
+	for _, callback := range callbacks {
+		if removeErr := jfsnotify.RemoveCallback(callback.Id); removeErr != nil {
+			err = removeErr
+		}
+	}
+	return err
+}
+
+// onFileEvent schedules the delayed reloading if the files change.
+func (m *CertManager) onFileEvent(event *jfsnotify.Event) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return
+	}
+	if m.timer != nil {
+		m.timer.Stop()
+	}
+	m.timer = time.AfterFunc(certReloadDelay, m.reloadOnChange)
+}
+
+// reloadOnChange reloads the certificate after the files change.
+func (m *CertManager) reloadOnChange() {
+	err := m.Reload()
+	if err != nil {
+		intlog.Errorf(`%+v`, err)
+	} else {
+		intlog.Printf(`certificate reloaded from "%s"`, m.crtFile)
+	}
+	m.mu.RLock()
+	hook := m.hook
+	m.mu.RUnlock()
+	if hook != nil {
+		hook(err)
+	}
+}
+
+// LoadCAPool creates and returns a certificate pool with the PEM encoded certificates in `caFile`,
+// which is used for verifying the certificates of the remote side.
+func LoadCAPool(caFile string) (*x509.CertPool, error) {
+	caPath, err := jfile.Search(caFile)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(caPath)
+	if err != nil {
+		return nil, jerr.WithMsgErrF(err, `read CA file "%s" failed`, caPath)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, jerr.WithMsgF(`no valid certificate found in CA file "%s"`, caPath)
+	}
+	return pool, nil
+}
+
+// SetTLSCertManager sets the TLS certificate of server to the certificate managed by `manager`,
+// which is reloaded if the files change. The other TLS configuration like client CA is kept.
+// It should be called before Run. Note that the manager is not closed by the server.
+func (s *Server) SetTLSCertManager(manager *CertManager) {
+	if s.tlsConfig == nil {
+		s.tlsConfig = manager.TLSConfig()
+		return
+	}
+	tlsConfig := s.tlsConfig.Clone()
+	tlsConfig.Certificates = nil
+	tlsConfig.GetCertificate = manager.GetCertificate
+	s.tlsConfig = tlsConfig
+}
+
+// SetClientCA enables mutual TLS, which verifies the client certificates against the CA bundle in
+// `caFile`. The TLS certificate of server should be set before it's called, and it should be called
+// before Run. The verified client identity can be retrieved using Conn.PeerCertificate and
+// Conn.PeerIdentity.
+//
+// The optional parameter `clientAuth` specifies the policy of client authentication, which is
+// tls.RequireAndVerifyClientCert in default. Use tls.VerifyClientCertIfGiven to accept the clients
+// without certificates.
+func (s *Server) SetClientCA(caFile string, clientAuth ...tls.ClientAuthType) error {
+	if s.tlsConfig == nil {
+		return jerr.WithMsg(`TLS certificate of server should be set before client CA`)
+	}
+	pool, err := LoadCAPool(caFile)
+	if err != nil {
+		return err
+	}
+	tlsConfig := s.tlsConfig.Clone()
+	tlsConfig.ClientCAs = pool
+	tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	if len(clientAuth) > 0 {
+		tlsConfig.ClientAuth = clientAuth[0]
+	}
+	s.tlsConfig = tlsConfig
+	return nil
+}
+
+// PeerCertificate returns the verified certificate of the remote side, or nil if the connection
+// is not TLS or the remote certificate is not verified, eg: the client of server without client CA.
+// It performs the TLS handshake if it's not done yet.
+func (c *Conn) PeerCertificate() *x509.Certificate {
+	tlsConn := c.tlsConn()
+	if tlsConn == nil {
+		return nil
+	}
+	if err := tlsConn.HandshakeContext(c.Context()); err != nil {
+		intlog.Errorf(`%+v`, err)
+		return nil
+	}
+	state := tlsConn.ConnectionState()
+	if len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return nil
+	}
+	return state.VerifiedChains[0][0]
+}
+
+// PeerIdentity returns the identity of the verified certificate of the remote side, which is the
+// first URI SAN like "spiffe://example.org/service", or else the common name of subject, or else
+// the first DNS SAN. It returns empty string if the remote certificate is not verified.
+func (c *Conn) PeerIdentity() string {
+	cert := c.PeerCertificate()
+	switch {
+	case cert == nil:
+		return ""
+	case len(cert.URIs) > 0:
+		return cert.URIs[0].String()
+	case cert.Subject.CommonName != "":
+		return cert.Subject.CommonName
+	case len(cert.DNSNames) > 0:
+		return cert.DNSNames[0]
+	}
+	return ""
+}
+
+// tlsConn returns the underlying TLS connection, or nil if it's not TLS.
+func (c *Conn) tlsConn() *tls.Conn {
+	netConn := c.Conn
+	for {
+		switch conn := netConn.(type) {
+		case *tls.Conn:
+			return conn
+		case *idleTimeoutConn:
+			netConn = conn.Conn
+		case *observedConn:
+			netConn = conn.Conn
+		default:
+			return nil
+		}
+	}
+}
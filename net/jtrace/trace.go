@@ -11,6 +11,8 @@ import (
 	"context"
 	"github.com/e7coding/coding-common/container/jmap"
 	"github.com/e7coding/coding-common/errs/jerr"
+	"github.com/e7coding/coding-common/internal/command"
+	"github.com/e7coding/coding-common/internal/intlog"
 	"os"
 	"strings"
 
@@ -32,6 +34,7 @@ const (
 	tracingCommonKeyIpHostname        = `hostname`
 	commandEnvKeyForMaxContentLogSize = "gf.gtrace.max.content.log.size" // To avoid too big tracing content.
 	commandEnvKeyForTracingInternal   = "gf.gtrace.tracing.internal"     // For detailed controlling for tracing content.
+	commandEnvKeyForPropagators       = "gf.gtrace.propagators"          // Names of the propagators, like "tracecontext,baggage,b3".
 )
 
 var (
@@ -50,6 +53,12 @@ var (
 func init() {
 	// Default trace provider.
 	otel.SetTracerProvider(provider.New())
+	// Propagators selected by command option or environment.
+	if names := command.GetOptWithEnv(commandEnvKeyForPropagators); names != "" {
+		if err := SetPropagators(names); err != nil {
+			intlog.Errorf(`%+v`, err)
+		}
+	}
 	CheckSetDefaultTextMapPropagator()
 }
 
@@ -56,7 +56,11 @@ func (c Carrier) String() string {
 }
 
 // UnmarshalJSON implements interface UnmarshalJSON for package json.
-func (c Carrier) UnmarshalJSON(b []byte) error {
-	carrier := NewCarrier(nil)
-	return json.UnmarshalUseNumber(b, carrier)
+func (c *Carrier) UnmarshalJSON(b []byte) error {
+	var data map[string]interface{}
+	if err := json.UnmarshalUseNumber(b, &data); err != nil {
+		return err
+	}
+	*c = NewCarrier(data)
+	return nil
 }
@@ -0,0 +1,196 @@
+package jtrace
+
+import (
+	"context"
+	"encoding/binary"
+	"sort"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+
+	"github.com/e7coding/coding-common/errs/jerr"
+	"github.com/e7coding/coding-common/internal/json"
+	"github.com/e7coding/coding-common/jredis"
+)
+
+const (
+	// carrierFrameSizeLength is the length of the carrier size in the carrier frame.
+	carrierFrameSizeLength = 2
+	// carrierFrameMaxSize is the max size of the carrier in the carrier frame.
+	carrierFrameMaxSize = 0xFFFF
+)
+
+// InjectCarrier creates and returns a Carrier with the propagation data of `ctx` injected by the
+// global propagator, which can be converted to the formats of various transports by its adapters.
+//
+// Eg:
+//
+//	// Kafka-style message headers.
+//	msg.Headers = jtrace.InjectCarrier(ctx).Headers()
+//	// Environment variables of child process.
+//	cmd.Env = append(cmd.Env, jtrace.InjectCarrier(ctx).Environ()...)
+//	// Payload of redis pub/sub message.
+//	payload, err := jtrace.InjectCarrier(ctx).RedisPayload(message)
+func InjectCarrier(ctx context.Context) Carrier {
+	carrier := NewCarrier()
+	otel.GetTextMapPropagator().Inject(ctx, carrier)
+	return carrier
+}
+
+// ExtractCarrier returns the context derived from `ctx` with the propagation data of `carrier`
+// extracted by the global propagator.
+//
+// Eg:
+//
+//	ctx = jtrace.ExtractCarrier(ctx, jtrace.NewCarrierFromHeaders(msg.Headers))
+func ExtractCarrier(ctx context.Context, carrier Carrier) context.Context {
+	return otel.GetTextMapPropagator().Extract(ctx, carrier)
+}
+
+// NewCarrierFromHeaders creates and returns a Carrier from the Kafka-style message headers.
+// The header keys are converted to lowercase, as the propagators use lowercase keys.
+func NewCarrierFromHeaders(headers map[string][]byte) Carrier {
+	carrier := NewCarrier()
+	for key, value := range headers {
+		carrier.Set(strings.ToLower(key), string(value))
+	}
+	return carrier
+}
+
+// Headers converts and returns the carrier as Kafka-style message headers.
+func (c Carrier) Headers() map[string][]byte {
+	headers := make(map[string][]byte, len(c))
+	for key := range c {
+		headers[key] = []byte(c.Get(key))
+	}
+	return headers
+}
+
+// NewCarrierFromEnviron creates and returns a Carrier from the environment variables `environ`
+// in format "KEY=value", like os.Environ(). As the environment variable names are converted by
+// Environ and cannot be converted back, only the keys of `fields` are read, which are the fields
+// of the global propagator in default. The variable named as the key itself is also read if the
+// converted name does not exist.
+func NewCarrierFromEnviron(environ []string, fields ...string) Carrier {
+	if len(fields) == 0 {
+		fields = otel.GetTextMapPropagator().Fields()
+	}
+	var (
+		carrier = NewCarrier()
+		values  = make(map[string]string, len(environ))
+	)
+	for _, item := range environ {
+		if name, value, ok := strings.Cut(item, "="); ok {
+			values[name] = value
+		}
+	}
+	for _, field := range fields {
+		if value, ok := values[carrierEnvName(field)]; ok {
+			carrier.Set(field, value)
+		} else if value, ok = values[field]; ok {
+			carrier.Set(field, value)
+		}
+	}
+	return carrier
+}
+
+// Environ converts and returns the carrier as environment variables in format "KEY=value" sorted
+// by name. The keys are converted to uppercase and the characters other than letters and digits
+// are replaced with "_", as the shells drop the variables having invalid names, eg:
+// "uber-trace-id" is converted to "UBER_TRACE_ID".
+func (c Carrier) Environ() []string {
+	environ := make([]string, 0, len(c))
+	for key := range c {
+		environ = append(environ, carrierEnvName(key)+"="+c.Get(key))
+	}
+	sort.Strings(environ)
+	return environ
+}
+
+// AppendFrame appends the carrier frame to `b` and returns the extended buffer, which is used for
+// prefixing the binary payload like jtcp package and message of pub/sub with the carrier:
+// CarrierSize(16bit)|Carrier(JSON).
+func (c Carrier) AppendFrame(b []byte) ([]byte, error) {
+	carrierBytes, err := json.Marshal(c)
+	if err != nil {
+		return nil, jerr.WithMsgErr(err, `marshal trace carrier failed`)
+	}
+	if len(carrierBytes) > carrierFrameMaxSize {
+		return nil, jerr.WithMsgF(
+			`trace carrier too long, carrier size %d exceeds %d`, len(carrierBytes), carrierFrameMaxSize,
+		)
+	}
+	b = binary.BigEndian.AppendUint16(b, uint16(len(carrierBytes)))
+	return append(b, carrierBytes...), nil
+}
+
+// ParseCarrierFrame parses the carrier frame appended by AppendFrame from the beginning of `data`,
+// and returns the carrier and the remaining payload.
+func ParseCarrierFrame(data []byte) (carrier Carrier, payload []byte, err error) {
+	if len(data) < carrierFrameSizeLength {
+		return nil, nil, jerr.WithMsgF(`invalid data size %d for trace carrier frame`, len(data))
+	}
+	size := int(binary.BigEndian.Uint16(data))
+	if len(data) < carrierFrameSizeLength+size {
+		return nil, nil, jerr.WithMsgF(`invalid trace carrier size %d`, size)
+	}
+	carrier = NewCarrier()
+	if err = json.UnmarshalUseNumber(data[carrierFrameSizeLength:carrierFrameSizeLength+size], &carrier); err != nil {
+		return nil, nil, jerr.WithMsgErr(err, `unmarshal trace carrier failed`)
+	}
+	return carrier, data[carrierFrameSizeLength+size:], nil
+}
+
+// RedisPayload returns `payload` prefixed with the carrier frame, which is published as the redis
+// pub/sub message, as redis pub/sub has no message headers. The subscribers should parse the received
+// message using NewCarrierFromRedisMessage.
+//
+// Eg:
+//
+//	payload, err := jtrace.InjectCarrier(ctx).RedisPayload(message)
+//	if err != nil {
+//	    return err
+//	}
+//	_, err = redis.GroupPubSub().Publish(channel, payload)
+func (c Carrier) RedisPayload(payload string) (string, error) {
+	b, err := c.AppendFrame(make([]byte, 0, carrierFrameSizeLength+len(payload)+64))
+	if err != nil {
+		return "", err
+	}
+	return string(append(b, payload...)), nil
+}
+
+// NewCarrierFromRedisMessage parses the redis pub/sub message `msg` published with the payload
+// created by RedisPayload, and returns the carrier and the original payload.
+//
+// Eg:
+//
+//	carrier, payload, err := jtrace.NewCarrierFromRedisMessage(msg)
+//	if err != nil {
+//	    return err
+//	}
+//	ctx = jtrace.ExtractCarrier(ctx, carrier)
+func NewCarrierFromRedisMessage(msg *jredis.Message) (carrier Carrier, payload string, err error) {
+	if msg == nil {
+		return nil, "", jerr.WithMsg(`redis message is nil`)
+	}
+	carrier, data, err := ParseCarrierFrame([]byte(msg.Payload))
+	if err != nil {
+		return nil, "", err
+	}
+	return carrier, string(data), nil
+}
+
+// carrierEnvName converts and returns the environment variable name of carrier `key`.
+func carrierEnvName(key string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		default:
+			return '_'
+		}
+	}, key)
+}
@@ -0,0 +1,194 @@
+package jtrace
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdkTrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+
+	"github.com/e7coding/coding-common/errs/jerr"
+	"github.com/e7coding/coding-common/net/jtrace/internal/provider"
+)
+
+// Options is the options for Setup, which configures the built-in exporters of the tracer provider.
+type Options struct {
+	// ServiceName is the service name of the spans, which is the name of current process in default.
+	ServiceName string
+
+	// File enables the file exporter that writes spans as JSON lines to a rotating file if it's not nil.
+	// The spans are exported in batch asynchronously.
+	File *FileExporterOption
+
+	// Stdout enables the pretty stdout exporter for local development.
+	// The spans are exported synchronously once they end.
+	Stdout bool
+
+	// Memory enables the in-memory exporter if it's not nil, which is usually used in tests to
+	// assert the spans. The spans are exported synchronously once they end.
+	Memory *MemoryExporter
+
+	// Exporters are the additional exporters, like the OTLP exporters, whose spans are exported
+	// in batch asynchronously.
+	Exporters []sdkTrace.SpanExporter
+
+	// Propagators are the names of the propagators for NewPropagator, which set the global propagator
+	// if it's not empty, like []string{"tracecontext", "baggage", "b3"}.
+	Propagators []string
+
+	// Sampling is the sampling option, which is set by SetSampling if it's not nil, and can be
+	// changed by SetSampling at runtime. It samples all the root spans in default.
+	Sampling *SamplingOption
+}
+
+// SpanData is the exported data of a span, which is written as a JSON line by FileExporter.
+type SpanData struct {
+	TraceID      string                 `json:"traceId"`
+	SpanID       string                 `json:"spanId"`
+	ParentSpanID string                 `json:"parentSpanId,omitempty"`
+	Name         string                 `json:"name"`
+	Kind         string                 `json:"kind"`
+	StartTime    time.Time              `json:"startTime"`
+	EndTime      time.Time              `json:"endTime"`
+	Duration     time.Duration          `json:"duration"`
+	StatusCode   string                 `json:"statusCode"`
+	StatusDesc   string                 `json:"statusDesc,omitempty"`
+	Attributes   map[string]interface{} `json:"attributes,omitempty"`
+	Events       []SpanEventData        `json:"events,omitempty"`
+	Service      string                 `json:"service,omitempty"`
+	Scope        string                 `json:"scope,omitempty"`
+}
+
+// SpanEventData is the exported data of a span event.
+type SpanEventData struct {
+	Name       string                 `json:"name"`
+	Time       time.Time              `json:"time"`
+	Attributes map[string]interface{} `json:"attributes,omitempty"`
+}
+
+// Setup creates a tracer provider with the exporters configured by `options`, and sets it as the
+// global tracer provider. The returned function `shutdown` flushes the spans and closes the
+// exporters, which should be called before the process exits.
+//
+// Eg:
+//
+//	shutdown, err := jtrace.Setup(jtrace.Options{
+//	    ServiceName: "order",
+//	    File:        &jtrace.FileExporterOption{Path: "/var/log/order/spans.log"},
+//	    Stdout:      true,
+//	})
+//	if err != nil {
+//	    return err
+//	}
+//	defer shutdown(context.Background())
+func Setup(options Options) (shutdown func(ctx context.Context) error, err error) {
+	if options.ServiceName == "" {
+		options.ServiceName = filepath.Base(os.Args[0])
+	}
+	res, err := resource.Merge(
+		resource.Default(),
+		resource.NewSchemaless(semconv.ServiceName(options.ServiceName)),
+	)
+	if err != nil {
+		return nil, jerr.WithMsgErr(err, `create tracing resource failed`)
+	}
+	if len(options.Propagators) > 0 {
+		if err = SetPropagators(options.Propagators...); err != nil {
+			return nil, err
+		}
+	}
+	var processors []sdkTrace.SpanProcessor
+	if options.File != nil {
+		fileExporter, err := NewFileExporter(*options.File)
+		if err != nil {
+			return nil, err
+		}
+		processors = append(processors, sdkTrace.NewBatchSpanProcessor(fileExporter))
+	}
+	if options.Stdout {
+		processors = append(processors, sdkTrace.NewSimpleSpanProcessor(NewStdoutExporter()))
+	}
+	if options.Memory != nil {
+		processors = append(processors, sdkTrace.NewSimpleSpanProcessor(options.Memory))
+	}
+	for _, exporter := range options.Exporters {
+		processors = append(processors, sdkTrace.NewBatchSpanProcessor(exporter))
+	}
+	if options.Sampling != nil {
+		SetSampling(*options.Sampling)
+	}
+	tracerProvider := sdkTrace.NewTracerProvider(
+		sdkTrace.WithIDGenerator(provider.NewIDGenerator()),
+		sdkTrace.WithResource(res),
+		sdkTrace.WithSampler(GetSampler()),
+		sdkTrace.WithSpanProcessor(newTailSamplingProcessor(processors)),
+	)
+	otel.SetTracerProvider(tracerProvider)
+	CheckSetDefaultTextMapPropagator()
+	return tracerProvider.Shutdown, nil
+}
+
+// newSpanData converts and returns the exported data of `span`.
+func newSpanData(span sdkTrace.ReadOnlySpan) *SpanData {
+	data := &SpanData{
+		TraceID:    span.SpanContext().TraceID().String(),
+		SpanID:     span.SpanContext().SpanID().String(),
+		Name:       span.Name(),
+		Kind:       span.SpanKind().String(),
+		StartTime:  span.StartTime(),
+		EndTime:    span.EndTime(),
+		Duration:   span.EndTime().Sub(span.StartTime()),
+		StatusCode: span.Status().Code.String(),
+		StatusDesc: span.Status().Description,
+		Scope:      span.InstrumentationScope().Name,
+	}
+	if parent := span.Parent(); parent.SpanID().IsValid() {
+		data.ParentSpanID = parent.SpanID().String()
+	}
+	if attrs := span.Attributes(); len(attrs) > 0 {
+		data.Attributes = make(map[string]interface{}, len(attrs))
+		for _, attr := range attrs {
+			data.Attributes[string(attr.Key)] = attr.Value.AsInterface()
+		}
+	}
+	for _, event := range span.Events() {
+		eventData := SpanEventData{
+			Name: event.Name,
+			Time: event.Time,
+		}
+		if len(event.Attributes) > 0 {
+			eventData.Attributes = make(map[string]interface{}, len(event.Attributes))
+			for _, attr := range event.Attributes {
+				eventData.Attributes[string(attr.Key)] = attr.Value.AsInterface()
+			}
+		}
+		data.Events = append(data.Events, eventData)
+	}
+	if res := span.Resource(); res != nil {
+		if value, ok := res.Set().Value(semconv.ServiceNameKey); ok {
+			data.Service = value.AsString()
+		}
+	}
+	return data
+}
+
+// isRootSpan checks whether `data` has no parent span in the spans of `spanIds`.
+func isRootSpan(data *SpanData, spanIds map[string]struct{}) bool {
+	if data.ParentSpanID == "" {
+		return true
+	}
+	_, ok := spanIds[data.ParentSpanID]
+	return !ok
+}
+
+// sortSpansByStartTime sorts `spans` by their start time stably.
+func sortSpansByStartTime(spans []*SpanData) {
+	sort.SliceStable(spans, func(i, j int) bool {
+		return spans[i].StartTime.Before(spans[j].StartTime)
+	})
+}
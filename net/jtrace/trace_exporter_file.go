@@ -0,0 +1,145 @@
+package jtrace
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	sdkTrace "go.opentelemetry.io/otel/sdk/trace"
+
+	"github.com/e7coding/coding-common/errs/jerr"
+	"github.com/e7coding/coding-common/internal/json"
+)
+
+const (
+	defaultFileExporterMaxSize    = 100 * 1024 * 1024
+	defaultFileExporterMaxBackups = 5
+)
+
+// FileExporterOption is the option for FileExporter.
+type FileExporterOption struct {
+	// Path is the file path that the spans are written to, which is required.
+	// Its parent directory is created if it does not exist.
+	Path string
+
+	// MaxSize is the max size in bytes of the file before it gets rotated, which is 100MB in default.
+	MaxSize int64
+
+	// MaxBackups is the max count of the rotated files to retain, which is 5 in default.
+	// The rotated files are named as "Path.1", "Path.2"..., in which "Path.1" is the newest one.
+	MaxBackups int
+}
+
+// FileExporter is a span exporter that writes spans as JSON lines to a size-based rotating file.
+type FileExporter struct {
+	mu     sync.Mutex
+	option FileExporterOption
+	file   *os.File
+	size   int64
+	closed bool
+}
+
+// NewFileExporter creates and returns a FileExporter writing to `option.Path`.
+func NewFileExporter(option FileExporterOption) (*FileExporter, error) {
+	if option.Path == "" {
+		return nil, jerr.WithMsg(`file path of span exporter should not be empty`)
+	}
+	if option.MaxSize <= 0 {
+		option.MaxSize = defaultFileExporterMaxSize
+	}
+	if option.MaxBackups <= 0 {
+		option.MaxBackups = defaultFileExporterMaxBackups
+	}
+	if err := os.MkdirAll(filepath.Dir(option.Path), 0755); err != nil {
+		return nil, jerr.WithMsgErrF(err, `create directory failed for span file "%s"`, option.Path)
+	}
+	e := &FileExporter{option: option}
+	if err := e.open(); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// ExportSpans writes `spans` as JSON lines to the file, implementing sdkTrace.SpanExporter.
+func (e *FileExporter) ExportSpans(ctx context.Context, spans []sdkTrace.ReadOnlySpan) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.closed {
+		return nil
+	}
+	for _, span := range spans {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		line, err := json.Marshal(newSpanData(span))
+		if err != nil {
+			return jerr.WithMsgErr(err, `marshal span data failed`)
+		}
+		line = append(line, '\n')
+		if e.size > 0 && e.size+int64(len(line)) > e.option.MaxSize {
+			if err = e.rotate(); err != nil {
+				return err
+			}
+		}
+		n, err := e.file.Write(line)
+		e.size += int64(n)
+		if err != nil {
+			return jerr.WithMsgErrF(err, `write span file "%s" failed`, e.option.Path)
+		}
+	}
+	return nil
+}
+
+// Shutdown closes the file, implementing sdkTrace.SpanExporter.
+func (e *FileExporter) Shutdown(ctx context.Context) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.closed {
+		return nil
+	}
+	e.closed = true
+	if err := e.file.Close(); err != nil {
+		return jerr.WithMsgErrF(err, `close span file "%s" failed`, e.option.Path)
+	}
+	return nil
+}
+
+// open opens the file for appending and records its current size.
+func (e *FileExporter) open() error {
+	file, err := os.OpenFile(e.option.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return jerr.WithMsgErrF(err, `open span file "%s" failed`, e.option.Path)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return jerr.WithMsgErrF(err, `stat span file "%s" failed`, e.option.Path)
+	}
+	e.file, e.size = file, info.Size()
+	return nil
+}
+
+// rotate closes the current file, shifts the backups by one and opens a new file.
+// The oldest backup exceeding MaxBackups is removed.
+func (e *FileExporter) rotate() error {
+	if err := e.file.Close(); err != nil {
+		return jerr.WithMsgErrF(err, `close span file "%s" failed`, e.option.Path)
+	}
+	_ = os.Remove(e.backupPath(e.option.MaxBackups))
+	for i := e.option.MaxBackups - 1; i >= 1; i-- {
+		if err := os.Rename(e.backupPath(i), e.backupPath(i+1)); err != nil && !os.IsNotExist(err) {
+			return jerr.WithMsgErrF(err, `rotate span file "%s" failed`, e.backupPath(i))
+		}
+	}
+	if err := os.Rename(e.option.Path, e.backupPath(1)); err != nil && !os.IsNotExist(err) {
+		return jerr.WithMsgErrF(err, `rotate span file "%s" failed`, e.option.Path)
+	}
+	return e.open()
+}
+
+// backupPath returns the path of the `index`th rotated file.
+func (e *FileExporter) backupPath(index int) string {
+	return fmt.Sprintf(`%s.%d`, e.option.Path, index)
+}
@@ -0,0 +1,105 @@
+package jtrace
+
+import (
+	"context"
+	"sync"
+
+	sdkTrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// MemoryExporter is a span exporter that stores spans in memory, which is usually used in tests to
+// assert the exported spans and their trees.
+//
+// Eg:
+//
+//	exporter := jtrace.NewMemoryExporter()
+//	shutdown, _ := jtrace.Setup(jtrace.Options{Memory: exporter})
+//	defer shutdown(ctx)
+//	// ... run the code creating spans ...
+//	roots := exporter.Tree()
+//	if len(roots) != 1 || roots[0].Children[0].Name != "jtcp.SendRecvPkg" {
+//	    t.Fatal("unexpected span tree")
+//	}
+type MemoryExporter struct {
+	mu    sync.RWMutex
+	spans []*SpanData
+}
+
+// SpanNode is a node of the span tree, which holds the span and its children spans.
+type SpanNode struct {
+	*SpanData
+	Children []*SpanNode // Children spans ordered by their start time.
+}
+
+// NewMemoryExporter creates and returns a MemoryExporter.
+func NewMemoryExporter() *MemoryExporter {
+	return &MemoryExporter{}
+}
+
+// ExportSpans stores `spans` in memory, implementing sdkTrace.SpanExporter.
+func (e *MemoryExporter) ExportSpans(ctx context.Context, spans []sdkTrace.ReadOnlySpan) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, span := range spans {
+		e.spans = append(e.spans, newSpanData(span))
+	}
+	return nil
+}
+
+// Shutdown implements sdkTrace.SpanExporter, which does nothing and the stored spans are retained.
+func (e *MemoryExporter) Shutdown(ctx context.Context) error {
+	return nil
+}
+
+// Spans returns a copy of the stored spans in their exported order.
+func (e *MemoryExporter) Spans() []*SpanData {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	spans := make([]*SpanData, len(e.spans))
+	copy(spans, e.spans)
+	return spans
+}
+
+// FindByName returns the stored spans whose name is `name`.
+func (e *MemoryExporter) FindByName(name string) []*SpanData {
+	var spans []*SpanData
+	for _, span := range e.Spans() {
+		if span.Name == name {
+			spans = append(spans, span)
+		}
+	}
+	return spans
+}
+
+// Reset removes all the stored spans.
+func (e *MemoryExporter) Reset() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = nil
+}
+
+// Tree builds and returns the trees of the stored spans, returning their roots ordered by start time.
+// A span whose parent is not stored, like a remote parent, is treated as a root.
+func (e *MemoryExporter) Tree() []*SpanNode {
+	var (
+		spans   = e.Spans()
+		spanIds = make(map[string]struct{}, len(spans))
+		nodes   = make(map[string]*SpanNode, len(spans))
+		roots   []*SpanNode
+	)
+	sortSpansByStartTime(spans)
+	for _, span := range spans {
+		spanIds[span.SpanID] = struct{}{}
+		nodes[span.SpanID] = &SpanNode{SpanData: span}
+	}
+	for _, span := range spans {
+		node := nodes[span.SpanID]
+		if isRootSpan(span, spanIds) {
+			roots = append(roots, node)
+			continue
+		}
+		parent := nodes[span.ParentSpanID]
+		parent.Children = append(parent.Children, node)
+	}
+	return roots
+}
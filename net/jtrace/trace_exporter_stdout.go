@@ -0,0 +1,91 @@
+package jtrace
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+
+	sdkTrace "go.opentelemetry.io/otel/sdk/trace"
+
+	"github.com/e7coding/coding-common/errs/jerr"
+)
+
+// StdoutExporter is a span exporter that writes spans in human-readable format, for local development.
+type StdoutExporter struct {
+	mu     sync.Mutex
+	writer io.Writer
+}
+
+// NewStdoutExporter creates and returns a StdoutExporter.
+// The optional parameter `writer` specifies the writer of the spans, which is os.Stdout in default.
+//
+// Each span is written like:
+//
+//	[2024-01-02 15:04:05.000] SPAN jtcp.Server.Conn (server) 1.52ms Unset
+//	  trace=4bf92f3577b34da6a3ce929d0e0e4736 span=00f067aa0ba902b7 parent=53995c3f42cd8ad8
+//	  net.address.remote=127.0.0.1:53210
+//	  event judp.handler.panic at 15:04:05.001
+func NewStdoutExporter(writer ...io.Writer) *StdoutExporter {
+	e := &StdoutExporter{writer: os.Stdout}
+	if len(writer) > 0 && writer[0] != nil {
+		e.writer = writer[0]
+	}
+	return e
+}
+
+// ExportSpans writes `spans` to the writer, implementing sdkTrace.SpanExporter.
+func (e *StdoutExporter) ExportSpans(ctx context.Context, spans []sdkTrace.ReadOnlySpan) error {
+	var buffer bytes.Buffer
+	for _, span := range spans {
+		writeSpanText(&buffer, newSpanData(span))
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if _, err := e.writer.Write(buffer.Bytes()); err != nil {
+		return jerr.WithMsgErr(err, `write spans to stdout failed`)
+	}
+	return nil
+}
+
+// Shutdown implements sdkTrace.SpanExporter, which does nothing.
+func (e *StdoutExporter) Shutdown(ctx context.Context) error {
+	return nil
+}
+
+// writeSpanText writes human-readable text of `data` to `buffer`.
+func writeSpanText(buffer *bytes.Buffer, data *SpanData) {
+	fmt.Fprintf(
+		buffer, "[%s] SPAN %s (%s) %s %s",
+		data.StartTime.Format(`2006-01-02 15:04:05.000`),
+		data.Name, data.Kind, data.Duration, data.StatusCode,
+	)
+	if data.StatusDesc != "" {
+		fmt.Fprintf(buffer, ": %s", data.StatusDesc)
+	}
+	fmt.Fprintf(buffer, "\n  trace=%s span=%s", data.TraceID, data.SpanID)
+	if data.ParentSpanID != "" {
+		fmt.Fprintf(buffer, " parent=%s", data.ParentSpanID)
+	}
+	buffer.WriteByte('\n')
+	writeAttributesText(buffer, "  ", data.Attributes)
+	for _, event := range data.Events {
+		fmt.Fprintf(buffer, "  event %s at %s\n", event.Name, event.Time.Format(`15:04:05.000`))
+		writeAttributesText(buffer, "    ", event.Attributes)
+	}
+}
+
+// writeAttributesText writes `attributes` sorted by key to `buffer`, one per line.
+func writeAttributesText(buffer *bytes.Buffer, indent string, attributes map[string]interface{}) {
+	keys := make([]string, 0, len(attributes))
+	for key := range attributes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fmt.Fprintf(buffer, "%s%s=%v\n", indent, key, attributes[key])
+	}
+}
@@ -0,0 +1,71 @@
+package jtrace
+
+import (
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+
+	"github.com/e7coding/coding-common/errs/jerr"
+)
+
+// Names of the propagators for NewPropagator, which are the same as the names of environment
+// variable OTEL_PROPAGATORS of OpenTelemetry.
+const (
+	PropagatorTraceContext = "tracecontext" // W3C trace context.
+	PropagatorBaggage      = "baggage"      // W3C baggage.
+	PropagatorB3           = "b3"           // B3 single header "b3".
+	PropagatorB3Multi      = "b3multi"      // B3 multiple headers "x-b3-*".
+	PropagatorJaeger       = "jaeger"       // Jaeger header "uber-trace-id" and baggage headers "uberctx-*".
+)
+
+// NewPropagator creates and returns a composite propagator of the propagators by `names`, in which
+// each name can also be multiple names joined with ",", like "tracecontext,baggage,b3".
+// It returns the default propagator of W3C trace context and baggage if no name is given.
+//
+// As all the propagators of the composite propagator inject into and extract from the carrier in
+// order, the latter one takes precedence in extracting if the carrier has multiple formats.
+func NewPropagator(names ...string) (propagation.TextMapPropagator, error) {
+	var propagators []propagation.TextMapPropagator
+	for _, joined := range names {
+		for _, name := range strings.Split(joined, ",") {
+			name = strings.ToLower(strings.TrimSpace(name))
+			switch name {
+			case "":
+				continue
+			case PropagatorTraceContext:
+				propagators = append(propagators, propagation.TraceContext{})
+			case PropagatorBaggage:
+				propagators = append(propagators, propagation.Baggage{})
+			case PropagatorB3:
+				propagators = append(propagators, B3Propagator{})
+			case PropagatorB3Multi:
+				propagators = append(propagators, B3Propagator{MultipleHeader: true})
+			case PropagatorJaeger:
+				propagators = append(propagators, JaegerPropagator{})
+			default:
+				return nil, jerr.WithMsgF(`unsupported propagator "%s"`, name)
+			}
+		}
+	}
+	if len(propagators) == 0 {
+		return GetDefaultTextMapPropagator(), nil
+	}
+	return propagation.NewCompositeTextMapPropagator(propagators...), nil
+}
+
+// SetPropagators sets the global propagator created by NewPropagator with `names`.
+//
+// Eg:
+//
+//	if err := jtrace.SetPropagators("tracecontext", "baggage", "b3multi", "jaeger"); err != nil {
+//	    return err
+//	}
+func SetPropagators(names ...string) error {
+	propagator, err := NewPropagator(names...)
+	if err != nil {
+		return err
+	}
+	otel.SetTextMapPropagator(propagator)
+	return nil
+}
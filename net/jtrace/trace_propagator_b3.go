@@ -0,0 +1,141 @@
+package jtrace
+
+import (
+	"context"
+	"strings"
+
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	b3SingleHeader  = "b3"
+	b3TraceIDHeader = "x-b3-traceid"
+	b3SpanIDHeader  = "x-b3-spanid"
+	b3SampledHeader = "x-b3-sampled"
+	b3FlagsHeader   = "x-b3-flags"
+	b3Sampled       = "1"
+	b3NotSampled    = "0"
+	b3Debug         = "d"
+)
+
+// B3Propagator propagates the span context in B3 format of Zipkin.
+// It injects the single header "b3" in default, or the multiple headers "x-b3-*" if MultipleHeader
+// is true, and it extracts from both of them, in which the single header takes precedence.
+type B3Propagator struct {
+	// MultipleHeader specifies injecting the multiple headers "x-b3-*" instead of the single header "b3".
+	MultipleHeader bool
+}
+
+var _ propagation.TextMapPropagator = B3Propagator{}
+
+// Inject sets the span context of `ctx` into `carrier`.
+func (p B3Propagator) Inject(ctx context.Context, carrier propagation.TextMapCarrier) {
+	spanContext := trace.SpanContextFromContext(ctx)
+	if !spanContext.IsValid() {
+		return
+	}
+	sampled := b3NotSampled
+	if spanContext.IsSampled() {
+		sampled = b3Sampled
+	}
+	if p.MultipleHeader {
+		carrier.Set(b3TraceIDHeader, spanContext.TraceID().String())
+		carrier.Set(b3SpanIDHeader, spanContext.SpanID().String())
+		carrier.Set(b3SampledHeader, sampled)
+		return
+	}
+	carrier.Set(b3SingleHeader, strings.Join([]string{
+		spanContext.TraceID().String(), spanContext.SpanID().String(), sampled,
+	}, "-"))
+}
+
+// Extract reads the span context from `carrier` into the returned context derived from `ctx`.
+// It returns `ctx` if there's no valid span context in `carrier`.
+func (p B3Propagator) Extract(ctx context.Context, carrier propagation.TextMapCarrier) context.Context {
+	var (
+		spanContext trace.SpanContext
+		ok          bool
+	)
+	if header := carrier.Get(b3SingleHeader); header != "" {
+		spanContext, ok = parseB3Single(header)
+	} else {
+		spanContext, ok = parseB3Multiple(carrier)
+	}
+	if !ok {
+		return ctx
+	}
+	return trace.ContextWithRemoteSpanContext(ctx, spanContext)
+}
+
+// Fields returns the headers that Inject sets.
+func (p B3Propagator) Fields() []string {
+	if p.MultipleHeader {
+		return []string{b3TraceIDHeader, b3SpanIDHeader, b3SampledHeader}
+	}
+	return []string{b3SingleHeader}
+}
+
+// parseB3Single parses the single header in format "{TraceId}-{SpanId}-{SamplingState}-{ParentSpanId}",
+// in which the last two parts are optional.
+func parseB3Single(header string) (trace.SpanContext, bool) {
+	parts := strings.Split(header, "-")
+	if len(parts) < 2 || len(parts) > 4 {
+		// The header having only sampling state is not propagated as there's no span context.
+		return trace.SpanContext{}, false
+	}
+	sampled := ""
+	if len(parts) > 2 {
+		sampled = parts[2]
+	}
+	return newB3SpanContext(parts[0], parts[1], sampled, "")
+}
+
+// parseB3Multiple parses the multiple headers "x-b3-*".
+func parseB3Multiple(carrier propagation.TextMapCarrier) (trace.SpanContext, bool) {
+	return newB3SpanContext(
+		carrier.Get(b3TraceIDHeader),
+		carrier.Get(b3SpanIDHeader),
+		carrier.Get(b3SampledHeader),
+		carrier.Get(b3FlagsHeader),
+	)
+}
+
+// newB3SpanContext creates and returns the remote span context of B3 values.
+// The trace id in 16 hex characters is padded to 32 characters with leading zeros.
+func newB3SpanContext(traceIDHex, spanIDHex, sampled, flags string) (trace.SpanContext, bool) {
+	if len(traceIDHex) != 16 && len(traceIDHex) != 32 {
+		return trace.SpanContext{}, false
+	}
+	traceID, err := trace.TraceIDFromHex(padTraceIDHex(traceIDHex))
+	if err != nil {
+		return trace.SpanContext{}, false
+	}
+	spanID, err := trace.SpanIDFromHex(spanIDHex)
+	if err != nil {
+		return trace.SpanContext{}, false
+	}
+	var traceFlags trace.TraceFlags
+	switch {
+	case flags == b3Sampled, sampled == b3Debug, sampled == b3Sampled, strings.EqualFold(sampled, "true"):
+		traceFlags = trace.FlagsSampled
+	case sampled == "", sampled == b3NotSampled, strings.EqualFold(sampled, "false"):
+	default:
+		return trace.SpanContext{}, false
+	}
+	spanContext := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    traceID,
+		SpanID:     spanID,
+		TraceFlags: traceFlags,
+		Remote:     true,
+	})
+	return spanContext, spanContext.IsValid()
+}
+
+// padTraceIDHex pads the trace id hex string to 32 characters with leading zeros.
+func padTraceIDHex(traceIDHex string) string {
+	if len(traceIDHex) >= 32 {
+		return traceIDHex
+	}
+	return strings.Repeat("0", 32-len(traceIDHex)) + traceIDHex
+}
@@ -0,0 +1,124 @@
+package jtrace
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"go.opentelemetry.io/otel/baggage"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/e7coding/coding-common/internal/intlog"
+)
+
+const (
+	jaegerHeader        = "uber-trace-id"
+	jaegerBaggagePrefix = "uberctx-"
+	jaegerFlagSampled   = 0x01
+	jaegerFlagDebug     = 0x02
+)
+
+// JaegerPropagator propagates the span context in the header "uber-trace-id" of Jaeger, in format
+// "{trace-id}:{span-id}:{parent-span-id}:{flags}", and the baggage in the headers "uberctx-{key}".
+//
+// Note that the baggage can be extracted only from the carriers listing their keys, like Carrier.
+type JaegerPropagator struct{}
+
+var _ propagation.TextMapPropagator = JaegerPropagator{}
+
+// Inject sets the span context and baggage of `ctx` into `carrier`.
+func (p JaegerPropagator) Inject(ctx context.Context, carrier propagation.TextMapCarrier) {
+	spanContext := trace.SpanContextFromContext(ctx)
+	if spanContext.IsValid() {
+		var flags = 0
+		if spanContext.IsSampled() {
+			flags = jaegerFlagSampled
+		}
+		carrier.Set(jaegerHeader, fmt.Sprintf(
+			`%s:%s:0:%x`, spanContext.TraceID().String(), spanContext.SpanID().String(), flags,
+		))
+	}
+	for _, member := range baggage.FromContext(ctx).Members() {
+		carrier.Set(jaegerBaggagePrefix+member.Key(), url.QueryEscape(member.Value()))
+	}
+}
+
+// Extract reads the span context and baggage from `carrier` into the returned context derived from `ctx`.
+func (p JaegerPropagator) Extract(ctx context.Context, carrier propagation.TextMapCarrier) context.Context {
+	if spanContext, ok := parseJaegerHeader(carrier.Get(jaegerHeader)); ok {
+		ctx = trace.ContextWithRemoteSpanContext(ctx, spanContext)
+	}
+	var members []baggage.Member
+	for _, key := range carrier.Keys() {
+		name, ok := strings.CutPrefix(strings.ToLower(key), jaegerBaggagePrefix)
+		if !ok {
+			continue
+		}
+		value, err := url.QueryUnescape(carrier.Get(key))
+		if err != nil {
+			value = carrier.Get(key)
+		}
+		member, err := baggage.NewMemberRaw(name, value)
+		if err != nil {
+			intlog.Errorf(`invalid jaeger baggage "%s": %+v`, key, err)
+			continue
+		}
+		members = append(members, member)
+	}
+	if len(members) == 0 {
+		return ctx
+	}
+	bag, err := baggage.New(members...)
+	if err != nil {
+		intlog.Errorf(`%+v`, err)
+		return ctx
+	}
+	return baggage.ContextWithBaggage(ctx, bag)
+}
+
+// Fields returns the header that Inject sets, except the baggage headers.
+func (p JaegerPropagator) Fields() []string {
+	return []string{jaegerHeader}
+}
+
+// parseJaegerHeader parses the header "uber-trace-id", which might be URL encoded.
+// The trace id and span id might be shorter without leading zeros.
+func parseJaegerHeader(header string) (trace.SpanContext, bool) {
+	if header == "" {
+		return trace.SpanContext{}, false
+	}
+	if unescaped, err := url.QueryUnescape(header); err == nil {
+		header = unescaped
+	}
+	parts := strings.Split(header, ":")
+	if len(parts) != 4 || len(parts[0]) == 0 || len(parts[0]) > 32 ||
+		len(parts[1]) == 0 || len(parts[1]) > 16 {
+		return trace.SpanContext{}, false
+	}
+	traceID, err := trace.TraceIDFromHex(padTraceIDHex(parts[0]))
+	if err != nil {
+		return trace.SpanContext{}, false
+	}
+	spanID, err := trace.SpanIDFromHex(strings.Repeat("0", 16-len(parts[1])) + parts[1])
+	if err != nil {
+		return trace.SpanContext{}, false
+	}
+	flags, err := strconv.ParseUint(parts[3], 16, 8)
+	if err != nil {
+		return trace.SpanContext{}, false
+	}
+	var traceFlags trace.TraceFlags
+	if flags&(jaegerFlagSampled|jaegerFlagDebug) != 0 {
+		traceFlags = trace.FlagsSampled
+	}
+	spanContext := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    traceID,
+		SpanID:     spanID,
+		TraceFlags: traceFlags,
+		Remote:     true,
+	})
+	return spanContext, spanContext.IsValid()
+}
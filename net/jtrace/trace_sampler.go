@@ -0,0 +1,209 @@
+package jtrace
+
+import (
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	sdkTrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/e7coding/coding-common/container/jatomic"
+)
+
+const (
+	defaultSamplingTailBufferSize = 1000
+	samplingRuleWildcard          = "*"
+)
+
+// SamplingOption is the option for the sampler of jtrace, which can be changed at runtime by SetSampling.
+//
+// The sampling decision of a span is made in order:
+//  1. If the span has no local parent, that is a root span or an entry span of remote parent, and
+//     its name matches any of Rules, it's sampled or dropped as the first matched rule specifies.
+//  2. If the span has a parent, it follows the sampling decision of the parent.
+//  3. The root span is sampled by Ratio, and then limited by RateLimit.
+//
+// If KeepErrors is true, the spans not sampled above are still recorded and buffered per trace,
+// and the whole trace is exported once its local root span ends if any of its spans has error status.
+type SamplingOption struct {
+	// Ratio is the ratio of the root spans to sample, which is in range (0, 1].
+	// It samples all the root spans if it's not greater than 0 or greater than 1.
+	Ratio float64
+
+	// Rules are the sampling rules by span name, which take precedence over the others.
+	Rules []SamplingRule
+
+	// RateLimit is the max count of the sampled root spans per second, that is the traces per second.
+	// It does not limit if it's not greater than 0.
+	RateLimit float64
+
+	// KeepErrors enables the tail-style sampling that keeps the traces having errors even if they
+	// are not sampled. Note that the spans of a trace ending after its local root span are dropped.
+	KeepErrors bool
+
+	// TailBufferSize is the max count of the traces buffered for KeepErrors, which is 1000 in default.
+	// The traces beyond it are not buffered and dropped if they are not sampled.
+	TailBufferSize int
+}
+
+// SamplingRule specifies the sampling decision of the spans by name.
+type SamplingRule struct {
+	// Name is the span name to match, like "/pay". It matches the names having the prefix if it ends
+	// with "*", like "/api/*", and "*" matches all names.
+	Name string
+
+	// Sample specifies whether the matched spans are always sampled, or else always dropped.
+	Sample bool
+}
+
+// samplingConfig is the compiled SamplingOption that the sampler uses.
+type samplingConfig struct {
+	option  SamplingOption
+	ratio   sdkTrace.Sampler
+	limiter *samplingLimiter
+}
+
+// samplingLimiter limits the sampled root spans per second using the generic cell rate algorithm.
+type samplingLimiter struct {
+	mu       sync.Mutex
+	interval time.Duration // Interval between the sampled root spans, which is 1/RateLimit.
+	burst    time.Duration // Tolerance of burst, which allows the ceiling of RateLimit root spans at once.
+	tat      time.Time     // Theoretical arrival time of the next sampled root span.
+}
+
+// sampler is the sampler of jtrace whose config can be changed at runtime.
+type sampler struct{}
+
+var (
+	// globalSampling holds the *samplingConfig currently in use.
+	globalSampling = jatomic.NewInterface(newSamplingConfig(SamplingOption{}))
+)
+
+// SetSampling changes the sampling option at runtime, which takes effect for the spans started after
+// it's called. It takes effect for the tracer provider created by Setup, or the tracer providers
+// using GetSampler.
+//
+// Eg:
+//
+//	jtrace.SetSampling(jtrace.SamplingOption{
+//	    Ratio: 0.1,
+//	    Rules: []jtrace.SamplingRule{
+//	        {Name: "/pay", Sample: true},
+//	        {Name: "/health", Sample: false},
+//	    },
+//	    RateLimit:  100,
+//	    KeepErrors: true,
+//	})
+func SetSampling(option SamplingOption) {
+	globalSampling.Store(newSamplingConfig(option))
+}
+
+// GetSampling returns the sampling option currently in use.
+func GetSampling() SamplingOption {
+	return getSamplingConfig().option
+}
+
+// GetSampler returns the sampler using the sampling option set by SetSampling, which can be used
+// for creating custom tracer provider. Note that KeepErrors takes effect only for the tracer
+// provider created by Setup.
+func GetSampler() sdkTrace.Sampler {
+	return sampler{}
+}
+
+// getSamplingConfig returns the sampling config currently in use.
+func getSamplingConfig() *samplingConfig {
+	return globalSampling.Load().(*samplingConfig)
+}
+
+// newSamplingConfig compiles and returns the config of `option`.
+func newSamplingConfig(option SamplingOption) *samplingConfig {
+	if option.Ratio <= 0 || option.Ratio > 1 {
+		option.Ratio = 1
+	}
+	if option.TailBufferSize <= 0 {
+		option.TailBufferSize = defaultSamplingTailBufferSize
+	}
+	option.Rules = append([]SamplingRule(nil), option.Rules...)
+	config := &samplingConfig{
+		option: option,
+		ratio:  sdkTrace.TraceIDRatioBased(option.Ratio),
+	}
+	if option.RateLimit > 0 {
+		interval := time.Duration(float64(time.Second) / option.RateLimit)
+		config.limiter = &samplingLimiter{
+			interval: interval,
+			burst:    time.Duration(math.Ceil(option.RateLimit)-1) * interval,
+		}
+	}
+	return config
+}
+
+// ShouldSample implements sdkTrace.Sampler.
+func (sampler) ShouldSample(p sdkTrace.SamplingParameters) sdkTrace.SamplingResult {
+	var (
+		config         = getSamplingConfig()
+		parent         = trace.SpanContextFromContext(p.ParentContext)
+		hasLocalParent = parent.IsValid() && !parent.IsRemote()
+		result         = sdkTrace.SamplingResult{Tracestate: parent.TraceState()}
+	)
+	if !hasLocalParent {
+		if rule := config.matchRule(p.Name); rule != nil {
+			if rule.Sample {
+				result.Decision = sdkTrace.RecordAndSample
+			}
+			return result
+		}
+	}
+	switch {
+	case parent.IsValid():
+		if parent.IsSampled() {
+			result.Decision = sdkTrace.RecordAndSample
+		}
+	case config.ratio.ShouldSample(p).Decision == sdkTrace.RecordAndSample &&
+		(config.limiter == nil || config.limiter.allow()):
+		result.Decision = sdkTrace.RecordAndSample
+	}
+	if result.Decision == sdkTrace.Drop && config.option.KeepErrors {
+		result.Decision = sdkTrace.RecordOnly
+	}
+	return result
+}
+
+// Description implements sdkTrace.Sampler.
+func (sampler) Description() string {
+	return "jtrace.Sampler"
+}
+
+// matchRule returns the first rule matching span `name`, or nil if no rule matches.
+func (c *samplingConfig) matchRule(name string) *SamplingRule {
+	for i, rule := range c.option.Rules {
+		if prefix, ok := strings.CutSuffix(rule.Name, samplingRuleWildcard); ok {
+			if strings.HasPrefix(name, prefix) {
+				return &c.option.Rules[i]
+			}
+		} else if rule.Name == name {
+			return &c.option.Rules[i]
+		}
+	}
+	return nil
+}
+
+// allow checks and returns whether another root span can be sampled in the rate limit.
+func (l *samplingLimiter) allow() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var (
+		now = time.Now()
+		tat = l.tat
+	)
+	if tat.Before(now) {
+		tat = now
+	}
+	if tat.Sub(now) > l.burst {
+		return false
+	}
+	l.tat = tat.Add(l.interval)
+	return true
+}
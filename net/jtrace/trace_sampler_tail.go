@@ -0,0 +1,133 @@
+package jtrace
+
+import (
+	"context"
+	"sync"
+
+	"go.opentelemetry.io/otel/codes"
+	sdkTrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tailSamplingProcessor is the span processor implementing SamplingOption.KeepErrors.
+// The sampled spans are passed to the next processors directly, and the recorded but not sampled
+// spans are buffered per trace until the local root span ends, then they are passed to the next
+// processors as sampled spans if any of them has error status, or else they are dropped.
+type tailSamplingProcessor struct {
+	next   []sdkTrace.SpanProcessor
+	mu     sync.Mutex
+	traces map[trace.TraceID]*tailSamplingTrace
+}
+
+// tailSamplingTrace is the buffered spans of a trace.
+type tailSamplingTrace struct {
+	spans    []sdkTrace.ReadOnlySpan
+	hasError bool
+}
+
+// tailSampledSpan is the buffered span that is kept, whose span context is marked as sampled,
+// as the next processors only process the sampled spans.
+type tailSampledSpan struct {
+	sdkTrace.ReadOnlySpan
+}
+
+// newTailSamplingProcessor creates and returns a tailSamplingProcessor passing spans to `next`.
+func newTailSamplingProcessor(next []sdkTrace.SpanProcessor) *tailSamplingProcessor {
+	return &tailSamplingProcessor{
+		next:   next,
+		traces: make(map[trace.TraceID]*tailSamplingTrace),
+	}
+}
+
+// OnStart implements sdkTrace.SpanProcessor.
+func (p *tailSamplingProcessor) OnStart(parent context.Context, s sdkTrace.ReadWriteSpan) {
+	spanContext := s.SpanContext()
+	if spanContext.IsSampled() {
+		for _, processor := range p.next {
+			processor.OnStart(parent, s)
+		}
+		return
+	}
+	if !isLocalRootSpan(s) {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.traces) < getSamplingConfig().option.TailBufferSize {
+		p.traces[spanContext.TraceID()] = &tailSamplingTrace{}
+	}
+}
+
+// OnEnd implements sdkTrace.SpanProcessor.
+func (p *tailSamplingProcessor) OnEnd(s sdkTrace.ReadOnlySpan) {
+	if s.SpanContext().IsSampled() {
+		for _, processor := range p.next {
+			processor.OnEnd(s)
+		}
+		return
+	}
+	var (
+		traceID = s.SpanContext().TraceID()
+		kept    []sdkTrace.ReadOnlySpan
+	)
+	p.mu.Lock()
+	buffered := p.traces[traceID]
+	if buffered == nil {
+		p.mu.Unlock()
+		return
+	}
+	buffered.spans = append(buffered.spans, s)
+	if s.Status().Code == codes.Error {
+		buffered.hasError = true
+	}
+	if isLocalRootSpan(s) {
+		delete(p.traces, traceID)
+		if buffered.hasError {
+			kept = buffered.spans
+		}
+	}
+	p.mu.Unlock()
+	for _, span := range kept {
+		for _, processor := range p.next {
+			processor.OnEnd(tailSampledSpan{span})
+		}
+	}
+}
+
+// Shutdown implements sdkTrace.SpanProcessor, which drops the buffered traces and shuts down
+// the next processors.
+func (p *tailSamplingProcessor) Shutdown(ctx context.Context) error {
+	p.mu.Lock()
+	p.traces = make(map[trace.TraceID]*tailSamplingTrace)
+	p.mu.Unlock()
+	var err error
+	for _, processor := range p.next {
+		if shutdownErr := processor.Shutdown(ctx); shutdownErr != nil && err == nil {
+			err = shutdownErr
+		}
+	}
+	return err
+}
+
+// ForceFlush implements sdkTrace.SpanProcessor, which flushes the next processors.
+func (p *tailSamplingProcessor) ForceFlush(ctx context.Context) error {
+	var err error
+	for _, processor := range p.next {
+		if flushErr := processor.ForceFlush(ctx); flushErr != nil && err == nil {
+			err = flushErr
+		}
+	}
+	return err
+}
+
+// SpanContext returns the span context marked as sampled.
+func (s tailSampledSpan) SpanContext() trace.SpanContext {
+	spanContext := s.ReadOnlySpan.SpanContext()
+	return spanContext.WithTraceFlags(spanContext.TraceFlags().WithSampled(true))
+}
+
+// isLocalRootSpan checks whether `s` has no local parent span.
+func isLocalRootSpan(s sdkTrace.ReadOnlySpan) bool {
+	parent := s.Parent()
+	return !parent.IsValid() || parent.IsRemote()
+}
@@ -8,6 +8,7 @@ package judp
 
 import (
 	"github.com/e7coding/coding-common/errs/jerr"
+	"github.com/e7coding/coding-common/internal/unixsock"
 	"io"
 	"time"
 )
@@ -15,27 +16,50 @@ import (
 // ClientConn holds the client side connection.
 type ClientConn struct {
 	*localConn
+	localPath string // Local socket file of unix datagram socket, which is removed if the connection is closed.
 }
 
-// NewClientConn creates UDP connection to `remoteAddress`.
+// NewClientConn creates UDP connection to `remoteAddress`, or unix datagram socket connection
+// if `remoteAddress` is like "unixgram:///var/run/app.sock".
 // The optional parameter `localAddress` specifies the local address for connection.
 func NewClientConn(remoteAddress string, localAddress ...string) (*ClientConn, error) {
-	udpConn, err := NewNetConn(remoteAddress, localAddress...)
+	var (
+		conn      PacketConn
+		localPath string
+		err       error
+	)
+	if network, _ := unixsock.Parse(remoteAddress, `udp`); network == unixsock.NetworkUnixgram {
+		conn, err = NewNetConnUnix(remoteAddress, localAddress...)
+		if len(localAddress) > 0 {
+			_, localPath = unixsock.Parse(localAddress[0], network)
+		}
+	} else {
+		conn, err = NewNetConn(remoteAddress, localAddress...)
+	}
 	if err != nil {
 		return nil, err
 	}
 	return &ClientConn{
-		localConn: &localConn{
-			UDPConn: udpConn,
-		},
+		localConn: newLocalConn(conn, newConnObserver(conn, metricConnSideClient, remoteAddress)),
+		localPath: localPath,
 	}, nil
 }
 
+// Close closes the connection, and removes the local socket file of unix datagram socket.
+func (c *ClientConn) Close() error {
+	err := c.localConn.Close()
+	if removeErr := unixsock.Remove(c.localPath); err == nil {
+		err = removeErr
+	}
+	return err
+}
+
 // Send writes data to remote address.
 func (c *ClientConn) Send(data []byte, retry ...Retry) (err error) {
 	for {
 		_, err = c.Write(data)
 		if err == nil {
+			c.observer.recordSend(len(data))
 			return nil
 		}
 		// Connection closed.
@@ -7,17 +7,45 @@
 package judp
 
 import (
+	"context"
 	"github.com/e7coding/coding-common/errs/jerr"
 	"io"
 	"net"
 	"time"
 )
 
+// PacketConn is the underlying connection of UDP or unix datagram socket,
+// which is *net.UDPConn or *net.UnixConn.
+type PacketConn interface {
+	net.Conn
+	ReadFrom(b []byte) (int, net.Addr, error)
+	WriteTo(b []byte, addr net.Addr) (int, error)
+	SetReadBuffer(bytes int) error
+	SetWriteBuffer(bytes int) error
+}
+
 // localConn provides common operations for udp connection.
+//
+// The underlying *net.UDPConn is embedded for UDP connection, whose methods like ReadFromUDP and
+// WriteMsgUDP are only available for UDP connection, as it is nil for unix datagram socket.
+// The common methods like Read, Write, ReadFrom and WriteTo work for both.
 type localConn struct {
-	*net.UDPConn           // Underlying UDP connection.
-	deadlineRecv time.Time // Timeout point for reading data.
-	deadlineSend time.Time // Timeout point for writing data.
+	*net.UDPConn               // Underlying UDP connection, which is nil for unix datagram socket.
+	conn         PacketConn    // Underlying UDP or unix datagram socket connection.
+	deadlineRecv time.Time     // Timeout point for reading data.
+	deadlineSend time.Time     // Timeout point for writing data.
+	group        *net.UDPAddr  // Multicast group of the connection created for multicast.
+	observer     *connObserver // Observer of the connection if observability is enabled.
+}
+
+// newLocalConn creates and returns a localConn of `conn`.
+func newLocalConn(conn PacketConn, observer *connObserver) *localConn {
+	udpConn, _ := conn.(*net.UDPConn)
+	return &localConn{
+		UDPConn:  udpConn,
+		conn:     conn,
+		observer: observer,
+	}
 }
 
 const (
@@ -39,12 +67,22 @@ type Retry struct {
 // There's package border in UDP protocol, we can receive a complete package if specified
 // buffer size is big enough. VERY NOTE that we should receive the complete package in once
 // or else the leftover package data would be dropped.
+//
+// The returned remote address is nil for unix datagram socket, use RecvFrom instead.
 func (c *localConn) Recv(buffer int, retry ...Retry) ([]byte, *net.UDPAddr, error) {
+	data, addr, err := c.RecvFrom(buffer, retry...)
+	remoteAddr, _ := addr.(*net.UDPAddr)
+	return data, remoteAddr, err
+}
+
+// RecvFrom receives and returns data from remote address, which is *net.UDPAddr for UDP,
+// or *net.UnixAddr for unix datagram socket. See Recv.
+func (c *localConn) RecvFrom(buffer int, retry ...Retry) ([]byte, net.Addr, error) {
 	var (
-		err        error        // Reading error
-		size       int          // Reading size
-		data       []byte       // Buffer object
-		remoteAddr *net.UDPAddr // Current remote address for reading
+		err        error    // Reading error
+		size       int      // Reading size
+		data       []byte   // Buffer object
+		remoteAddr net.Addr // Current remote address for reading
 	)
 	if buffer > 0 {
 		data = make([]byte, buffer)
@@ -52,7 +90,7 @@ func (c *localConn) Recv(buffer int, retry ...Retry) ([]byte, *net.UDPAddr, erro
 		data = make([]byte, defaultReadBufferSize)
 	}
 	for {
-		size, remoteAddr, err = c.ReadFromUDP(data)
+		size, remoteAddr, err = c.ReadFrom(data)
 		if err != nil {
 			// Connection closed.
 			if err == io.EOF {
@@ -70,17 +108,31 @@ func (c *localConn) Recv(buffer int, retry ...Retry) ([]byte, *net.UDPAddr, erro
 				time.Sleep(retry[0].Interval)
 				continue
 			}
-			err = jerr.WithMsgErr(err, `ReadFromUDP failed`)
+			err = jerr.WithMsgErr(err, `ReadFrom failed`)
 			break
 		}
 		break
 	}
+	c.observer.recordReceive(size)
 	return data[:size], remoteAddr, err
 }
 
+// Context returns the context of the connection.
+// If observability is enabled, the context carries the span of the connection.
+func (c *localConn) Context() context.Context {
+	return c.observer.context()
+}
+
+// Close closes the connection.
+func (c *localConn) Close() error {
+	err := c.conn.Close()
+	c.observer.end()
+	return err
+}
+
 // SetDeadline sets the read and write deadlines associated with the connection.
 func (c *localConn) SetDeadline(t time.Time) (err error) {
-	if err = c.UDPConn.SetDeadline(t); err == nil {
+	if err = c.conn.SetDeadline(t); err == nil {
 		c.deadlineRecv = t
 		c.deadlineSend = t
 	} else {
@@ -108,3 +160,53 @@ func (c *localConn) SetDeadlineSend(t time.Time) (err error) {
 	}
 	return err
 }
+
+// Read reads data from the connection.
+func (c *localConn) Read(b []byte) (int, error) {
+	return c.conn.Read(b)
+}
+
+// Write writes data to the connection.
+func (c *localConn) Write(b []byte) (int, error) {
+	return c.conn.Write(b)
+}
+
+// ReadFrom reads a packet from the connection, and returns the remote address of the packet.
+func (c *localConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	return c.conn.ReadFrom(b)
+}
+
+// WriteTo writes a packet to `addr`.
+func (c *localConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	return c.conn.WriteTo(b, addr)
+}
+
+// LocalAddr returns the local network address.
+func (c *localConn) LocalAddr() net.Addr {
+	return c.conn.LocalAddr()
+}
+
+// RemoteAddr returns the remote network address, which is nil for the listened connection.
+func (c *localConn) RemoteAddr() net.Addr {
+	return c.conn.RemoteAddr()
+}
+
+// SetReadDeadline sets the deadline of the underlying connection for future reading.
+func (c *localConn) SetReadDeadline(t time.Time) error {
+	return c.conn.SetReadDeadline(t)
+}
+
+// SetWriteDeadline sets the deadline of the underlying connection for future writing.
+func (c *localConn) SetWriteDeadline(t time.Time) error {
+	return c.conn.SetWriteDeadline(t)
+}
+
+// SetReadBuffer sets the size of the operating system's receive buffer of the connection.
+func (c *localConn) SetReadBuffer(bytes int) error {
+	return c.conn.SetReadBuffer(bytes)
+}
+
+// SetWriteBuffer sets the size of the operating system's transmit buffer of the connection.
+func (c *localConn) SetWriteBuffer(bytes int) error {
+	return c.conn.SetWriteBuffer(bytes)
+}
@@ -8,6 +8,7 @@ package judp
 
 import (
 	"github.com/e7coding/coding-common/errs/jerr"
+	"github.com/e7coding/coding-common/internal/unixsock"
 	"net"
 )
 
@@ -48,6 +49,33 @@ func NewNetConn(remoteAddress string, localAddress ...string) (*net.UDPConn, err
 	return conn, nil
 }
 
+// NewNetConnUnix creates and returns a *net.UnixConn of unix datagram socket with given addresses
+// like "unixgram:///var/run/app.sock". The optional parameter `localAddress` specifies the local
+// socket file for receiving responses, whose stale file is removed before binding.
+func NewNetConnUnix(remoteAddress string, localAddress ...string) (*net.UnixConn, error) {
+	var (
+		network, remotePath = unixsock.Parse(remoteAddress, unixsock.NetworkUnixgram)
+		remoteAddr          = &net.UnixAddr{Name: remotePath, Net: network}
+		localAddr           *net.UnixAddr
+	)
+	if len(localAddress) > 0 {
+		_, localPath := unixsock.Parse(localAddress[0], unixsock.NetworkUnixgram)
+		if err := unixsock.Prepare(network, localPath); err != nil {
+			return nil, err
+		}
+		localAddr = &net.UnixAddr{Name: localPath, Net: network}
+	}
+	conn, err := net.DialUnix(network, localAddr, remoteAddr)
+	if err != nil {
+		return nil, jerr.WithMsgErrF(
+			err,
+			`net.DialUnix failed for network "%s", local "%s", remote "%s"`,
+			network, localAddr, remoteAddr,
+		)
+	}
+	return conn, nil
+}
+
 // Send writes data to `address` using UDP connection and then closes the connection.
 // Note that it is used for short connection usage.
 func Send(address string, data []byte, retry ...Retry) error {
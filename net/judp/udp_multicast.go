@@ -0,0 +1,296 @@
+package judp
+
+import (
+	"net"
+
+	"github.com/e7coding/coding-common/errs/jerr"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+const (
+	defaultMulticastTTL = 1                 // Default TTL of multicast datagrams, which does not leave the local network.
+	broadcastAddress    = "255.255.255.255" // Limited broadcast address.
+)
+
+// MulticastOption is the option for NewMulticastConn.
+type MulticastOption struct {
+	// Interface is the name of network interface for sending multicast datagrams, eg: "eth0".
+	// It uses the interface chosen by the system in default.
+	Interface string
+
+	// TTL is the time-to-live (hop limit for IPv6) of multicast datagrams, which is 1 in default.
+	TTL int
+
+	// Loopback specifies whether multicast datagrams are delivered to the local host.
+	Loopback bool
+}
+
+// NewMulticastServer creates and returns an udp server that joins multicast `group` like
+// "239.0.0.1:9999" on network interface `iface` like "eth0", and receives the datagrams sent to
+// the group. The parameter `iface` can be empty, which uses the interface chosen by the system.
+// More groups can be joined using ServerConn.JoinGroup in the handler.
+//
+// Eg:
+//
+//	s := judp.NewMulticastServer("239.0.0.1:9999", "eth0", func(conn *judp.ServerConn) {
+//	    for {
+//	        data, remoteAddr, err := conn.Recv(-1)
+//	        ...
+//	    }
+//	})
+//	s.Run()
+func NewMulticastServer(group, iface string, handler ServerHandler, name ...string) *Server {
+	s := NewServer(group, handler, name...)
+	s.multicast, s.multicastIface = true, iface
+	return s
+}
+
+// NewMulticastConn creates and returns a connection for sending datagrams to multicast `group`
+// like "239.0.0.1:9999" using ServerConn.SendMulticast, which also receives the unicast replies
+// using ServerConn.Recv. It's usually used for service discovery in local network.
+func NewMulticastConn(group string, option ...MulticastOption) (*ServerConn, error) {
+	var opt MulticastOption
+	if len(option) > 0 {
+		opt = option[0]
+	}
+	if opt.TTL == 0 {
+		opt.TTL = defaultMulticastTTL
+	}
+	groupAddr, err := resolveMulticastAddr(group)
+	if err != nil {
+		return nil, err
+	}
+	network := multicastNetwork(groupAddr.IP)
+	udpConn, err := net.ListenUDP(network, nil)
+	if err != nil {
+		return nil, jerr.WithMsgErrF(err, `net.ListenUDP failed for network "%s"`, network)
+	}
+	conn := NewServerConn(udpConn)
+	conn.group = groupAddr
+	if err = conn.SetMulticastTTL(opt.TTL); err == nil {
+		if err = conn.SetMulticastLoopback(opt.Loopback); err == nil && opt.Interface != "" {
+			err = conn.SetMulticastInterface(opt.Interface)
+		}
+	}
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// newMulticastConn creates the listened connection that joins the multicast group of the server.
+func (s *Server) newMulticastConn() (PacketConn, error) {
+	groupAddr, err := resolveMulticastAddr(s.address)
+	if err != nil {
+		return nil, err
+	}
+	var netIface *net.Interface
+	if s.multicastIface != "" {
+		if netIface, err = net.InterfaceByName(s.multicastIface); err != nil {
+			return nil, jerr.WithMsgErrF(err, `net.InterfaceByName failed for interface "%s"`, s.multicastIface)
+		}
+	}
+	conn, err := net.ListenMulticastUDP(multicastNetwork(groupAddr.IP), netIface, groupAddr)
+	if err != nil {
+		return nil, jerr.WithMsgErrF(
+			err, `net.ListenMulticastUDP failed for group "%s", interface "%s"`, s.address, s.multicastIface,
+		)
+	}
+	return conn, nil
+}
+
+// SendMulticast writes data to the multicast group of the connection created by NewMulticastConn
+// or NewMulticastServer.
+func (c *ServerConn) SendMulticast(data []byte, retry ...Retry) error {
+	if c.group == nil {
+		return jerr.WithMsg(`multicast group not specified for connection`)
+	}
+	return c.Send(data, c.group, retry...)
+}
+
+// SendBroadcast writes data to port `port` of the broadcast address, which is the directed
+// broadcast address of network interface `iface` like "eth0" if it's given, or else the limited
+// broadcast address 255.255.255.255.
+func SendBroadcast(port int, data []byte, iface ...string) error {
+	ip := net.ParseIP(broadcastAddress)
+	if len(iface) > 0 && iface[0] != "" {
+		var err error
+		if ip, err = BroadcastAddr(iface[0]); err != nil {
+			return err
+		}
+	}
+	udpConn, err := net.ListenUDP("udp4", nil)
+	if err != nil {
+		return jerr.WithMsgErr(err, `net.ListenUDP failed for network "udp4"`)
+	}
+	conn := NewServerConn(udpConn)
+	defer conn.Close()
+	return conn.Send(data, &net.UDPAddr{IP: ip, Port: port})
+}
+
+// BroadcastAddr returns the directed broadcast address of the first IPv4 network of interface
+// `iface` like "eth0", eg: 192.168.1.255 for network 192.168.1.0/24.
+func BroadcastAddr(iface string) (net.IP, error) {
+	netIface, err := net.InterfaceByName(iface)
+	if err != nil {
+		return nil, jerr.WithMsgErrF(err, `net.InterfaceByName failed for interface "%s"`, iface)
+	}
+	addrs, err := netIface.Addrs()
+	if err != nil {
+		return nil, jerr.WithMsgErrF(err, `get addresses failed for interface "%s"`, iface)
+	}
+	for _, addr := range addrs {
+		ipNet, ok := addr.(*net.IPNet)
+		if !ok || ipNet.IP.To4() == nil {
+			continue
+		}
+		var (
+			ip   = ipNet.IP.To4()
+			mask = net.IP(ipNet.Mask).To4()
+			bc   = make(net.IP, net.IPv4len)
+		)
+		if mask == nil {
+			continue
+		}
+		for i := range ip {
+			bc[i] = ip[i] | ^mask[i]
+		}
+		return bc, nil
+	}
+	return nil, jerr.WithMsgF(`no IPv4 address found for interface "%s"`, iface)
+}
+
+// JoinGroup joins multicast `group` like "239.0.0.1" or "239.0.0.1:9999" on network interface
+// `iface` like "eth0", or the interface chosen by the system if `iface` is not given.
+func (c *localConn) JoinGroup(group string, iface ...string) error {
+	groupAddr, netIface, err := c.resolveGroup(group, iface...)
+	if err != nil {
+		return err
+	}
+	if groupAddr.IP.To4() != nil {
+		err = ipv4.NewPacketConn(c.conn).JoinGroup(netIface, groupAddr)
+	} else {
+		err = ipv6.NewPacketConn(c.conn).JoinGroup(netIface, groupAddr)
+	}
+	if err != nil {
+		return jerr.WithMsgErrF(err, `join multicast group "%s" failed`, group)
+	}
+	return nil
+}
+
+// LeaveGroup leaves multicast `group` joined by JoinGroup on network interface `iface`.
+func (c *localConn) LeaveGroup(group string, iface ...string) error {
+	groupAddr, netIface, err := c.resolveGroup(group, iface...)
+	if err != nil {
+		return err
+	}
+	if groupAddr.IP.To4() != nil {
+		err = ipv4.NewPacketConn(c.conn).LeaveGroup(netIface, groupAddr)
+	} else {
+		err = ipv6.NewPacketConn(c.conn).LeaveGroup(netIface, groupAddr)
+	}
+	if err != nil {
+		return jerr.WithMsgErrF(err, `leave multicast group "%s" failed`, group)
+	}
+	return nil
+}
+
+// SetMulticastTTL sets the time-to-live (hop limit for IPv6) of multicast datagrams sent
+// by the connection.
+func (c *localConn) SetMulticastTTL(ttl int) (err error) {
+	if c.isIPv4() {
+		err = ipv4.NewPacketConn(c.conn).SetMulticastTTL(ttl)
+	} else {
+		err = ipv6.NewPacketConn(c.conn).SetMulticastHopLimit(ttl)
+	}
+	if err != nil {
+		return jerr.WithMsgErrF(err, `set multicast TTL %d failed`, ttl)
+	}
+	return nil
+}
+
+// SetMulticastLoopback sets whether multicast datagrams sent by the connection are delivered
+// to the local host.
+func (c *localConn) SetMulticastLoopback(on bool) (err error) {
+	if c.isIPv4() {
+		err = ipv4.NewPacketConn(c.conn).SetMulticastLoopback(on)
+	} else {
+		err = ipv6.NewPacketConn(c.conn).SetMulticastLoopback(on)
+	}
+	if err != nil {
+		return jerr.WithMsgErrF(err, `set multicast loopback %t failed`, on)
+	}
+	return nil
+}
+
+// SetMulticastInterface sets network interface `iface` like "eth0" for sending multicast datagrams.
+func (c *localConn) SetMulticastInterface(iface string) error {
+	netIface, err := net.InterfaceByName(iface)
+	if err != nil {
+		return jerr.WithMsgErrF(err, `net.InterfaceByName failed for interface "%s"`, iface)
+	}
+	if c.isIPv4() {
+		err = ipv4.NewPacketConn(c.conn).SetMulticastInterface(netIface)
+	} else {
+		err = ipv6.NewPacketConn(c.conn).SetMulticastInterface(netIface)
+	}
+	if err != nil {
+		return jerr.WithMsgErrF(err, `set multicast interface "%s" failed`, iface)
+	}
+	return nil
+}
+
+// resolveGroup resolves the multicast group address and the network interface.
+func (c *localConn) resolveGroup(group string, iface ...string) (*net.UDPAddr, *net.Interface, error) {
+	ip := net.ParseIP(group)
+	if ip == nil {
+		groupAddr, err := resolveMulticastAddr(group)
+		if err != nil {
+			return nil, nil, err
+		}
+		ip = groupAddr.IP
+	} else if !ip.IsMulticast() {
+		return nil, nil, jerr.WithMsgF(`invalid multicast group address "%s"`, group)
+	}
+	var netIface *net.Interface
+	if len(iface) > 0 && iface[0] != "" {
+		var err error
+		if netIface, err = net.InterfaceByName(iface[0]); err != nil {
+			return nil, nil, jerr.WithMsgErrF(err, `net.InterfaceByName failed for interface "%s"`, iface[0])
+		}
+	}
+	return &net.UDPAddr{IP: ip}, netIface, nil
+}
+
+// isIPv4 checks whether the connection is IPv4, using its multicast group or local address.
+func (c *localConn) isIPv4() bool {
+	if c.group != nil {
+		return c.group.IP.To4() != nil
+	}
+	if addr, ok := c.LocalAddr().(*net.UDPAddr); ok {
+		return addr.IP.To4() != nil || addr.IP.IsUnspecified()
+	}
+	return true
+}
+
+// resolveMulticastAddr resolves and validates multicast group address like "239.0.0.1:9999".
+func resolveMulticastAddr(group string) (*net.UDPAddr, error) {
+	addr, err := net.ResolveUDPAddr("udp", group)
+	if err != nil {
+		return nil, jerr.WithMsgErrF(err, `net.ResolveUDPAddr failed for address "%s"`, group)
+	}
+	if !addr.IP.IsMulticast() {
+		return nil, jerr.WithMsgF(`invalid multicast group address "%s"`, group)
+	}
+	return addr, nil
+}
+
+// multicastNetwork returns the network of multicast group `ip`.
+func multicastNetwork(ip net.IP) string {
+	if ip.To4() != nil {
+		return "udp4"
+	}
+	return "udp6"
+}
@@ -0,0 +1,236 @@
+package judp
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/e7coding/coding-common"
+	"github.com/e7coding/coding-common/container/jatomic"
+	"github.com/e7coding/coding-common/internal/intlog"
+	"github.com/e7coding/coding-common/net/jtrace"
+)
+
+const (
+	instrumentName              = "github.com/e7coding/coding-common/net/judp"
+	tracingSpanServerConn       = "judp.ServerConn"
+	tracingSpanClientConn       = "judp.ClientConn"
+	tracingAttrNetAddressRemote = "net.address.remote"
+	tracingAttrNetAddressLocal  = "net.address.local"
+	tracingAttrBytesReceived    = "net.bytes.received"
+	tracingAttrBytesSent        = "net.bytes.sent"
+	tracingEventHandlerPanic    = "judp.handler.panic"
+	metricAttrConnSide          = "connection.side"
+	metricAttrServerAddress     = "server.address"
+	metricAttrIODirection       = "network.io.direction"
+	metricConnSideServer        = "server"
+	metricConnSideClient        = "client"
+	metricIODirectionReceive    = "receive"
+	metricIODirectionTransmit   = "transmit"
+	metricUnitBytes             = "By"
+)
+
+var (
+	// observabilityEnabled specifies whether the observability feature is enabled.
+	observabilityEnabled = jatomic.NewBool()
+
+	// globalMetrics is lazily initialized as the meter provider
+	// might be configured after package initialization.
+	globalMetrics     *udpMetrics
+	globalMetricsOnce sync.Once
+)
+
+// udpMetrics holds all the instruments that the package records metrics with.
+type udpMetrics struct {
+	connActive    metric.Int64UpDownCounter // Count of the open connections.
+	ioBytes       metric.Int64Counter       // Bytes received and sent by the connections.
+	handlerPanics metric.Int64Counter       // Count of the panics of server handlers.
+}
+
+// connObserver records the spans and metrics of a connection.
+// All its methods can be called on nil observer, which do nothing.
+type connObserver struct {
+	ctx      context.Context      // Context of the connection span.
+	span     trace.Span           // Span of the connection lifetime.
+	attrs    []attribute.KeyValue // Common metric attributes of the connection.
+	metrics  *udpMetrics          // Instruments of the package.
+	received *jatomic.Int64       // Total bytes received.
+	sent     *jatomic.Int64       // Total bytes sent.
+	once     sync.Once            // Ensures the span ends once.
+	ioAttrs  [2]metric.AddOption  // Metric options of receive and transmit directions.
+}
+
+// SetObservability enables or disables the OpenTelemetry instrumentation of the package, which is
+// disabled in default. It takes effect for the servers and connections created after it's called.
+//
+// If it's enabled:
+//  1. Each ServerConn and ClientConn records a span for its lifetime, which is in the context of
+//     its Context, so that the handler spans are its children.
+//  2. The metrics of bytes in/out, active connections and handler panics are recorded.
+//  3. The handler panic of Server is recorded, and the span is ended before it's panicked again.
+//
+// The spans and metrics are exported by the providers set by otel.SetTracerProvider and
+// otel.SetMeterProvider.
+func SetObservability(enabled bool) {
+	observabilityEnabled.Set(enabled)
+}
+
+// IsObservabilityEnabled checks and returns whether the observability feature is enabled.
+func IsObservabilityEnabled() bool {
+	return observabilityEnabled.Val()
+}
+
+// getMetrics creates if necessary and returns the instruments of the package.
+func getMetrics() *udpMetrics {
+	globalMetricsOnce.Do(func() {
+		globalMetrics = newUdpMetrics(otel.GetMeterProvider().Meter(
+			instrumentName,
+			metric.WithInstrumentationVersion(gf.VERSION),
+		))
+	})
+	return globalMetrics
+}
+
+// newUdpMetrics creates and returns the instruments using given meter.
+// Any failed instrument creation is logged internally and the instrument is skipped in recording.
+func newUdpMetrics(meter metric.Meter) *udpMetrics {
+	var (
+		err error
+		m   = &udpMetrics{}
+	)
+	if m.connActive, err = meter.Int64UpDownCounter(
+		"udp.connection.active",
+		metric.WithDescription("Count of the open UDP connections."),
+	); err != nil {
+		intlog.Errorf(`%+v`, err)
+	}
+	if m.ioBytes, err = meter.Int64Counter(
+		"udp.io",
+		metric.WithUnit(metricUnitBytes),
+		metric.WithDescription("Bytes received and sent by the UDP connections."),
+	); err != nil {
+		intlog.Errorf(`%+v`, err)
+	}
+	if m.handlerPanics, err = meter.Int64Counter(
+		"udp.server.handler.panics",
+		metric.WithDescription("Count of the panics of UDP server handlers."),
+	); err != nil {
+		intlog.Errorf(`%+v`, err)
+	}
+	return m
+}
+
+// newConnObserver creates and returns a connObserver if observability is enabled, or else nil.
+// It starts the span of connection `conn`. The parameter `side` is metricConnSideServer or
+// metricConnSideClient, and `address` is the server address.
+func newConnObserver(conn PacketConn, side, address string) *connObserver {
+	if !IsObservabilityEnabled() {
+		return nil
+	}
+	var (
+		spanName = tracingSpanClientConn
+		spanKind = trace.SpanKindClient
+		remote   string
+	)
+	if side == metricConnSideServer {
+		spanName, spanKind = tracingSpanServerConn, trace.SpanKindServer
+	}
+	if addr := conn.RemoteAddr(); addr != nil {
+		remote = addr.String()
+	}
+	ctx, span := otel.GetTracerProvider().Tracer(
+		instrumentName,
+		trace.WithInstrumentationVersion(gf.VERSION),
+	).Start(context.Background(), spanName, trace.WithSpanKind(spanKind))
+	span.SetAttributes(jtrace.CommonLabels()...)
+	span.SetAttributes(
+		attribute.String(tracingAttrNetAddressRemote, remote),
+		attribute.String(tracingAttrNetAddressLocal, conn.LocalAddr().String()),
+	)
+	o := &connObserver{
+		ctx:      ctx,
+		span:     span,
+		metrics:  getMetrics(),
+		received: jatomic.NewInt64(),
+		sent:     jatomic.NewInt64(),
+		attrs: []attribute.KeyValue{
+			attribute.String(metricAttrConnSide, side),
+			attribute.String(metricAttrServerAddress, address),
+		},
+	}
+	o.ioAttrs[0] = metric.WithAttributes(append(
+		o.attrs, attribute.String(metricAttrIODirection, metricIODirectionReceive),
+	)...)
+	o.ioAttrs[1] = metric.WithAttributes(append(
+		o.attrs, attribute.String(metricAttrIODirection, metricIODirectionTransmit),
+	)...)
+	if o.metrics.connActive != nil {
+		o.metrics.connActive.Add(ctx, 1, metric.WithAttributes(o.attrs...))
+	}
+	return o
+}
+
+// context returns the context of the connection span.
+func (o *connObserver) context() context.Context {
+	if o == nil {
+		return context.Background()
+	}
+	return o.ctx
+}
+
+// recordReceive records `n` bytes received.
+func (o *connObserver) recordReceive(n int) {
+	if o == nil || n <= 0 {
+		return
+	}
+	o.received.Add(int64(n))
+	if o.metrics.ioBytes != nil {
+		o.metrics.ioBytes.Add(o.ctx, int64(n), o.ioAttrs[0])
+	}
+}
+
+// recordSend records `n` bytes sent.
+func (o *connObserver) recordSend(n int) {
+	if o == nil || n <= 0 {
+		return
+	}
+	o.sent.Add(int64(n))
+	if o.metrics.ioBytes != nil {
+		o.metrics.ioBytes.Add(o.ctx, int64(n), o.ioAttrs[1])
+	}
+}
+
+// recordPanic records the panic of the server handler.
+func (o *connObserver) recordPanic(exception interface{}) {
+	if o == nil {
+		return
+	}
+	if o.metrics.handlerPanics != nil {
+		o.metrics.handlerPanics.Add(o.ctx, 1, metric.WithAttributes(o.attrs...))
+	}
+	o.span.AddEvent(tracingEventHandlerPanic)
+	o.span.SetStatus(codes.Error, fmt.Sprintf(`%+v`, exception))
+}
+
+// end ends the span of the connection if the connection is closed.
+func (o *connObserver) end() {
+	if o == nil {
+		return
+	}
+	o.once.Do(func() {
+		if o.metrics.connActive != nil {
+			o.metrics.connActive.Add(o.ctx, -1, metric.WithAttributes(o.attrs...))
+		}
+		o.span.SetAttributes(
+			attribute.Int64(tracingAttrBytesReceived, o.received.Load()),
+			attribute.Int64(tracingAttrBytesSent, o.sent.Load()),
+		)
+		o.span.End()
+	})
+}
@@ -0,0 +1,57 @@
+package judp
+
+import (
+	"net"
+
+	"github.com/e7coding/coding-common/net/jproxyproto"
+)
+
+// SetProxyProtocol enables or disables the PROXY protocol v2 for the datagrams received by server,
+// which is used if the server is behind a load balancer like NLB. If it's enabled, each datagram
+// must start with a PROXY protocol v2 header, which is stripped by ServerConn.Recv.
+// Use ServerConn.RecvProxy to retrieve the header. It should be called before Run.
+func (s *Server) SetProxyProtocol(enabled bool) {
+	s.proxyProtocol = enabled
+}
+
+// Recv receives and returns data from remote address, see localConn.Recv.
+// If the PROXY protocol is enabled, the header of the datagram is stripped, and the returned
+// address is still the address of the proxy, to which the responses should be sent.
+func (c *ServerConn) Recv(buffer int, retry ...Retry) ([]byte, *net.UDPAddr, error) {
+	data, remoteAddr, _, err := c.RecvProxy(buffer, retry...)
+	return data, remoteAddr, err
+}
+
+// RecvProxy receives and returns data from remote address along with its PROXY protocol header,
+// whose SourceAddr is the address of the original client.
+// The returned header is nil if the PROXY protocol is not enabled.
+func (c *ServerConn) RecvProxy(buffer int, retry ...Retry) ([]byte, *net.UDPAddr, *jproxyproto.Header, error) {
+	data, remoteAddr, err := c.localConn.Recv(buffer, retry...)
+	if err != nil || !c.proxyProtocol {
+		return data, remoteAddr, nil, err
+	}
+	header, payload, err := jproxyproto.Parse(data)
+	if err != nil {
+		return nil, remoteAddr, nil, err
+	}
+	return payload, remoteAddr, header, nil
+}
+
+// SendProxy writes data along with the PROXY protocol `header` to remote address, in which the
+// header is always encoded as version 2.
+func (c *ClientConn) SendProxy(header *jproxyproto.Header, data []byte, retry ...Retry) error {
+	if header.Version != 2 {
+		header = &jproxyproto.Header{
+			Version:    2,
+			Command:    header.Command,
+			SourceAddr: header.SourceAddr,
+			DestAddr:   header.DestAddr,
+			TLVs:       header.TLVs,
+		}
+	}
+	headerData, err := header.Bytes()
+	if err != nil {
+		return err
+	}
+	return c.Send(append(headerData, data...), retry...)
+}
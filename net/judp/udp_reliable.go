@@ -0,0 +1,232 @@
+package judp
+
+import (
+	"encoding/binary"
+	"sort"
+	"time"
+
+	"github.com/e7coding/coding-common/errs/jerr"
+)
+
+// Packet types of the reliable layer.
+const (
+	reliablePacketData = 1 // Data fragment, which is acknowledged and retransmitted.
+	reliablePacketAck  = 2 // Cumulative and selective acknowledgement.
+	reliablePacketFin  = 3 // End of stream, which is sequenced as data fragment.
+)
+
+const (
+	// reliableHeaderSize is the header size of data and fin packet:
+	// type(1) + conn id(4) + seq(4) + fragment index(2) + fragment count(2).
+	reliableHeaderSize = 13
+	// reliableAckHeaderSize is the header size of ack packet:
+	// type(1) + conn id(4) + cumulative ack(4) + sack block count(1).
+	reliableAckHeaderSize   = 10
+	reliableSackBlockSize   = 8  // Size of each sack block: start(4) + end(4).
+	reliableMaxSackBlocks   = 32 // Max sack blocks in each ack packet.
+	reliableMaxFragments    = 0xFFFF
+	reliableTickInterval    = 10 * time.Millisecond // Interval of checking retransmission.
+	reliableClockGranular   = 10 * time.Millisecond // Clock granularity for RTO calculation.
+	reliableFastResendSkips = 3                     // Acks skipping a fragment that trigger its fast retransmission.
+)
+
+const (
+	defaultReliableMTU            = 1400
+	defaultReliableWindowSize     = 256
+	defaultReliableMinRTO         = 200 * time.Millisecond
+	defaultReliableMaxRTO         = 10 * time.Second
+	defaultReliableInitialRTO     = time.Second
+	defaultReliableMaxRetransmits = 10
+	defaultReliableMaxMessageSize = 1 << 20
+	defaultReliableCloseTimeout   = 5 * time.Second
+	defaultReliableIdleTimeout    = time.Minute
+	defaultReliableAcceptBacklog  = 128
+)
+
+// ReliableOption is the option for the reliable layer over UDP.
+// Both sides should use the same MTU and WindowSize.
+type ReliableOption struct {
+	// MTU is the max size of each datagram including the header, which is 1400 in default.
+	// The messages larger than it are split into fragments and reassembled by the receiver.
+	MTU int
+
+	// WindowSize is the max count of fragments in flight without acknowledgement,
+	// and the max count of out-of-order fragments buffered by the receiver. It's 256 in default.
+	WindowSize int
+
+	// MinRTO is the min retransmission timeout, which is 200ms in default.
+	MinRTO time.Duration
+
+	// MaxRTO is the max retransmission timeout, which is 10s in default.
+	MaxRTO time.Duration
+
+	// InitialRTO is the retransmission timeout before any RTT is measured, which is 1s in default.
+	InitialRTO time.Duration
+
+	// MaxRetransmits is the max retransmissions of each fragment, the connection fails if it's exceeded.
+	// It's 10 in default.
+	MaxRetransmits int
+
+	// MaxMessageSize is the max size of each message, which is 1MB in default.
+	MaxMessageSize int
+
+	// CloseTimeout is the max duration of Close waiting for the sent messages to be acknowledged,
+	// which is 5s in default.
+	CloseTimeout time.Duration
+
+	// IdleTimeout is the max duration without receiving any packet from the remote side, after
+	// which the connection fails, which is 1 minute in default. The connection without sending
+	// for a third of it sends keepalive, so that the idle connection of alive remote side is kept.
+	// It removes the connections of the vanished remote sides, eg: the crashed process.
+	IdleTimeout time.Duration
+}
+
+// reliablePacket is the decoded packet of the reliable layer.
+type reliablePacket struct {
+	packetType int
+	connId     uint32
+	seq        uint32             // Sequence number of data or fin, or the cumulative ack.
+	fragIndex  int                // Fragment index of data.
+	fragCount  int                // Fragment count of the message.
+	payload    []byte             // Payload of data.
+	sacks      []reliableSeqRange // Selective ack blocks.
+}
+
+// reliableSeqRange is the sequence range [start, end).
+type reliableSeqRange struct {
+	start uint32
+	end   uint32
+}
+
+// getReliableOption returns the reliable option with default values.
+func getReliableOption(option ...ReliableOption) (ReliableOption, error) {
+	var opt ReliableOption
+	if len(option) > 0 {
+		opt = option[0]
+	}
+	if opt.MTU == 0 {
+		opt.MTU = defaultReliableMTU
+	}
+	if opt.MTU <= reliableHeaderSize || opt.MTU < reliableAckHeaderSize+reliableSackBlockSize {
+		return opt, jerr.WithMsgF(`invalid reliable MTU %d`, opt.MTU)
+	}
+	if opt.WindowSize <= 0 {
+		opt.WindowSize = defaultReliableWindowSize
+	}
+	if opt.MinRTO <= 0 {
+		opt.MinRTO = defaultReliableMinRTO
+	}
+	if opt.MaxRTO <= 0 {
+		opt.MaxRTO = defaultReliableMaxRTO
+	}
+	if opt.InitialRTO <= 0 {
+		opt.InitialRTO = defaultReliableInitialRTO
+	}
+	if opt.MaxRetransmits <= 0 {
+		opt.MaxRetransmits = defaultReliableMaxRetransmits
+	}
+	if opt.MaxMessageSize <= 0 {
+		opt.MaxMessageSize = defaultReliableMaxMessageSize
+	}
+	if opt.CloseTimeout <= 0 {
+		opt.CloseTimeout = defaultReliableCloseTimeout
+	}
+	if opt.IdleTimeout <= 0 {
+		opt.IdleTimeout = defaultReliableIdleTimeout
+	}
+	if maxSize := (opt.MTU - reliableHeaderSize) * reliableMaxFragments; opt.MaxMessageSize > maxSize {
+		return opt, jerr.WithMsgF(
+			`reliable max message size %d exceeds allowed size %d for MTU %d`,
+			opt.MaxMessageSize, maxSize, opt.MTU,
+		)
+	}
+	return opt, nil
+}
+
+// marshal encodes the packet.
+func (p *reliablePacket) marshal() []byte {
+	if p.packetType == reliablePacketAck {
+		data := make([]byte, reliableAckHeaderSize, reliableAckHeaderSize+len(p.sacks)*reliableSackBlockSize)
+		data[0] = byte(p.packetType)
+		binary.BigEndian.PutUint32(data[1:], p.connId)
+		binary.BigEndian.PutUint32(data[5:], p.seq)
+		data[9] = byte(len(p.sacks))
+		for _, sack := range p.sacks {
+			data = binary.BigEndian.AppendUint32(data, sack.start)
+			data = binary.BigEndian.AppendUint32(data, sack.end)
+		}
+		return data
+	}
+	data := make([]byte, reliableHeaderSize, reliableHeaderSize+len(p.payload))
+	data[0] = byte(p.packetType)
+	binary.BigEndian.PutUint32(data[1:], p.connId)
+	binary.BigEndian.PutUint32(data[5:], p.seq)
+	binary.BigEndian.PutUint16(data[9:], uint16(p.fragIndex))
+	binary.BigEndian.PutUint16(data[11:], uint16(p.fragCount))
+	return append(data, p.payload...)
+}
+
+// unmarshalReliablePacket decodes the packet.
+func unmarshalReliablePacket(data []byte) (*reliablePacket, error) {
+	if len(data) < reliableAckHeaderSize {
+		return nil, jerr.WithMsgF(`invalid reliable packet size %d`, len(data))
+	}
+	p := &reliablePacket{
+		packetType: int(data[0]),
+		connId:     binary.BigEndian.Uint32(data[1:]),
+		seq:        binary.BigEndian.Uint32(data[5:]),
+	}
+	switch p.packetType {
+	case reliablePacketAck:
+		count := int(data[9])
+		if len(data) != reliableAckHeaderSize+count*reliableSackBlockSize {
+			return nil, jerr.WithMsgF(`invalid reliable ack packet size %d`, len(data))
+		}
+		for i := 0; i < count; i++ {
+			offset := reliableAckHeaderSize + i*reliableSackBlockSize
+			p.sacks = append(p.sacks, reliableSeqRange{
+				start: binary.BigEndian.Uint32(data[offset:]),
+				end:   binary.BigEndian.Uint32(data[offset+4:]),
+			})
+		}
+
+	case reliablePacketData, reliablePacketFin:
+		if len(data) < reliableHeaderSize {
+			return nil, jerr.WithMsgF(`invalid reliable data packet size %d`, len(data))
+		}
+		p.fragIndex = int(binary.BigEndian.Uint16(data[9:]))
+		p.fragCount = int(binary.BigEndian.Uint16(data[11:]))
+		p.payload = data[reliableHeaderSize:]
+		if p.packetType == reliablePacketData && p.fragIndex >= p.fragCount {
+			return nil, jerr.WithMsgF(`invalid reliable fragment %d of %d`, p.fragIndex, p.fragCount)
+		}
+
+	default:
+		return nil, jerr.WithMsgF(`invalid reliable packet type %d`, p.packetType)
+	}
+	return p, nil
+}
+
+// seqLess checks whether sequence number `a` is before `b`, considering wrap around.
+func seqLess(a, b uint32) bool {
+	return int32(a-b) < 0
+}
+
+// seqRanges returns the consecutive ranges of sequence numbers, at most `max` ranges.
+func seqRanges(seqs []uint32, max int) []reliableSeqRange {
+	sort.Slice(seqs, func(i, j int) bool {
+		return seqLess(seqs[i], seqs[j])
+	})
+	var ranges []reliableSeqRange
+	for _, seq := range seqs {
+		if n := len(ranges); n > 0 && ranges[n-1].end == seq {
+			ranges[n-1].end++
+			continue
+		}
+		if len(ranges) == max {
+			break
+		}
+		ranges = append(ranges, reliableSeqRange{start: seq, end: seq + 1})
+	}
+	return ranges
+}
@@ -0,0 +1,587 @@
+package judp
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/e7coding/coding-common/errs/jerr"
+	"github.com/e7coding/coding-common/internal/intlog"
+	"github.com/e7coding/coding-common/jutil/jrand"
+)
+
+// ReliableConn is a reliable message connection over UDP, which provides acknowledgement,
+// retransmission with RTO estimation, duplicate suppression, in-order delivery, and fragmentation
+// of large messages. It's message oriented that each Recv returns a whole message sent by Send.
+//
+// Eg:
+//
+//	conn, err := judp.DialReliable("127.0.0.1:8888")
+//	if err != nil {
+//	    return err
+//	}
+//	defer conn.Close()
+//	err = conn.Send([]byte("telemetry"))
+type ReliableConn struct {
+	option     ReliableOption
+	connId     uint32
+	remoteAddr net.Addr
+	write      func(data []byte) error // Writes datagram to the remote address.
+	onClose    func()                  // Called once the connection is closed.
+	sendMu     sync.Mutex              // Serializes the fragments of messages, as the receiver reassembles them in sequence.
+
+	mu       sync.Mutex
+	closed   bool          // Whether the connection is closed, locally or due to failure.
+	closeErr error         // Error returned by Send and Recv after the connection is closed.
+	done     chan struct{} // Closed if the connection is closed.
+	notify   chan struct{} // Closed and reset if the state changes, for waiting senders and receivers.
+	sending  chan struct{} // Wakes up the retransmission loop if fragments are sent when there's none unacknowledged.
+	lastRecv time.Time     // Time of the last packet received, for idle timeout.
+	lastSend time.Time     // Time of the last packet sent, for keepalive.
+
+	// Sender states.
+	nextSeq  uint32                      // Sequence number of the next fragment.
+	sendBase uint32                      // Cumulative ack from the remote side, the send window starts at it.
+	unacked  map[uint32]*reliableSegment // Fragments sent but not acknowledged.
+	rto      time.Duration               // Retransmission timeout.
+	srtt     time.Duration               // Smoothed round-trip time, 0 if not measured.
+	rttvar   time.Duration               // Round-trip time variation.
+	finSent  bool                        // Whether fin is sent.
+
+	// Receiver states.
+	expected   uint32                     // Next sequence number expected.
+	buffered   map[uint32]*reliablePacket // Out-of-order fragments received.
+	assembling []byte                     // Fragments of the message being reassembled.
+	messages   [][]byte                   // Messages reassembled and waiting for Recv.
+	finRecv    bool                       // Whether fin is received in order.
+}
+
+// reliableSegment is a fragment sent but not acknowledged.
+type reliableSegment struct {
+	packet      []byte    // Encoded packet.
+	sentAt      time.Time // Time of the first sending, for RTT measurement.
+	deadline    time.Time // Time of the next retransmission.
+	retransmits int       // Count of retransmissions.
+	skipped     int       // Count of acks that acknowledge later fragments but not this one.
+}
+
+// DialReliable creates and returns a ReliableConn to `remoteAddress` like "127.0.0.1:8888",
+// which is accepted by ReliableListener of the remote side.
+// The optional parameter `option` specifies the reliable option, which should be the same as the remote side.
+func DialReliable(remoteAddress string, option ...ReliableOption) (*ReliableConn, error) {
+	opt, err := getReliableOption(option...)
+	if err != nil {
+		return nil, err
+	}
+	clientConn, err := NewClientConn(remoteAddress)
+	if err != nil {
+		return nil, err
+	}
+	conn := newReliableConn(opt, binary.BigEndian.Uint32(jrand.B(4)), clientConn.RemoteAddr(), func(data []byte) error {
+		return clientConn.Send(data)
+	})
+	conn.onClose = func() {
+		_ = clientConn.Close()
+	}
+	go func() {
+		for {
+			data, _, err := clientConn.Recv(opt.MTU)
+			if err != nil {
+				select {
+				case <-conn.done:
+					return
+				default:
+				}
+				// It might be the ICMP error if the remote side is not ready, which is recovered
+				// by retransmission.
+				intlog.Errorf(`%+v`, err)
+				time.Sleep(reliableTickInterval)
+				continue
+			}
+			packet, err := unmarshalReliablePacket(data)
+			if err != nil || packet.connId != conn.connId {
+				intlog.Printf(`drop invalid reliable packet from "%s": %v`, conn.remoteAddr, err)
+				continue
+			}
+			conn.handle(packet)
+		}
+	}()
+	return conn, nil
+}
+
+// newReliableConn creates and returns a ReliableConn, and starts its retransmission loop.
+func newReliableConn(option ReliableOption, connId uint32, remoteAddr net.Addr, write func([]byte) error) *ReliableConn {
+	c := &ReliableConn{
+		option:     option,
+		connId:     connId,
+		remoteAddr: remoteAddr,
+		write:      write,
+		done:       make(chan struct{}),
+		notify:     make(chan struct{}),
+		sending:    make(chan struct{}, 1),
+		unacked:    make(map[uint32]*reliableSegment),
+		buffered:   make(map[uint32]*reliablePacket),
+		rto:        option.InitialRTO,
+		lastRecv:   time.Now(),
+		lastSend:   time.Now(),
+	}
+	go c.retransmitLoop()
+	return c
+}
+
+// RemoteAddr returns the remote address of the connection.
+func (c *ReliableConn) RemoteAddr() net.Addr {
+	return c.remoteAddr
+}
+
+// Send sends message `data` reliably. It blocks if the send window is full, and returns after the
+// message is sent, but not necessarily acknowledged. Use Flush to wait for the acknowledgement.
+// It's safe for concurrent use, the fragments of concurrent messages are not interleaved.
+func (c *ReliableConn) Send(data []byte) error {
+	return c.SendCtx(context.Background(), data)
+}
+
+// SendCtx is the same as Send, but it returns the error of `ctx` if `ctx` is done while waiting
+// for the send window. Note that the fragments already sent are not canceled.
+func (c *ReliableConn) SendCtx(ctx context.Context, data []byte) error {
+	if len(data) > c.option.MaxMessageSize {
+		return jerr.WithMsgF(
+			`message size %d exceeds allowed max message size %d`, len(data), c.option.MaxMessageSize,
+		)
+	}
+	var (
+		fragSize  = c.option.MTU - reliableHeaderSize
+		fragCount = (len(data) + fragSize - 1) / fragSize
+	)
+	if fragCount == 0 {
+		fragCount = 1
+	}
+	c.sendMu.Lock()
+	defer c.sendMu.Unlock()
+	for i := 0; i < fragCount; i++ {
+		end := (i + 1) * fragSize
+		if end > len(data) {
+			end = len(data)
+		}
+		if err := c.sendPacket(ctx, &reliablePacket{
+			packetType: reliablePacketData,
+			fragIndex:  i,
+			fragCount:  fragCount,
+			payload:    data[i*fragSize : end],
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Recv receives the next message in order. It returns io.EOF if the remote side closes the
+// connection and all its messages are received.
+func (c *ReliableConn) Recv() ([]byte, error) {
+	return c.RecvCtx(context.Background())
+}
+
+// RecvCtx is the same as Recv, but it returns the error of `ctx` if `ctx` is done while waiting.
+func (c *ReliableConn) RecvCtx(ctx context.Context) ([]byte, error) {
+	for {
+		c.mu.Lock()
+		if len(c.messages) > 0 {
+			message := c.messages[0]
+			c.messages[0] = nil
+			c.messages = c.messages[1:]
+			c.mu.Unlock()
+			return message, nil
+		}
+		if c.finRecv {
+			c.mu.Unlock()
+			return nil, io.EOF
+		}
+		if c.closed {
+			c.mu.Unlock()
+			return nil, c.closeErr
+		}
+		notify := c.notify
+		c.mu.Unlock()
+		select {
+		case <-notify:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// Flush blocks until all sent messages are acknowledged, or `ctx` is done.
+func (c *ReliableConn) Flush(ctx context.Context) error {
+	for {
+		c.mu.Lock()
+		if c.closed && len(c.unacked) > 0 {
+			c.mu.Unlock()
+			return c.closeErr
+		}
+		if len(c.unacked) == 0 {
+			c.mu.Unlock()
+			return nil
+		}
+		notify := c.notify
+		c.mu.Unlock()
+		select {
+		case <-notify:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Close sends the end of stream to the remote side, and waits at most CloseTimeout for the sent
+// messages to be acknowledged before closing the connection.
+func (c *ReliableConn) Close() error {
+	c.mu.Lock()
+	if c.closed || c.finSent {
+		c.mu.Unlock()
+		return nil
+	}
+	finRecv := c.finRecv
+	c.mu.Unlock()
+	ctx, cancel := context.WithTimeout(context.Background(), c.option.CloseTimeout)
+	defer cancel()
+	// The fin is sent after the message being sent, not between its fragments.
+	c.sendMu.Lock()
+	err := c.sendPacket(ctx, &reliablePacket{packetType: reliablePacketFin})
+	c.sendMu.Unlock()
+	// The remote side that already closes does not acknowledge the fin.
+	if err == nil && !finRecv {
+		err = c.Flush(ctx)
+	}
+	c.fail(jerr.WithMsg(`reliable connection closed`))
+	if err == context.DeadlineExceeded {
+		return jerr.WithMsgErr(err, `reliable connection close timeout waiting for acknowledgement`)
+	}
+	return err
+}
+
+// sendPacket assigns sequence number to data or fin `packet` and sends it,
+// which blocks if the send window is full.
+func (c *ReliableConn) sendPacket(ctx context.Context, packet *reliablePacket) error {
+	for {
+		c.mu.Lock()
+		if c.closed {
+			c.mu.Unlock()
+			return c.closeErr
+		}
+		if c.finSent {
+			c.mu.Unlock()
+			return jerr.WithMsg(`reliable connection is closing`)
+		}
+		// The window is counted from the cumulative ack, as the receiver drops fragments beyond it.
+		if c.nextSeq-c.sendBase < uint32(c.option.WindowSize) {
+			break
+		}
+		notify := c.notify
+		c.mu.Unlock()
+		select {
+		case <-notify:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	packet.connId = c.connId
+	packet.seq = c.nextSeq
+	c.nextSeq++
+	if packet.packetType == reliablePacketFin {
+		c.finSent = true
+	}
+	var (
+		now  = time.Now()
+		data = packet.marshal()
+	)
+	if len(c.unacked) == 0 {
+		select {
+		case c.sending <- struct{}{}:
+		default:
+		}
+	}
+	c.unacked[packet.seq] = &reliableSegment{
+		packet:   data,
+		sentAt:   now,
+		deadline: now.Add(c.rto),
+	}
+	c.lastSend = now
+	c.mu.Unlock()
+	if err := c.write(data); err != nil {
+		// It's retransmitted later.
+		intlog.Errorf(`%+v`, err)
+	}
+	return nil
+}
+
+// handle handles the packet received from the remote side.
+func (c *ReliableConn) handle(packet *reliablePacket) {
+	c.mu.Lock()
+	c.lastRecv = time.Now()
+	c.mu.Unlock()
+	switch packet.packetType {
+	case reliablePacketAck:
+		c.handleAck(packet)
+	case reliablePacketData, reliablePacketFin:
+		c.handleData(packet)
+	}
+}
+
+// handleAck removes the acknowledged fragments and updates the RTO.
+func (c *ReliableConn) handleAck(packet *reliablePacket) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var (
+		now   = time.Now()
+		acked = false
+	)
+	if seqLess(c.sendBase, packet.seq) {
+		c.sendBase, acked = packet.seq, true
+	}
+	var highest = packet.seq
+	for _, sack := range packet.sacks {
+		if seqLess(highest, sack.end) {
+			highest = sack.end
+		}
+	}
+	for seq, segment := range c.unacked {
+		isAcked := seqLess(seq, packet.seq)
+		for _, sack := range packet.sacks {
+			if !isAcked && !seqLess(seq, sack.start) && seqLess(seq, sack.end) {
+				isAcked = true
+			}
+		}
+		if !isAcked {
+			// Fast retransmission: the fragment is probably lost if the later ones are acknowledged
+			// several times, which is retransmitted in the next tick without waiting for RTO.
+			if seqLess(seq, highest) {
+				if segment.skipped++; segment.skipped >= reliableFastResendSkips {
+					segment.skipped, segment.deadline = 0, now
+				}
+			}
+			continue
+		}
+		// Karn's algorithm: the RTT of retransmitted fragments is ambiguous.
+		if segment.retransmits == 0 {
+			c.updateRTO(now.Sub(segment.sentAt))
+		}
+		delete(c.unacked, seq)
+		acked = true
+	}
+	if acked {
+		c.broadcast()
+	}
+}
+
+// updateRTO updates the RTO with RTT sample `rtt` as RFC 6298.
+func (c *ReliableConn) updateRTO(rtt time.Duration) {
+	if c.srtt == 0 {
+		c.srtt, c.rttvar = rtt, rtt/2
+	} else {
+		delta := c.srtt - rtt
+		if delta < 0 {
+			delta = -delta
+		}
+		c.rttvar = (3*c.rttvar + delta) / 4
+		c.srtt = (7*c.srtt + rtt) / 8
+	}
+	variance := 4 * c.rttvar
+	if variance < reliableClockGranular {
+		variance = reliableClockGranular
+	}
+	c.rto = c.srtt + variance
+	if c.rto < c.option.MinRTO {
+		c.rto = c.option.MinRTO
+	}
+	if c.rto > c.option.MaxRTO {
+		c.rto = c.option.MaxRTO
+	}
+}
+
+// handleData buffers the fragment, delivers the reassembled messages in order, and sends ack.
+// The duplicate fragments are dropped but still acknowledged, in case that the previous ack is lost.
+func (c *ReliableConn) handleData(packet *reliablePacket) {
+	c.mu.Lock()
+	var (
+		isNew     = !seqLess(packet.seq, c.expected) && c.buffered[packet.seq] == nil
+		inWindow  = seqLess(packet.seq, c.expected+uint32(c.option.WindowSize))
+		delivered = false
+	)
+	if isNew && inWindow {
+		packet.payload = append([]byte(nil), packet.payload...)
+		c.buffered[packet.seq] = packet
+		for {
+			p, ok := c.buffered[c.expected]
+			if !ok {
+				break
+			}
+			delete(c.buffered, c.expected)
+			c.expected++
+			if p.packetType == reliablePacketFin {
+				c.finRecv, delivered = true, true
+				continue
+			}
+			if p.fragIndex == 0 {
+				c.assembling = c.assembling[:0]
+			}
+			c.assembling = append(c.assembling, p.payload...)
+			if p.fragIndex == p.fragCount-1 {
+				c.messages = append(c.messages, append([]byte(nil), c.assembling...))
+				c.assembling, delivered = c.assembling[:0], true
+			}
+		}
+	}
+	var (
+		seqs    = make([]uint32, 0, len(c.buffered))
+		maxSack = (c.option.MTU - reliableAckHeaderSize) / reliableSackBlockSize
+	)
+	for seq := range c.buffered {
+		seqs = append(seqs, seq)
+	}
+	if maxSack > reliableMaxSackBlocks {
+		maxSack = reliableMaxSackBlocks
+	}
+	ack := &reliablePacket{
+		packetType: reliablePacketAck,
+		connId:     c.connId,
+		seq:        c.expected,
+		sacks:      seqRanges(seqs, maxSack),
+	}
+	if delivered {
+		c.broadcast()
+	}
+	c.lastSend = time.Now()
+	c.mu.Unlock()
+	if err := c.write(ack.marshal()); err != nil {
+		intlog.Errorf(`%+v`, err)
+	}
+}
+
+// retransmitLoop retransmits the fragments whose RTO expires, until the connection is closed.
+// The connection fails if any fragment exceeds MaxRetransmits, or nothing is received in IdleTimeout.
+// It checks in every tick only if there're fragments unacknowledged, or else it sleeps until the
+// keepalive is due.
+func (c *ReliableConn) retransmitLoop() {
+	var (
+		keepaliveInterval = c.option.IdleTimeout / 3
+		timer             = time.NewTimer(reliableTickInterval)
+	)
+	defer timer.Stop()
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-c.sending:
+		case <-timer.C:
+		}
+		var (
+			now     = time.Now()
+			packets [][]byte
+			failErr error
+			wait    = reliableTickInterval
+		)
+		c.mu.Lock()
+		if now.Sub(c.lastRecv) >= c.option.IdleTimeout {
+			failErr = jerr.WithMsgF(
+				`reliable connection to "%s" failed: idle timeout %s exceeded`,
+				c.remoteAddr, c.option.IdleTimeout,
+			)
+		}
+		var expired []*reliableSegment
+		for _, segment := range c.unacked {
+			if failErr != nil {
+				break
+			}
+			if now.Before(segment.deadline) {
+				continue
+			}
+			if segment.retransmits >= c.option.MaxRetransmits {
+				failErr = jerr.WithMsgF(
+					`reliable connection to "%s" failed: max retransmits %d exceeded`,
+					c.remoteAddr, c.option.MaxRetransmits,
+				)
+				break
+			}
+			expired = append(expired, segment)
+		}
+		if failErr == nil {
+			for _, segment := range expired {
+				segment.retransmits++
+				segment.deadline = now.Add(c.backoffRTO(segment.retransmits))
+				packets = append(packets, segment.packet)
+			}
+			if len(c.unacked) == 0 {
+				// The keepalive is an ack that changes nothing but the idle time of the remote side.
+				if now.Sub(c.lastSend) >= keepaliveInterval {
+					packets = append(packets, (&reliablePacket{
+						packetType: reliablePacketAck,
+						connId:     c.connId,
+						seq:        c.expected,
+					}).marshal())
+					c.lastSend = now
+				}
+				wait = minTime(c.lastSend.Add(keepaliveInterval), c.lastRecv.Add(c.option.IdleTimeout)).Sub(now)
+				if wait < reliableTickInterval {
+					wait = reliableTickInterval
+				}
+			}
+		}
+		c.mu.Unlock()
+		if failErr != nil {
+			c.fail(failErr)
+			return
+		}
+		for _, packet := range packets {
+			if err := c.write(packet); err != nil {
+				intlog.Errorf(`%+v`, err)
+			}
+		}
+		timer.Reset(wait)
+	}
+}
+
+// backoffRTO returns the RTO of the fragment retransmitted `retransmits` times, which is doubled
+// for each retransmission. The caller should hold the lock.
+func (c *ReliableConn) backoffRTO(retransmits int) time.Duration {
+	rto := c.rto
+	for i := 0; i < retransmits && rto < c.option.MaxRTO; i++ {
+		rto *= 2
+	}
+	if rto > c.option.MaxRTO {
+		rto = c.option.MaxRTO
+	}
+	return rto
+}
+
+// fail closes the connection with `err`, which is returned by the following Send and Recv.
+func (c *ReliableConn) fail(err error) {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return
+	}
+	c.closed, c.closeErr = true, err
+	close(c.done)
+	c.broadcast()
+	c.mu.Unlock()
+	if c.onClose != nil {
+		c.onClose()
+	}
+}
+
+// broadcast wakes up the waiting senders and receivers, the caller should hold the lock.
+func (c *ReliableConn) broadcast() {
+	close(c.notify)
+	c.notify = make(chan struct{})
+}
+
+// minTime returns the earlier one of `a` and `b`.
+func minTime(a, b time.Time) time.Time {
+	if a.Before(b) {
+		return a
+	}
+	return b
+}
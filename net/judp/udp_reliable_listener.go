@@ -0,0 +1,161 @@
+package judp
+
+import (
+	"net"
+	"sync"
+
+	"github.com/e7coding/coding-common/errs/jerr"
+	"github.com/e7coding/coding-common/internal/intlog"
+)
+
+// ReliableListener accepts ReliableConn from the remote sides created by DialReliable,
+// which are demultiplexed by remote address on one UDP connection.
+//
+// Eg:
+//
+//	listener, err := judp.ListenReliable(":8888")
+//	if err != nil {
+//	    return err
+//	}
+//	for {
+//	    conn, err := listener.Accept()
+//	    if err != nil {
+//	        return err
+//	    }
+//	    go handle(conn)
+//	}
+type ReliableListener struct {
+	conn     *ServerConn
+	option   ReliableOption
+	mu       sync.Mutex
+	conns    map[string]*ReliableConn // Remote address to its connection.
+	acceptCh chan *ReliableConn       // New connections waiting for Accept.
+	closed   bool                     // Whether the listener is closed.
+	done     chan struct{}            // Closed if the listener is closed.
+}
+
+// ListenReliable creates and returns a ReliableListener listening on UDP `address` like ":8888".
+// The optional parameter `option` specifies the reliable option, which should be the same as the remote sides.
+func ListenReliable(address string, option ...ReliableOption) (*ReliableListener, error) {
+	opt, err := getReliableOption(option...)
+	if err != nil {
+		return nil, err
+	}
+	addr, err := net.ResolveUDPAddr("udp", address)
+	if err != nil {
+		return nil, jerr.WithMsgErrF(err, `net.ResolveUDPAddr failed for address "%s"`, address)
+	}
+	udpConn, err := net.ListenUDP("udp", addr)
+	if err != nil {
+		return nil, jerr.WithMsgErrF(err, `net.ListenUDP failed for address "%s"`, address)
+	}
+	l := &ReliableListener{
+		conn:     NewServerConn(udpConn),
+		option:   opt,
+		conns:    make(map[string]*ReliableConn),
+		acceptCh: make(chan *ReliableConn, defaultReliableAcceptBacklog),
+		done:     make(chan struct{}),
+	}
+	go l.readLoop()
+	return l, nil
+}
+
+// Accept waits for and returns the next connection.
+func (l *ReliableListener) Accept() (*ReliableConn, error) {
+	select {
+	case conn := <-l.acceptCh:
+		return conn, nil
+	case <-l.done:
+		return nil, jerr.WithMsg(`reliable listener closed`)
+	}
+}
+
+// Addr returns the listened address.
+func (l *ReliableListener) Addr() net.Addr {
+	return l.conn.LocalAddr()
+}
+
+// Close closes the listener and all its connections without waiting for acknowledgement.
+func (l *ReliableListener) Close() error {
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		return nil
+	}
+	l.closed = true
+	close(l.done)
+	conns := make([]*ReliableConn, 0, len(l.conns))
+	for _, conn := range l.conns {
+		conns = append(conns, conn)
+	}
+	l.mu.Unlock()
+	for _, conn := range conns {
+		conn.fail(jerr.WithMsg(`reliable listener closed`))
+	}
+	return l.conn.Close()
+}
+
+// readLoop reads packets and dispatches them to the connections until the listener is closed.
+// A new connection is created by the first data packet from a remote address or with new conn id.
+func (l *ReliableListener) readLoop() {
+	for {
+		data, remoteAddr, err := l.conn.RecvFrom(l.option.MTU)
+		if err != nil {
+			select {
+			case <-l.done:
+				return
+			default:
+			}
+			intlog.Errorf(`%+v`, err)
+			continue
+		}
+		packet, err := unmarshalReliablePacket(data)
+		if err != nil {
+			intlog.Printf(`drop invalid reliable packet from "%s": %v`, remoteAddr, err)
+			continue
+		}
+		if conn := l.getConn(remoteAddr, packet); conn != nil {
+			conn.handle(packet)
+		}
+	}
+}
+
+// getConn returns the connection of the packet, it creates the connection if the packet is
+// the first data packet of a new connection.
+func (l *ReliableListener) getConn(remoteAddr net.Addr, packet *reliablePacket) *ReliableConn {
+	key := remoteAddr.String()
+	l.mu.Lock()
+	conn := l.conns[key]
+	if conn != nil && conn.connId == packet.connId {
+		l.mu.Unlock()
+		return conn
+	}
+	// The new connection starts at sequence 0, the other packets are from the closed connections.
+	if packet.packetType == reliablePacketAck || packet.seq != 0 || l.closed {
+		l.mu.Unlock()
+		return nil
+	}
+	newConn := newReliableConn(l.option, packet.connId, remoteAddr, func(data []byte) error {
+		return l.conn.SendTo(data, remoteAddr)
+	})
+	newConn.onClose = func() {
+		l.mu.Lock()
+		if l.conns[key] == newConn {
+			delete(l.conns, key)
+		}
+		l.mu.Unlock()
+	}
+	l.conns[key] = newConn
+	l.mu.Unlock()
+	// The remote side restarts with a new connection.
+	if conn != nil {
+		conn.fail(jerr.WithMsgF(`reliable connection from "%s" is replaced`, key))
+	}
+	select {
+	case l.acceptCh <- newConn:
+		return newConn
+	default:
+		newConn.fail(jerr.WithMsg(`reliable listener accept backlog is full`))
+		return nil
+	}
+}
@@ -10,7 +10,9 @@ import (
 	"fmt"
 	"github.com/e7coding/coding-common/container/jmap"
 	"github.com/e7coding/coding-common/errs/jerr"
+	"github.com/e7coding/coding-common/internal/unixsock"
 	"net"
+	"os"
 	"sync"
 
 	"github.com/e7coding/coding-common/jutil/jconv"
@@ -40,6 +42,18 @@ type Server struct {
 
 	// Handler for UDP connection.
 	handler ServerHandler
+
+	// Whether PROXY protocol v2 header is read from each datagram.
+	proxyProtocol bool
+
+	// Permission of unix datagram socket file.
+	unixSocketPerm os.FileMode
+
+	// Whether the server address is a multicast group to join.
+	multicast bool
+
+	// Network interface name for joining the multicast group.
+	multicastIface string
 }
 
 // ServerHandler handles all server connections.
@@ -88,8 +102,15 @@ func (s *Server) SetHandler(handler ServerHandler) {
 	s.handler = handler
 }
 
+// SetUnixSocketPerm sets the permission of the socket file if the server listens on unix datagram
+// socket address like "unixgram:///var/run/app.sock", eg: 0660. It should be called before Run.
+func (s *Server) SetUnixSocketPerm(perm os.FileMode) {
+	s.unixSocketPerm = perm
+}
+
 // Close closes the connection.
 // It will make server shutdowns immediately.
+// The socket file is removed if the server listens on unix datagram socket.
 func (s *Server) Close() (err error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -97,33 +118,81 @@ func (s *Server) Close() (err error) {
 	if err != nil {
 		err = jerr.WithMsgErr(err, "connection failed")
 	}
+	if network, path := unixsock.Parse(s.address, `udp`); network == unixsock.NetworkUnixgram {
+		if removeErr := unixsock.Remove(path); err == nil {
+			err = removeErr
+		}
+	}
 	return
 }
 
 // Run starts listening UDP connection.
-func (s *Server) Run() error {
+// The server address is UDP address like "127.0.0.1:80", or unix datagram socket address like
+// "unixgram:///var/run/app.sock", whose stale socket file is removed before listening.
+func (s *Server) Run() (err error) {
 	if s.handler == nil {
 		return jerr.WithMsg(
 			"start running failed: socket handler not defined",
 		)
 	}
-	addr, err := net.ResolveUDPAddr("udp", s.address)
-	if err != nil {
-		err = jerr.WithMsgErrF(err, `net.ResolveUDPAddr failed for address "%s"`, s.address)
-		return err
-	}
-	listenedConn, err := net.ListenUDP("udp", addr)
+	listenedConn, err := s.newConn()
 	if err != nil {
-		err = jerr.WithMsgErrF(err, `net.ListenUDP failed for address "%s"`, s.address)
 		return err
 	}
 	s.mu.Lock()
 	s.conn = NewServerConn(listenedConn)
+	s.conn.proxyProtocol = s.proxyProtocol
+	if s.multicast {
+		s.conn.group, _ = listenedConn.LocalAddr().(*net.UDPAddr)
+	}
 	s.mu.Unlock()
+	// The panic of the handler is recorded if observability is enabled, and it is panicked again,
+	// so that it's not swallowed by the server.
+	defer func() {
+		if exception := recover(); exception != nil {
+			s.conn.observer.recordPanic(exception)
+			s.conn.observer.end()
+			panic(exception)
+		}
+	}()
 	s.handler(s.conn)
 	return nil
 }
 
+// newConn creates the listened connection of the server address.
+func (s *Server) newConn() (PacketConn, error) {
+	network, address := unixsock.Parse(s.address, `udp`)
+	if network == unixsock.NetworkUnix {
+		return nil, jerr.WithMsgF(`unsupported network "%s" for UDP server`, network)
+	}
+	if network == unixsock.NetworkUnixgram {
+		if err := unixsock.Prepare(network, address); err != nil {
+			return nil, err
+		}
+		conn, err := net.ListenUnixgram(network, &net.UnixAddr{Name: address, Net: network})
+		if err != nil {
+			return nil, jerr.WithMsgErrF(err, `net.ListenUnixgram failed for address "%s"`, s.address)
+		}
+		if err = unixsock.Chmod(address, s.unixSocketPerm); err != nil {
+			_ = conn.Close()
+			return nil, err
+		}
+		return conn, nil
+	}
+	if s.multicast {
+		return s.newMulticastConn()
+	}
+	addr, err := net.ResolveUDPAddr(network, address)
+	if err != nil {
+		return nil, jerr.WithMsgErrF(err, `net.ResolveUDPAddr failed for address "%s"`, s.address)
+	}
+	conn, err := net.ListenUDP(network, addr)
+	if err != nil {
+		return nil, jerr.WithMsgErrF(err, `net.ListenUDP failed for address "%s"`, s.address)
+	}
+	return conn, nil
+}
+
 // GetListenedAddress retrieves and returns the address string which are listened by current server.
 func (s *Server) GetListenedAddress() string {
 	if !jstr.Contains(s.address, FreePortAddress) {
@@ -142,7 +211,9 @@ func (s *Server) GetListenedPort() int {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	if ln := s.conn; ln != nil {
-		return ln.LocalAddr().(*net.UDPAddr).Port
+		if addr, ok := ln.LocalAddr().(*net.UDPAddr); ok {
+			return addr.Port
+		}
 	}
 	return -1
 }
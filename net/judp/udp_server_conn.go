@@ -16,22 +16,31 @@ import (
 // ServerConn holds the server side connection.
 type ServerConn struct {
 	*localConn
+	proxyProtocol bool // Whether PROXY protocol v2 header is read from each datagram.
 }
 
 // NewServerConn creates an udp connection that listens to `localAddress`.
-func NewServerConn(listenedConn *net.UDPConn) *ServerConn {
+// The parameter `listenedConn` is *net.UDPConn, or *net.UnixConn of unix datagram socket.
+func NewServerConn(listenedConn PacketConn) *ServerConn {
 	return &ServerConn{
-		localConn: &localConn{
-			UDPConn: listenedConn,
-		},
+		localConn: newLocalConn(
+			listenedConn, newConnObserver(listenedConn, metricConnSideServer, listenedConn.LocalAddr().String()),
+		),
 	}
 }
 
 // Send writes data to remote address.
 func (c *ServerConn) Send(data []byte, remoteAddr *net.UDPAddr, retry ...Retry) (err error) {
+	return c.SendTo(data, remoteAddr, retry...)
+}
+
+// SendTo writes data to remote address, which is *net.UDPAddr for UDP,
+// or *net.UnixAddr for unix datagram socket.
+func (c *ServerConn) SendTo(data []byte, remoteAddr net.Addr, retry ...Retry) (err error) {
 	for {
-		_, err = c.WriteToUDP(data, remoteAddr)
+		_, err = c.WriteTo(data, remoteAddr)
 		if err == nil {
+			c.observer.recordSend(len(data))
 			return nil
 		}
 		// Connection closed.
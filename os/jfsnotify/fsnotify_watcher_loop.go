@@ -7,7 +7,6 @@
 package jfsnotify
 
 import (
-	"context"
 	"github.com/e7coding/coding-common/errs/jerr"
 
 	"github.com/e7coding/coding-common/container/jlist"
@@ -29,7 +28,7 @@ func (w *Watcher) watchLoop() {
 				return
 			}
 			// filter the repeated event in custom duration.
-			var cacheFunc = func(ctx context.Context) (value interface{}, err error) {
+			var cacheFunc = func() (value interface{}, err error) {
 				w.events.Push(&Event{
 					event:   ev,
 					Path:    ev.Name,
@@ -38,7 +37,7 @@ func (w *Watcher) watchLoop() {
 				})
 				return struct{}{}, nil
 			}
-			_, err := w.cache.SetIfNotExist(
+			_, err := w.cache.SetIfNotExistFunc(
 				ev.String(),
 				cacheFunc,
 				repeatEventFilterDuration,
@@ -161,7 +160,7 @@ func (w *Watcher) checkRecursiveWatchingInCreatingEvent(path string) bool {
 			break
 		}
 		if callbackItem := w.callbacks.Get(parentDirPath); callbackItem != nil {
-			for _, node := range callbackItem.(*jlist.List).FrontAll() {
+			for _, node := range callbackItem.(*jlist.SafeList).FrontAll() {
 				callback := node.(*Callback)
 				if callback.recursive {
 					return true
@@ -196,7 +195,7 @@ func (w *Watcher) doCallback(event *Event, callback *Callback) {
 func (w *Watcher) getCallbacksForPath(path string) (callbacks []*Callback) {
 	// Firstly add the callbacks of itself.
 	if item := w.callbacks.Get(path); item != nil {
-		for _, node := range item.(*jlist.List).FrontAll() {
+		for _, node := range item.(*jlist.SafeList).FrontAll() {
 			callback := node.(*Callback)
 			callbacks = append(callbacks, callback)
 		}
@@ -209,7 +208,7 @@ func (w *Watcher) getCallbacksForPath(path string) (callbacks []*Callback) {
 	// ============================================================================================================
 	dirPath := fileDir(path)
 	if item := w.callbacks.Get(dirPath); item != nil {
-		for _, node := range item.(*jlist.List).FrontAll() {
+		for _, node := range item.(*jlist.SafeList).FrontAll() {
 			callback := node.(*Callback)
 			callbacks = append(callbacks, callback)
 		}
@@ -222,7 +221,7 @@ func (w *Watcher) getCallbacksForPath(path string) (callbacks []*Callback) {
 			break
 		}
 		if item := w.callbacks.Get(parentDirPath); item != nil {
-			for _, node := range item.(*jlist.List).FrontAll() {
+			for _, node := range item.(*jlist.SafeList).FrontAll() {
 				callback := node.(*Callback)
 				if callback.recursive {
 					callbacks = append(callbacks, callback)
@@ -7,7 +7,6 @@
 package jproc
 
 import (
-	"fmt"
 	"github.com/e7coding/coding-common/container/jmap"
 	"github.com/e7coding/coding-common/errs/jerr"
 	"sync"
@@ -34,10 +33,12 @@ type MsgResponse struct {
 }
 
 const (
-	defaultFolderNameForProcComm = "gf_pid_port_mapping" // Default folder name for storing pid to port mapping files.
-	defaultGroupNameForProcComm  = ""                    // Default group name.
-	defaultTcpPortForProcComm    = 10000                 // Starting port number for receiver listening.
-	maxLengthForProcMsgQueue     = 10000                 // Max size for each message queue of the group.
+	defaultFolderNameForProcComm = "gf_proc_comm" // Default folder name for storing unix domain socket files.
+	defaultGroupNameForProcComm  = ""             // Default group name.
+	maxLengthForProcMsgQueue     = 10000          // Max size for each message queue of the group.
+	commSocketFileExt            = ".sock"        // File extension of unix domain socket files.
+	commSocketFilePerm           = 0600           // Permission of unix domain socket files, only the same user can send.
+	commRPCMethodSend            = "jproc.send"   // RPC method for sending message to the receiver process.
 )
 
 var (
@@ -45,47 +46,38 @@ var (
 	// The value of the map is type of *gqueue.Queue.
 	commReceiveQueues = jmap.NewSafeStrAnyMap()
 
-	// commPidFolderPath specifies the folder path storing pid to port mapping files.
+	// commPidFolderPath specifies the folder path storing unix domain socket files of processes.
 	commPidFolderPath string
 
 	// commPidFolderPathOnce is used for lazy calculation for `commPidFolderPath` is necessary.
 	commPidFolderPathOnce sync.Once
 )
 
-// getConnByPid creates and returns a TCP connection for specified pid.
-func getConnByPid(pid int) (*jtcp.PoolConn, error) {
-	port := getPortByPid(pid)
-	if port > 0 {
-		if conn, err := jtcp.NewPoolConn(fmt.Sprintf("127.0.0.1:%d", port)); err == nil {
-			return conn, nil
-		} else {
-			return nil, err
-		}
+// getClientByPid creates and returns a RPC client to the unix domain socket of specified pid.
+func getClientByPid(pid int) (*jtcp.RPCClient, error) {
+	path := getCommFilePath(pid)
+	if path == "" || !jfile.Exists(path) {
+		return nil, jerr.WithMsgF(`could not find socket file for pid "%d"`, pid)
 	}
-	return nil, jerr.WithMsgF(`could not find port for pid "%d"`, pid)
+	return jtcp.DialRPC(getCommAddress(path))
 }
 
-// getPortByPid returns the listening port for specified pid.
-// It returns 0 if no port found for the specified pid.
-func getPortByPid(pid int) int {
-	path := getCommFilePath(pid)
-	if path == "" {
-		return 0
-	}
-	return jconv.Int(jfile.GetContentsWithCache(path))
+// getCommAddress returns the unix domain socket address of socket file `path`.
+func getCommAddress(path string) string {
+	return "unix://" + path
 }
 
-// getCommFilePath returns the pid to port mapping file path for given pid.
+// getCommFilePath returns the unix domain socket file path for given pid.
 func getCommFilePath(pid int) string {
 	path, err := getCommPidFolderPath()
 	if err != nil {
 		intlog.Errorf(`%+v`, err)
 		return ""
 	}
-	return jfile.Join(path, jconv.String(pid))
+	return jfile.Join(path, jconv.String(pid)+commSocketFileExt)
 }
 
-// getCommPidFolderPath retrieves and returns the available directory for storing pid mapping files.
+// getCommPidFolderPath retrieves and returns the available directory for storing unix domain socket files.
 func getCommPidFolderPath() (folderPath string, err error) {
 	commPidFolderPathOnce.Do(func() {
 		availablePaths := []string{
@@ -108,7 +100,7 @@ func getCommPidFolderPath() (folderPath string, err error) {
 		}
 		if commPidFolderPath == "" {
 			err = jerr.WithMsgF(
-				`cannot find available folder for storing pid to port mapping files in paths: %+v`,
+				`cannot find available folder for storing unix domain socket files in paths: %+v`,
 				availablePaths,
 			)
 		}
@@ -7,11 +7,9 @@
 package jproc
 
 import (
-	"github.com/e7coding/coding-common/errs/jerr"
-	"io"
+	"context"
 
-	"github.com/e7coding/coding-common/internal/json"
-	"github.com/e7coding/coding-common/net/jtcp"
+	"github.com/e7coding/coding-common/errs/jerr"
 )
 
 // Send sends data to specified process of given pid.
@@ -25,34 +23,18 @@ func Send(pid int, data []byte, group ...string) error {
 	if len(group) > 0 {
 		msg.Group = group[0]
 	}
-	msgBytes, err := json.Marshal(msg)
-	if err != nil {
-		return err
-	}
-	var conn *jtcp.PoolConn
-	conn, err = getConnByPid(pid)
+	client, err := getClientByPid(pid)
 	if err != nil {
 		return err
 	}
-	defer conn.Close()
+	defer client.Close()
 	// Do the sending.
-	var result []byte
-	result, err = conn.SendRecvPkg(msgBytes, jtcp.PkgOption{
-		Retry: jtcp.Retry{
-			Count: 3,
-		},
-	})
-	if len(result) > 0 {
-		response := new(MsgResponse)
-		if err = json.UnmarshalUseNumber(result, response); err == nil {
-			if response.Code != 1 {
-				err = jerr.WithMsg(response.Message)
-			}
-		}
+	response := new(MsgResponse)
+	if err = client.Call(context.Background(), commRPCMethodSend, msg, response); err != nil {
+		return err
 	}
-	// EOF is not really an error.
-	if err == io.EOF {
-		err = nil
+	if response.Code != 1 {
+		return jerr.WithMsg(response.Message)
 	}
-	return err
+	return nil
 }
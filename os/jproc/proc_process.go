@@ -16,7 +16,6 @@ import (
 	"strings"
 
 	"go.opentelemetry.io/otel"
-	"go.opentelemetry.io/otel/propagation"
 	"go.opentelemetry.io/otel/trace"
 
 	"github.com/e7coding/coding-common"
@@ -85,10 +84,7 @@ func (p *Process) Start(ctx context.Context) (int, error) {
 		)
 	)
 	ctx, span = tr.Start(
-		otel.GetTextMapPropagator().Extract(
-			ctx,
-			propagation.MapCarrier(jenv.Map()),
-		),
+		jtrace.ExtractCarrier(ctx, jtrace.NewCarrierFromEnviron(os.Environ())),
 		jstr.Join(os.Args, " "),
 		trace.WithSpanKind(trace.SpanKindInternal),
 	)
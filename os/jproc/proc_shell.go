@@ -9,13 +9,10 @@ package jproc
 import (
 	"bytes"
 	"context"
-	"fmt"
 	"io"
 	"runtime"
 
-	"go.opentelemetry.io/otel"
-	"go.opentelemetry.io/otel/propagation"
-
+	"github.com/e7coding/coding-common/net/jtrace"
 	"github.com/e7coding/coding-common/os/jfile"
 )
 
@@ -104,13 +101,5 @@ func getShellOption() string {
 
 // tracingEnvFromCtx converts OpenTelemetry propagation data as environment variables.
 func tracingEnvFromCtx(ctx context.Context) []string {
-	var (
-		a = make([]string, 0)
-		m = make(map[string]string)
-	)
-	otel.GetTextMapPropagator().Inject(ctx, propagation.MapCarrier(m))
-	for k, v := range m {
-		a = append(a, fmt.Sprintf(`%s=%s`, k, v))
-	}
-	return a
+	return jtrace.InjectCarrier(ctx).Environ()
 }